@@ -0,0 +1,235 @@
+// Package client 是调用 manager 和 usercenter HTTP 接口的公共部分，负责编码请求、解析统一的响应格式、
+// 把错误响应转换为 *Error，以及重试可以安全重试的请求。各服务的接口在子包 manager 和 usercenter 中。
+package client
+
+import (
+	"bytes"
+	"common/logging"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Response 是各服务统一的响应格式，Data 在解析到具体类型之前保持原样。
+type Response struct {
+	StatusCode uint32          `json:"status_code"`
+	Message    string          `json:"message"`
+	Data       json.RawMessage `json:"data"`
+}
+
+var (
+	ErrBadRequest = errors.New("bad request")
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrInternal   = errors.New("internal server error")
+)
+
+// Error 是服务返回的错误响应。StatusCode 为响应体中的 status_code，可能与 HTTP 状态码不同，
+// 例如 usercenter 登录失败时返回 HTTP 400 和 status_code 500。Detail 为 data 中的错误描述。
+// 请求没有通过 OpenAPI 文档校验时 Fields 为各个字段的错误。
+// 可以用 errors.Is 判断 ErrBadRequest、ErrNotFound、ErrConflict 和 ErrInternal。
+type Error struct {
+	HTTPStatus int
+	StatusCode uint32
+	Message    string
+	Detail     string
+	Fields     []FieldError
+}
+
+// FieldError 是请求中一个字段的校验错误，与服务返回的 data 中的格式相同。
+type FieldError struct {
+	In      string `json:"in"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%d %s (HTTP %d)", e.StatusCode, e.Message, e.HTTPStatus)
+	}
+	return fmt.Sprintf("%d %s (HTTP %d): %s", e.StatusCode, e.Message, e.HTTPStatus, e.Detail)
+}
+
+func (e *Error) Unwrap() error {
+	switch e.StatusCode {
+	case 400:
+		return ErrBadRequest
+	case 404:
+		return ErrNotFound
+	case 409:
+		return ErrConflict
+	case 500:
+		return ErrInternal
+	}
+	return nil
+}
+
+// Request 是一次接口调用。JSON 和 Form 最多设置一个，分别以 JSON 和表单编码为请求体。
+// GET 请求总是可以重试，其他请求只有 Retryable 为 true（例如带有幂等键）时才重试。
+type Request struct {
+	Method    string
+	Path      string
+	Query     url.Values
+	JSON      interface{}
+	Form      url.Values
+	Header    http.Header
+	Retryable bool
+}
+
+// Client 是一个服务的客户端。可重试的请求在连接失败、HTTP 429 或 5xx 时最多重试 Retries 次，
+// 第一次重试前等待 RetryInterval，之后每次翻倍。
+type Client struct {
+	BaseURL       string
+	HTTPClient    *http.Client
+	Retries       int
+	RetryInterval time.Duration
+}
+
+// New 返回使用默认超时和重试设置的客户端，baseURL 例如 http://manager:8080。
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:       strings.TrimRight(baseURL, "/"),
+		HTTPClient:    &http.Client{Timeout: 10 * time.Second},
+		Retries:       3,
+		RetryInterval: 500 * time.Millisecond,
+	}
+}
+
+// Do 发送请求，成功（HTTP 2xx）时将响应中的 data 解析到 out，out 为 nil 时不解析。
+// 请求头中携带 ctx 的关联 ID 和 trace 上下文。
+func (c *Client) Do(ctx context.Context, req *Request, out interface{}) (*Response, error) {
+	var (
+		body        []byte
+		contentType string
+		err         error
+	)
+	switch {
+	case req.JSON != nil:
+		if body, err = json.Marshal(req.JSON); err != nil {
+			return nil, fmt.Errorf("error encoding request body: %w", err)
+		}
+		contentType = "application/json"
+	case req.Form != nil:
+		body = []byte(req.Form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	}
+	target := c.BaseURL + req.Path
+	if len(req.Query) > 0 {
+		target += "?" + req.Query.Encode()
+	}
+	retryable := req.Method == http.MethodGet || req.Retryable
+
+	interval := c.RetryInterval
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(ctx, req, target, body, contentType)
+		if err == nil || !retryable || attempt >= c.Retries || !temporary(err) {
+			if err != nil {
+				return resp, err
+			}
+			return resp, decodeData(resp, out)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+func (c *Client) do(ctx context.Context, req *Request, target string, body []byte, contentType string) (*Response, error) {
+	request, err := http.NewRequestWithContext(ctx, req.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range req.Header {
+		request.Header[key] = values
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if id := logging.CorrelationID(ctx); id != "" {
+		request.Header.Set(logging.CorrelationHeader, id)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+	resp, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, &transportError{err}
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &transportError{fmt.Errorf("error reading response: %w", err)}
+	}
+
+	var result Response
+	if err := json.Unmarshal(raw, &result); err != nil {
+		// 网关等返回的非 JSON 响应。
+		return nil, &Error{HTTPStatus: resp.StatusCode, StatusCode: uint32(resp.StatusCode), Message: http.StatusText(resp.StatusCode), Detail: truncate(string(raw))}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		e := &Error{HTTPStatus: resp.StatusCode, StatusCode: result.StatusCode, Message: result.Message}
+		if err := json.Unmarshal(result.Data, &e.Detail); err != nil && len(result.Data) > 0 && string(result.Data) != "null" {
+			if json.Unmarshal(result.Data, &e.Fields) == nil {
+				var details []string
+				for _, field := range e.Fields {
+					details = append(details, field.Field+": "+field.Message)
+				}
+				e.Detail = strings.Join(details, "; ")
+			} else {
+				e.Detail = string(result.Data)
+			}
+		}
+		return &result, e
+	}
+	return &result, nil
+}
+
+func decodeData(resp *Response, out interface{}) error {
+	if out == nil || len(resp.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		return fmt.Errorf("error decoding response data: %w", err)
+	}
+	return nil
+}
+
+// transportError 是请求没有得到响应的错误，例如连接失败或超时。
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string { return "error sending request: " + e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+// temporary 返回错误是否可能在重试后恢复，ctx 结束的情况在等待重试时处理。
+func temporary(err error) bool {
+	var te *transportError
+	if errors.As(err, &te) {
+		return true
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.HTTPStatus == http.StatusTooManyRequests || e.HTTPStatus >= 500
+	}
+	return false
+}
+
+func truncate(s string) string {
+	const max = 256
+	if len(s) > max {
+		return s[:max] + "..."
+	}
+	return s
+}
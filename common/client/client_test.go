@@ -0,0 +1,117 @@
+package client
+
+import (
+	"common/logging"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c := New(server.URL)
+	c.RetryInterval = time.Millisecond
+	return c
+}
+
+func TestDoDecodesData(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(logging.CorrelationHeader) != "abc" {
+			t.Errorf("missing correlation header")
+		}
+		if r.URL.Query().Get("zone") != "huadong" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"status_code":200,"message":"OK","data":{"id":"op-1"}}`))
+	})
+	var data struct {
+		Id string `json:"id"`
+	}
+	ctx := logging.WithCorrelationID(context.Background(), "abc")
+	if _, err := c.Do(ctx, &Request{Method: http.MethodGet, Path: "/operations", Query: url.Values{"zone": {"huadong"}}}, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Id != "op-1" {
+		t.Errorf("got %q", data.Id)
+	}
+}
+
+func TestDoMapsStatusCode(t *testing.T) {
+	// usercenter 登录失败时 HTTP 状态码与 status_code 不同。
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" || r.PostFormValue("device_id") != "d1" {
+			t.Errorf("unexpected form %v", r.PostForm)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status_code":500,"message":"Internal server error","data":"no available instance"}`))
+	})
+	_, err := c.Do(context.Background(), &Request{Method: http.MethodPost, Path: "/device/login", Form: url.Values{"device_id": {"d1"}}}, nil)
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if e.HTTPStatus != http.StatusBadRequest || e.StatusCode != 500 || e.Detail != "no available instance" {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if !errors.Is(err, ErrInternal) || errors.Is(err, ErrBadRequest) {
+		t.Errorf("error %v is mapped by HTTP status instead of status_code", err)
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html>bad gateway</html>"))
+			return
+		}
+		w.Write([]byte(`{"status_code":200,"message":"OK","data":null}`))
+	})
+	if _, err := c.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/healthz"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 calls, got %d", calls.Load())
+	}
+
+	// 不可重试的请求只发送一次。
+	calls.Store(0)
+	_, err := c.Do(context.Background(), &Request{Method: http.MethodPost, Path: "/device/login"}, nil)
+	if err == nil || calls.Load() != 1 {
+		t.Errorf("expected a single failed call, got %d calls and %v", calls.Load(), err)
+	}
+
+	// 4xx 不重试。
+	c = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"status_code":404,"message":"Not found","data":"Operation x not found"}`))
+	})
+	calls.Store(0)
+	_, err = c.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/operations/x"}, nil)
+	if !errors.Is(err, ErrNotFound) || calls.Load() != 1 {
+		t.Errorf("expected a single not found call, got %d calls and %v", calls.Load(), err)
+	}
+}
+
+func TestDoFieldErrors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status_code":400,"message":"Bad request","data":[{"in":"body","field":"zone_id","message":"value is required"}]}`))
+	})
+	_, err := c.Do(context.Background(), &Request{Method: http.MethodPost, Path: "/device/logout"}, nil)
+	var e *Error
+	if !errors.As(err, &e) || !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("expected a bad request error, got %v", err)
+	}
+	if len(e.Fields) != 1 || e.Fields[0].Field != "zone_id" || e.Detail != "zone_id: value is required" {
+		t.Errorf("unexpected error %+v", e)
+	}
+}
@@ -0,0 +1,192 @@
+// Package manager 是 manager HTTP 接口的客户端。
+package manager
+
+import (
+	"common/client"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// 操作的状态。
+const (
+	OperationPending   = "pending"
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+type Client struct {
+	*client.Client
+}
+
+// New 返回 manager 的客户端，baseURL 例如 http://manager:8080。
+func New(baseURL string) *Client {
+	return &Client{client.New(baseURL)}
+}
+
+// ManageRequest 是 /instance/manage 的请求，Flavors 为各规格缺少的实例数，key 为规格名称。
+type ManageRequest struct {
+	ZoneId  string           `json:"zone_id"`
+	Flavors map[string]int32 `json:"flavors"`
+
+	// 幂等键，相同的键只会扩缩容一次，为空时不做去重。设置了幂等键的请求失败后会自动重试。
+	IdempotencyKey string `json:"-"`
+}
+
+type ManageResponse struct {
+	OperationId string `json:"operation_id"`
+	Replayed    bool   `json:"replayed"` // 是否为重复请求，重复请求不会再次扩缩容
+}
+
+// Manage 创建一次扩缩容操作，manager 受理后立即返回操作 ID，进度通过 GetOperation 查询。
+func (c *Client) Manage(ctx context.Context, req *ManageRequest) (*ManageResponse, error) {
+	header := http.Header{}
+	if req.IdempotencyKey != "" {
+		header.Set("Idempotency-Key", req.IdempotencyKey)
+	}
+	resp := &ManageResponse{}
+	_, err := c.Do(ctx, &client.Request{
+		Method:    http.MethodPost,
+		Path:      "/instance/manage",
+		JSON:      req,
+		Header:    header,
+		Retryable: req.IdempotencyKey != "",
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// OperationInstance 是操作中的一个实例。
+type OperationInstance struct {
+	InstanceId string `json:"instance_id"`
+	PodName    string `json:"pod_name"`
+	Flavor     string `json:"flavor"`
+	Action     string `json:"action"`
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+// Operation 是扩缩容操作的进度，Summary 为各状态的实例数。
+type Operation struct {
+	Id        string              `json:"id"`
+	ZoneId    string              `json:"zone_id"`
+	Status    string              `json:"status"`
+	Request   json.RawMessage     `json:"request"`
+	Result    json.RawMessage     `json:"result"`
+	Message   string              `json:"message"`
+	CreatedAt string              `json:"created_at"`
+	UpdatedAt string              `json:"updated_at"`
+	Summary   map[string]int      `json:"summary"`
+	Instances []OperationInstance `json:"instances"`
+}
+
+// Finished 返回操作是否已经结束。
+func (op *Operation) Finished() bool {
+	return op.Status == OperationSucceeded || op.Status == OperationFailed
+}
+
+// GetOperation 查询操作的进度，操作不存在时返回的错误满足 errors.Is(err, client.ErrNotFound)。
+func (c *Client) GetOperation(ctx context.Context, id string) (*Operation, error) {
+	op := &Operation{}
+	if _, err := c.Do(ctx, &client.Request{Method: http.MethodGet, Path: "/operations/" + url.PathEscape(id)}, op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// BounceRateQuery 是 /bounce/rate 的参数，Start 和 End 为零值时使用 manager 的默认值。
+type BounceRateQuery struct {
+	ZoneId     string
+	Start      time.Time
+	End        time.Time
+	Resolution string // 1m、5m、1h 或 1d
+}
+
+type Stats struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+type BounceBucket struct {
+	Start   string `json:"start"`
+	Samples int    `json:"samples"`
+	True    Stats  `json:"true"`
+	Pred    *Stats `json:"pred"`
+}
+
+type BounceSummary struct {
+	Minutes                         int     `json:"minutes"`
+	OverProvisionedInstanceMinutes  float64 `json:"over_provisioned_instance_minutes"`
+	UnderProvisionedMinutes         int     `json:"under_provisioned_minutes"`
+	UnderProvisionedInstanceMinutes float64 `json:"under_provisioned_instance_minutes"`
+	BounceRatio                     float64 `json:"bounce_ratio"`
+}
+
+type BounceRate struct {
+	ZoneId     string         `json:"zone_id"`
+	Resolution string         `json:"resolution"`
+	Date       []string       `json:"date"`
+	TrueIns    []float64      `json:"true_ins"`
+	BounceIns  []float64      `json:"bounce_ins"`
+	Buckets    []BounceBucket `json:"buckets"`
+	Summary    BounceSummary  `json:"summary"`
+}
+
+// BounceRate 查询 zone 的实际实例数与部署实例数的对比。
+func (c *Client) BounceRate(ctx context.Context, q *BounceRateQuery) (*BounceRate, error) {
+	query := url.Values{}
+	if q.ZoneId != "" {
+		query.Set("zone", q.ZoneId)
+	}
+	if !q.Start.IsZero() {
+		query.Set("start", q.Start.Local().Format(time.DateTime))
+	}
+	if !q.End.IsZero() {
+		query.Set("end", q.End.Local().Format(time.DateTime))
+	}
+	if q.Resolution != "" {
+		query.Set("resolution", q.Resolution)
+	}
+	rate := &BounceRate{}
+	if _, err := c.Do(ctx, &client.Request{Method: http.MethodGet, Path: "/bounce/rate", Query: query}, rate); err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+type WebhookSubscription struct {
+	Id        string   `json:"id"`
+	Url       string   `json:"url"`
+	Events    []string `json:"events"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// WebhookSubscribeRequest 是注册 webhook 订阅的请求，Events 为空时订阅所有事件。
+type WebhookSubscribeRequest struct {
+	Url    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+func (c *Client) ListWebhooks(ctx context.Context) ([]WebhookSubscription, error) {
+	var subscriptions []WebhookSubscription
+	if _, err := c.Do(ctx, &client.Request{Method: http.MethodGet, Path: "/webhooks"}, &subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func (c *Client) CreateWebhook(ctx context.Context, req *WebhookSubscribeRequest) (*WebhookSubscription, error) {
+	subscription := &WebhookSubscription{}
+	if _, err := c.Do(ctx, &client.Request{Method: http.MethodPost, Path: "/webhooks", JSON: req}, subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestManageRetriesWithIdempotencyKey(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Idempotency-Key") != "huadong-1" {
+			t.Errorf("missing idempotency key")
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["zone_id"] != "huadong" {
+			t.Errorf("unexpected body %v: %v", body, err)
+		}
+		if _, ok := body["IdempotencyKey"]; ok {
+			t.Errorf("idempotency key should only be sent in the header")
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status_code":503,"message":"Service unavailable","data":""}`))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status_code":202,"message":"Accepted","data":{"operation_id":"op-1","replayed":true}}`))
+	}))
+	defer server.Close()
+	c := New(server.URL)
+	c.RetryInterval = time.Millisecond
+
+	resp, err := c.Manage(context.Background(), &ManageRequest{ZoneId: "huadong", Flavors: map[string]int32{"default": 2}, IdempotencyKey: "huadong-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.OperationId != "op-1" || !resp.Replayed || calls.Load() != 2 {
+		t.Errorf("unexpected response %+v after %d calls", resp, calls.Load())
+	}
+}
+
+func TestBounceRateQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 时间中的空格需要转义。
+		if got := r.URL.Query().Get("start"); got != "2024-06-01 00:00:00" {
+			t.Errorf("unexpected start %q", got)
+		}
+		w.Write([]byte(`{"status_code":200,"message":"OK","data":{"zone_id":"huadong","resolution":"1h","summary":{"minutes":60,"bounce_ratio":0.5}}}`))
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local)
+	rate, err := New(server.URL).BounceRate(context.Background(), &BounceRateQuery{ZoneId: "huadong", Start: start, Resolution: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.Summary.Minutes != 60 || rate.Summary.BounceRatio != 0.5 {
+		t.Errorf("unexpected summary %+v", rate.Summary)
+	}
+}
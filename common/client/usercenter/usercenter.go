@@ -0,0 +1,75 @@
+// Package usercenter 是 usercenter HTTP 接口的客户端。
+package usercenter
+
+import (
+	"common/client"
+	"context"
+	"net/http"
+	"net/url"
+)
+
+type Client struct {
+	*client.Client
+}
+
+// New 返回 usercenter 的客户端，baseURL 例如 http://usercenter:8080。
+// 登录和登出不是幂等的，失败后不会自动重试。
+func New(baseURL string) *Client {
+	return &Client{client.New(baseURL)}
+}
+
+// Device 标识一个终端及其所在的边缘站点。
+type Device struct {
+	ZoneId   string
+	SiteId   string
+	DeviceId string
+}
+
+func (d *Device) form() url.Values {
+	return url.Values{
+		"zone_id":   {d.ZoneId},
+		"site_id":   {d.SiteId},
+		"device_id": {d.DeviceId},
+	}
+}
+
+// LoginRequest 是 /device/login 的请求，Flavor 为空时使用默认规格。
+type LoginRequest struct {
+	Device
+	Flavor string
+}
+
+// Instance 是分配给终端的实例。
+type Instance struct {
+	ZoneId     string `json:"zone_id"`
+	SiteId     string `json:"site_id"`
+	ServerIp   string `json:"server_ip"`
+	InstanceId string `json:"instance_id"`
+	PodName    string `json:"pod_name"`
+	Port       int    `json:"port"`
+	IsElastic  int    `json:"is_elastic"`
+	Status     string `json:"status"`
+	DeviceId   string `json:"device_id"`
+	Flavor     string `json:"flavor"`
+}
+
+// Login 将终端接入一个可用实例。没有可用实例时返回的错误满足 errors.Is(err, client.ErrInternal)。
+func (c *Client) Login(ctx context.Context, req *LoginRequest) (*Instance, error) {
+	form := req.form()
+	if req.Flavor != "" {
+		form.Set("flavor", req.Flavor)
+	}
+	var data struct {
+		Instance *Instance `json:"instance"`
+	}
+	if _, err := c.Do(ctx, &client.Request{Method: http.MethodPost, Path: "/device/login", Form: form}, &data); err != nil {
+		return nil, err
+	}
+	return data.Instance, nil
+}
+
+// Logout 将终端登出，释放其使用的实例。
+func (c *Client) Logout(ctx context.Context, device *Device) error {
+	_, err := c.Do(ctx, &client.Request{Method: http.MethodPost, Path: "/device/logout", Form: device.form()}, nil)
+	return err
+}
@@ -0,0 +1,81 @@
+package usercenter
+
+import (
+	"common/client"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/device/login" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.PostFormValue("zone_id") != "huadong" || r.PostFormValue("site_id") != "site-1" || r.PostFormValue("device_id") != "device-1" || r.PostFormValue("flavor") != "gpu" {
+			t.Errorf("unexpected form %v", r.PostForm)
+		}
+		w.Write([]byte(`{"status_code":200,"message":"OK","data":{"instance":{"zone_id":"huadong","site_id":"site-1","instance_id":"instance-1","port":8080,"status":"using","device_id":"device-1","flavor":"gpu"}}}`))
+	}))
+	defer server.Close()
+
+	instance, err := New(server.URL).Login(context.Background(), &LoginRequest{Device: Device{ZoneId: "huadong", SiteId: "site-1", DeviceId: "device-1"}, Flavor: "gpu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instance.InstanceId != "instance-1" || instance.Port != 8080 || instance.DeviceId != "device-1" {
+		t.Errorf("unexpected instance %+v", instance)
+	}
+}
+
+func TestLoginWithoutAvailableInstance(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// 未指定规格时不发送 flavor。
+		r.ParseForm()
+		if r.PostForm.Has("flavor") {
+			t.Errorf("unexpected flavor %q", r.PostForm.Get("flavor"))
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status_code":500,"message":"Internal server error","data":"no available instance to be found for device-1"}`))
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).Login(context.Background(), &LoginRequest{Device: Device{ZoneId: "huadong", SiteId: "site-1", DeviceId: "device-1"}})
+	var e *client.Error
+	if !errors.As(err, &e) || e.HTTPStatus != http.StatusBadRequest || e.Detail != "no available instance to be found for device-1" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// 按 status_code 判断错误类型，登录不重试。
+	if !errors.Is(err, client.ErrInternal) || errors.Is(err, client.ErrBadRequest) || calls.Load() != 1 {
+		t.Errorf("unexpected error %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestLogout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/device/logout" || r.PostFormValue("device_id") != "device-1" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.PostForm)
+		}
+		if r.PostFormValue("site_id") == "site-2" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status_code":500,"message":"Internal server error","data":"device-1 cannot be found in huadong table"}`))
+			return
+		}
+		w.Write([]byte(`{"status_code":200,"message":"OK","data":""}`))
+	}))
+	defer server.Close()
+	c := New(server.URL)
+
+	if err := c.Logout(context.Background(), &Device{ZoneId: "huadong", SiteId: "site-1", DeviceId: "device-1"}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Logout(context.Background(), &Device{ZoneId: "huadong", SiteId: "site-2", DeviceId: "device-1"})
+	if !errors.Is(err, client.ErrInternal) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Package decision 定义 predict 写入、manager 解释的决策记录格式，以及站点缺少的实例数的计算过程。
+package decision
+
+import (
+	"fmt"
+	"math"
+)
+
+// Step 是计算过程中的一步，Description 说明该步的计算方式。
+type Step struct {
+	Description string  `json:"description"`
+	Value       float64 `json:"value"`
+}
+
+// Detail 是决策记录的 detail 字段，manager 的 /decisions/{id}/explain 按该格式解析。
+type Detail struct {
+	Inputs map[string]interface{} `json:"inputs"`
+	Steps  []Step                 `json:"steps"`
+}
+
+// Calculation 记录一个站点某个规格缺少的实例数的计算过程。
+type Calculation struct {
+	Forecast               float64 `json:"forecast"`
+	Maintenance            string  `json:"maintenance,omitempty"` // 维护窗口的原因，站点处于维护窗口时容量视为 0
+	SiteCapacity           int32   `json:"site_capacity"`
+	SiteUsingInstances     int32   `json:"site_using_instances"`
+	SiteCordonedUsing      int32   `json:"site_cordoned_using"`
+	CenterUsingInstances   int32   `json:"center_using_instances"`
+	UnallocatedInstances   int32   `json:"unallocated_instances"`
+	SiteAvailableInstances int32   `json:"site_available_instances"`
+	Missing                int32   `json:"missing"`
+}
+
+// Compute 根据查询到的输入计算缺少的实例数。
+func (c *Calculation) Compute() {
+	if c.Maintenance != "" {
+		// 维护窗口中站点没有可用容量，站点上正在使用的实例也要迁移到中心，中心需要承担预测值和这些实例中较大的一方。
+		c.SiteAvailableInstances = 0
+		c.UnallocatedInstances = max(int32(math.Ceil(c.Forecast)), c.SiteUsingInstances) - c.CenterUsingInstances
+		c.Missing = max(c.UnallocatedInstances, 0)
+		return
+	}
+	// 预计还缺少的资源的实例有多少。
+	c.UnallocatedInstances = int32(c.Forecast - float64(c.SiteUsingInstances+c.CenterUsingInstances))
+	// 边缘站点还有多少容量可以利用。
+	c.SiteAvailableInstances = c.SiteCapacity - (c.SiteUsingInstances - c.SiteCordonedUsing)
+	// 只有当预测到实例增加，且边缘站点空闲实例数不足以支撑时，才需要额外的弹性实例。
+	c.Missing = 0
+	if c.UnallocatedInstances >= 0 && c.SiteAvailableInstances < c.UnallocatedInstances {
+		c.Missing = c.UnallocatedInstances - c.SiteAvailableInstances
+	}
+}
+
+// Steps 按计算顺序返回每一步及其结果。
+func (c *Calculation) Steps() []Step {
+	if c.Maintenance != "" {
+		return []Step{
+			{fmt.Sprintf("site capacity = 0 during maintenance: %s", c.Maintenance), 0},
+			{fmt.Sprintf("unallocated = max(ceil(forecast %.2f), site using %d) - center using %d", c.Forecast, c.SiteUsingInstances, c.CenterUsingInstances), float64(c.UnallocatedInstances)},
+			{fmt.Sprintf("missing = max(unallocated %d, 0)", c.UnallocatedInstances), float64(c.Missing)},
+		}
+	}
+	return []Step{
+		{fmt.Sprintf("unallocated = int(forecast %.2f - site using %d - center using %d)", c.Forecast, c.SiteUsingInstances, c.CenterUsingInstances), float64(c.UnallocatedInstances)},
+		{fmt.Sprintf("site available = site capacity %d - (site using %d - cordoned using %d)", c.SiteCapacity, c.SiteUsingInstances, c.SiteCordonedUsing), float64(c.SiteAvailableInstances)},
+		{fmt.Sprintf("missing = unallocated %d > site available %d ? unallocated - site available : 0", c.UnallocatedInstances, c.SiteAvailableInstances), float64(c.Missing)},
+	}
+}
@@ -0,0 +1,68 @@
+package decision
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCalculationSteps(t *testing.T) {
+	c := &Calculation{Forecast: 9.6, SiteCapacity: 4, SiteUsingInstances: 3, SiteCordonedUsing: 1, CenterUsingInstances: 2}
+	c.Compute()
+	steps := c.Steps()
+	if len(steps) != 3 {
+		t.Fatalf("unexpected steps %+v", steps)
+	}
+	want := []Step{
+		{"unallocated = int(forecast 9.60 - site using 3 - center using 2)", 4},
+		{"site available = site capacity 4 - (site using 3 - cordoned using 1)", 2},
+		{"missing = unallocated 4 > site available 2 ? unallocated - site available : 0", 2},
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("step %d = %+v, want %+v", i, steps[i], want[i])
+		}
+	}
+
+	// 维护窗口中的站点先说明容量为 0。
+	c = &Calculation{Forecast: 2.5, Maintenance: "upgrade", SiteUsingInstances: 1}
+	c.Compute()
+	steps = c.Steps()
+	if len(steps) != 3 || !strings.Contains(steps[0].Description, "upgrade") || steps[0].Value != 0 || steps[2].Value != 3 {
+		t.Errorf("unexpected steps %+v", steps)
+	}
+}
+
+func TestCalculationCompute(t *testing.T) {
+	cases := []struct {
+		name    string
+		c       Calculation
+		missing int32
+	}{
+		{"site has room", Calculation{Forecast: 5, SiteCapacity: 4, SiteUsingInstances: 2, CenterUsingInstances: 1}, 0},
+		{"site is full", Calculation{Forecast: 9.6, SiteCapacity: 4, SiteUsingInstances: 3, SiteCordonedUsing: 1, CenterUsingInstances: 2}, 2},
+		{"forecast drops", Calculation{Forecast: 1, SiteCapacity: 0, SiteUsingInstances: 3, CenterUsingInstances: 2}, 0},
+		{"maintenance forecast", Calculation{Forecast: 4.2, Maintenance: "upgrade", SiteUsingInstances: 2, CenterUsingInstances: 1}, 4},
+		{"maintenance site using", Calculation{Forecast: 1, Maintenance: "upgrade", SiteUsingInstances: 3, CenterUsingInstances: 1}, 2},
+		{"maintenance center covers", Calculation{Forecast: 2, Maintenance: "upgrade", SiteUsingInstances: 1, CenterUsingInstances: 5}, 0},
+	}
+	for _, tc := range cases {
+		c := tc.c
+		c.Missing = -1
+		c.Compute()
+		if c.Missing != tc.missing {
+			t.Errorf("%s: missing = %d, want %d", tc.name, c.Missing, tc.missing)
+		}
+	}
+}
+
+func TestDetailFormat(t *testing.T) {
+	// manager 按 predict 写入的 JSON 格式解析 detail。
+	data, err := json.Marshal(&Detail{Inputs: map[string]interface{}{"sites": 2}, Steps: []Step{{"forecast = max(predictions)", 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"inputs":{"sites":2},"steps":[{"description":"forecast = max(predictions)","value":3}]}` {
+		t.Errorf("unexpected detail %s", data)
+	}
+}
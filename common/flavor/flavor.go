@@ -0,0 +1,58 @@
+// Package flavor 读取实例规格配置中的规格名称。manager、predict 和 usercenter 使用同一个配置文件，
+// 规格集合以配置为准，不从实例表中推断。
+package flavor
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+const Default = "default" // 默认规格，未指定规格的请求都使用该规格
+
+type config struct {
+	Flavors []struct {
+		Name string `yaml:"name"`
+	} `yaml:"flavors"`
+}
+
+// LoadNames 返回配置文件 path 中的规格名称，结果总是以默认规格开头；path 为空时只有默认规格。
+func LoadNames(path string) ([]string, error) {
+	names := []string{Default}
+	if path == "" {
+		return names, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading flavor config %s: %w", path, err)
+	}
+	var conf config
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("error parsing flavor config %s: %w", path, err)
+	}
+
+	seen := map[string]bool{Default: true}
+	for _, flavor := range conf.Flavors {
+		if flavor.Name == "" {
+			return nil, fmt.Errorf("flavor name cannot be empty")
+		}
+		if seen[flavor.Name] {
+			continue
+		}
+		seen[flavor.Name] = true
+		names = append(names, flavor.Name)
+	}
+	return names, nil
+}
+
+// Contains 判断 name 是否在规格列表中。
+func Contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package flavor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadNames(t *testing.T) {
+	names, err := LoadNames("")
+	if err != nil || !reflect.DeepEqual(names, []string{Default}) {
+		t.Fatalf("names = %v, err = %v", names, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "flavors.yaml")
+	data := "flavors:\n  - name: default\n    image: cloudgame:latest\n  - name: gpu-1080p\n    resources:\n      limits:\n        cpu: \"2\"\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	names, err = LoadNames(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{Default, "gpu-1080p"}) {
+		t.Errorf("names = %v", names)
+	}
+	if !Contains(names, "gpu-1080p") || Contains(names, "gpu-4k") {
+		t.Errorf("Contains does not match %v", names)
+	}
+
+	if err := os.WriteFile(path, []byte("flavors:\n  - image: cloudgame:latest\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadNames(path); err == nil {
+		t.Error("expected an error for a flavor without a name")
+	}
+}
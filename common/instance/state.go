@@ -0,0 +1,137 @@
+// Package instance 是实例状态机，各服务修改实例表的 status 列时都通过它进行。
+// 每次变更只在实例当前状态与预期一致时生效（compare-and-set），并写入 instance_state_history 表。
+package instance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// State 是实例的状态，对应实例表的 status 列。
+type State string
+
+const (
+	Provisioning State = "provisioning" // 实例正在创建，还不能分配给终端
+	Available    State = "available"    // 实例可以分配给终端
+	Reserved     State = "reserved"     // 实例已经为某个终端预留，还没有接入
+	Using        State = "using"        // 终端正在使用实例
+	Draining     State = "draining"     // 实例上的终端正在迁移，迁移完成前不分配给新的终端
+	Quarantined  State = "quarantined"  // 实例健康检查失败被隔离，恢复前不分配给终端
+	Terminating  State = "terminating"  // 实例正在回收
+)
+
+// States 是所有合法的状态。
+var States = []State{Provisioning, Available, Reserved, Using, Draining, Quarantined, Terminating}
+
+// transitions 是每个状态可以变更到的状态。
+var transitions = map[State][]State{
+	Provisioning: {Available, Terminating},
+	Available:    {Reserved, Using, Draining, Quarantined, Terminating},
+	Reserved:     {Using, Available},
+	Using:        {Available, Draining},
+	Draining:     {Available, Terminating},
+	Quarantined:  {Available, Terminating},
+	// 回收失败时实例重新变为可用。
+	Terminating: {Available},
+}
+
+// ErrIllegalTransition 表示状态机不允许的变更。
+var ErrIllegalTransition = errors.New("illegal state transition")
+
+// ErrConflict 表示实例的当前状态与预期不一致，或者实例不存在。
+var ErrConflict = errors.New("instance state conflict")
+
+// Parse 解析状态，忽略首尾空白，不是合法状态时返回错误。
+func Parse(s string) (State, error) {
+	state := State(strings.TrimSpace(s))
+	if !state.Valid() {
+		return "", fmt.Errorf("invalid instance state %q", s)
+	}
+	return state, nil
+}
+
+func (s State) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+func (s State) String() string {
+	return string(s)
+}
+
+// CanTransition 返回状态机是否允许从 from 变更到 to。
+func CanTransition(from State, to State) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Column 是状态变更时同时更新的列。
+type Column struct {
+	Name  string
+	Value interface{}
+}
+
+// Change 是一次状态变更，Reason 说明变更的原因，Columns 为同时更新的其他列。
+type Change struct {
+	ZoneId     string
+	InstanceId string
+	From       State
+	To         State
+	Reason     string
+	Columns    []Column
+}
+
+// Apply 在事务中执行状态变更并写入历史记录，service 为执行变更的服务。
+func Apply(ctx context.Context, db *sql.DB, service string, c Change) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := ApplyTx(ctx, tx, service, c); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ApplyTx 在已有的事务中执行状态变更并写入历史记录。
+// 不允许的变更返回 ErrIllegalTransition，实例当前状态不是 c.From 时返回 ErrConflict。
+func ApplyTx(ctx context.Context, tx *sql.Tx, service string, c Change) error {
+	if !CanTransition(c.From, c.To) {
+		return fmt.Errorf("%w: %s -> %s of %s", ErrIllegalTransition, c.From, c.To, c.InstanceId)
+	}
+
+	set := []string{"status = ?"}
+	args := []interface{}{c.To}
+	for _, column := range c.Columns {
+		set = append(set, column.Name+" = ?")
+		args = append(args, column.Value)
+	}
+	args = append(args, c.InstanceId, c.From)
+	result, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE instance_%s SET %s WHERE instance_id = ? AND status = ?", c.ZoneId, strings.Join(set, ", ")), args...)
+	if err != nil {
+		return fmt.Errorf("error updating state of %s: %w", c.InstanceId, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %s is not %s", ErrConflict, c.InstanceId, c.From)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO instance_state_history (zone_id, instance_id, from_state, to_state, reason, service, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		c.ZoneId, c.InstanceId, c.From, c.To, c.Reason, service, time.Now().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return fmt.Errorf("error recording state history of %s: %w", c.InstanceId, err)
+	}
+	return nil
+}
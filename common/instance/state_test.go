@@ -0,0 +1,90 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, state := range States {
+		parsed, err := Parse(" " + string(state) + "\n")
+		if err != nil || parsed != state {
+			t.Errorf("Parse(%q) = %q, %v", state, parsed, err)
+		}
+	}
+	for _, s := range []string{"", "Available", "running", "<html>bad gateway</html>"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	legal := [][2]State{
+		{Provisioning, Available},
+		{Available, Using},
+		{Using, Available},
+		{Available, Quarantined},
+		{Quarantined, Available},
+		{Available, Terminating},
+		{Terminating, Available},
+		{Using, Draining},
+		{Draining, Terminating},
+	}
+	for _, tc := range legal {
+		if !CanTransition(tc[0], tc[1]) {
+			t.Errorf("expected %s -> %s to be legal", tc[0], tc[1])
+		}
+	}
+	illegal := [][2]State{
+		{Using, Terminating},
+		{Using, Quarantined},
+		{Terminating, Using},
+		{Quarantined, Using},
+		{Available, Available},
+		{Available, Provisioning},
+		{"", Available},
+		{Available, "running"},
+	}
+	for _, tc := range illegal {
+		if CanTransition(tc[0], tc[1]) {
+			t.Errorf("expected %s -> %s to be illegal", tc[0], tc[1])
+		}
+	}
+}
+
+func TestTransitionsAreValidStates(t *testing.T) {
+	if len(transitions) != len(States) {
+		t.Fatalf("%d states have transitions, want %d", len(transitions), len(States))
+	}
+	for from, next := range transitions {
+		for _, to := range next {
+			if !to.Valid() {
+				t.Errorf("%s -> %s targets an unknown state", from, to)
+			}
+			if to == from {
+				t.Errorf("%s transitions to itself", from)
+			}
+		}
+	}
+}
+
+func TestApplyTxRejectsIllegalTransition(t *testing.T) {
+	// 不允许的变更在访问数据库之前返回。
+	err := ApplyTx(context.Background(), nil, "test", Change{ZoneId: "huadong", InstanceId: "instance-1", From: Using, To: Terminating})
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("expected ErrIllegalTransition, got %v", err)
+	}
+}
+
+func TestZoneFromTable(t *testing.T) {
+	if zoneId, ok := ZoneFromTable("instance_huadong"); !ok || zoneId != "huadong" {
+		t.Errorf("unexpected zone %q, %v", zoneId, ok)
+	}
+	for _, table := range []string{"instance_usage", "instance_state_history", "instances"} {
+		if zoneId, ok := ZoneFromTable(table); ok {
+			t.Errorf("expected %s not to be an instance table, got zone %q", table, zoneId)
+		}
+	}
+}
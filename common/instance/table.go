@@ -0,0 +1,17 @@
+package instance
+
+import "strings"
+
+// 实例表名为 instance_<zone_id>，以 instance_ 开头的其他表不是实例表。
+var nonZoneTables = map[string]bool{
+	"instance_usage":         true,
+	"instance_state_history": true,
+}
+
+// ZoneFromTable 从 SHOW TABLES LIKE 'instance_%' 返回的表名中取出 zone，不是实例表时返回 false。
+func ZoneFromTable(table string) (string, bool) {
+	if nonZoneTables[table] || !strings.HasPrefix(table, "instance_") {
+		return "", false
+	}
+	return strings.TrimPrefix(table, "instance_"), true
+}
@@ -0,0 +1,118 @@
+// Package logging 是各服务共用的结构化日志配置。
+// 日志基于 log/slog 输出，关联 ID 和 zone、site 等字段通过 context 在调用链中传递。
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CorrelationHeader 是在服务之间传递关联 ID 的请求头。
+const CorrelationHeader = "X-Correlation-Id"
+
+// Setup 将默认 logger 设置为带有 service 字段的结构化 logger，标准库 log 的输出也会经过它。
+// level 为 debug、info、warn 或 error，默认为 info；format 为 json 或 text，默认为 json。
+func Setup(service string, level string, format string) error {
+	handler, err := newHandler(os.Stdout, level, format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler).With("service", service))
+	return nil
+}
+
+func newHandler(w io.Writer, level string, format string) (slog.Handler, error) {
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+	}
+	options := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "", "json":
+		return slog.NewJSONHandler(w, options), nil
+	case "text":
+		return slog.NewTextHandler(w, options), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be json or text", format)
+	}
+}
+
+type contextKey struct{}
+
+// fields 是 context 中携带的日志字段。
+type fields struct {
+	correlationId string
+	attrs         []any
+}
+
+func fromContext(ctx context.Context) fields {
+	f, _ := ctx.Value(contextKey{}).(fields)
+	return f
+}
+
+// NewCorrelationID 生成一个新的关联 ID。
+func NewCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithCorrelationID 返回携带关联 ID 的 context。
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	f := fromContext(ctx)
+	f.correlationId = id
+	return context.WithValue(ctx, contextKey{}, f)
+}
+
+// CorrelationID 返回 context 中的关联 ID，没有时为空。
+func CorrelationID(ctx context.Context) string {
+	return fromContext(ctx).correlationId
+}
+
+// With 返回附加了日志字段的 context，args 的格式与 slog.Logger.With 相同。
+func With(ctx context.Context, args ...any) context.Context {
+	f := fromContext(ctx)
+	f.attrs = append(f.attrs[:len(f.attrs):len(f.attrs)], args...)
+	return context.WithValue(ctx, contextKey{}, f)
+}
+
+// FromContext 返回带有 context 中关联 ID、trace ID 和字段的 logger。
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	f := fromContext(ctx)
+	if f.correlationId != "" {
+		logger = logger.With("correlation_id", f.correlationId)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logger = logger.With("trace_id", sc.TraceID().String())
+	}
+	if len(f.attrs) > 0 {
+		logger = logger.With(f.attrs...)
+	}
+	return logger
+}
+
+// Middleware 从请求头读取关联 ID，没有时生成一个新的，并写入请求的 context 和响应头。
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(CorrelationHeader)
+		if id == "" {
+			id = NewCorrelationID()
+		}
+		w.Header().Set(CorrelationHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithCorrelationID(r.Context(), id)))
+	})
+}
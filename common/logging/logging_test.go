@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := newHandler(&buf, "warn", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(handler)
+	logger.Info("dropped")
+	logger.Warn("kept", "zone_id", "huadong")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected a single JSON line, got %q: %v", buf.String(), err)
+	}
+	if line["msg"] != "kept" || line["zone_id"] != "huadong" {
+		t.Errorf("unexpected line %v", line)
+	}
+
+	if _, err := newHandler(&buf, "verbose", "json"); err == nil {
+		t.Error("expected error for invalid level")
+	}
+	if _, err := newHandler(&buf, "", "xml"); err == nil {
+		t.Error("expected error for invalid format")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	handler, _ := newHandler(&buf, "", "json")
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(handler))
+
+	ctx := WithCorrelationID(context.Background(), "abc")
+	ctx = With(ctx, "zone_id", "huadong")
+	siteCtx := With(ctx, "site_id", "site-1")
+	FromContext(siteCtx).Info("hello")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["correlation_id"] != "abc" || line["zone_id"] != "huadong" || line["site_id"] != "site-1" {
+		t.Errorf("unexpected line %v", line)
+	}
+	if len(fromContext(ctx).attrs) != 2 {
+		t.Errorf("parent context was modified: %v", fromContext(ctx).attrs)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var got string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = CorrelationID(r.Context())
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(CorrelationHeader, "abc")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if got != "abc" || recorder.Header().Get(CorrelationHeader) != "abc" {
+		t.Errorf("expected correlation id abc, got %q and header %q", got, recorder.Header().Get(CorrelationHeader))
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got == "" || got != recorder.Header().Get(CorrelationHeader) {
+		t.Errorf("expected a generated correlation id, got %q", got)
+	}
+}
@@ -0,0 +1,239 @@
+// Package openapi 加载服务的 OpenAPI 3 文档，提供 /openapi.json 和按文档校验请求的中间件。
+// 校验失败时返回 400，data 为每个字段的错误，文档中没有定义的接口不做校验。
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// FieldError 是一个字段的校验错误。In 为 query、path、header 或 body，
+// Field 为参数名，或者请求体中以 . 分隔的字段路径，请求体整体的错误 Field 为空。
+type FieldError struct {
+	In      string `json:"in"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Spec struct {
+	doc    *openapi3.T
+	json   []byte
+	router routers.Router
+}
+
+// Load 加载 YAML 或 JSON 格式的文档，文档不合法时返回错误。
+func Load(data []byte) (*Spec, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("error loading openapi document: %w", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error building openapi router: %w", err)
+	}
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Spec{doc: doc, json: encoded, router: router}, nil
+}
+
+// MustLoad 与 Load 相同，文档不合法时 panic，用于加载内嵌的文档。
+func MustLoad(data []byte) *Spec {
+	spec, err := Load(data)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+// HasOperation 返回文档中是否定义了接口，path 为路由的模板，例如 /operations/{id}。
+func (s *Spec) HasOperation(method string, path string) bool {
+	item := s.doc.Paths.Find(path)
+	return item != nil && item.GetOperation(method) != nil
+}
+
+// ServeHTTP 以 JSON 格式返回文档。
+func (s *Spec) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(s.json)
+}
+
+// Middleware 按文档校验请求的参数和请求体，校验失败时返回 400 和字段错误，不再调用 next。
+func (s *Spec) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if errs := s.Validate(r); len(errs) > 0 {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Add("Access-Control-Allow-Headers", "Content-Type")
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": 400,
+				"message":     "Bad request",
+				"data":        errs,
+			})
+			if err != nil {
+				slog.Error("Failed to encode response", "error", err)
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Validate 校验请求，返回所有字段错误。请求体在校验后可以再次读取。
+func (s *Spec) Validate(r *http.Request) []FieldError {
+	route, pathParams, err := s.router.FindRoute(r)
+	if err != nil {
+		// 文档中没有定义的接口交给路由处理。
+		return nil
+	}
+	// 没有 Content-Type 时按接口唯一接受的格式解析。
+	if body := route.Operation.RequestBody; body != nil && body.Value != nil && len(body.Value.Content) == 1 && r.Header.Get("Content-Type") == "" {
+		for mediaType := range body.Value.Content {
+			r.Header.Set("Content-Type", mediaType)
+		}
+	}
+	err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			MultiError:          true,
+			SkipSettingDefaults: true,
+			AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+		},
+	})
+	if err == nil {
+		return nil
+	}
+	return fieldErrors(err)
+}
+
+func fieldErrors(err error) []FieldError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var errs []FieldError
+		for _, err := range e {
+			errs = append(errs, fieldErrors(err)...)
+		}
+		return errs
+	case *openapi3filter.RequestError:
+		switch {
+		case e.Parameter != nil:
+			return []FieldError{{In: e.Parameter.In, Field: e.Parameter.Name, Message: reason(e.Reason, e.Err)}}
+		case e.RequestBody != nil:
+			errs := bodyErrors(nil, e.Err)
+			if len(errs) == 0 {
+				errs = append(errs, FieldError{In: "body", Message: reason(e.Reason, e.Err)})
+			}
+			return errs
+		}
+	}
+	return []FieldError{{Message: err.Error()}}
+}
+
+// bodyErrors 返回请求体中每个字段的错误，path 为 err 所在的字段路径。
+// allOf 的错误展开为其中各个字段的错误，要求至少提供其中一个字段的 anyOf 和 oneOf 的错误对应到每个可选的字段。
+func bodyErrors(path []string, err error) []FieldError {
+	var errs []FieldError
+	for _, err := range flatten(err) {
+		se, ok := err.(*openapi3.SchemaError)
+		if !ok {
+			continue
+		}
+		field := append(path[:len(path):len(path)], se.JSONPointer()...)
+		if se.SchemaField == "allOf" && se.Origin != nil {
+			if inner := bodyErrors(field, se.Origin); len(inner) > 0 {
+				errs = append(errs, inner...)
+				continue
+			}
+		}
+		if names := alternatives(se); len(names) > 0 {
+			message := "one of " + strings.Join(names, ", ") + " is required"
+			for _, name := range names {
+				errs = append(errs, FieldError{In: "body", Field: strings.Join(append(field[:len(field):len(field)], name), "."), Message: message})
+			}
+			continue
+		}
+		errs = append(errs, FieldError{In: "body", Field: strings.Join(field, "."), Message: schemaReason(se)})
+	}
+	return errs
+}
+
+// alternatives 返回 anyOf 或 oneOf 中可选的字段。只有每个分支都只要求提供某些字段时才返回，其他情况返回 nil。
+func alternatives(se *openapi3.SchemaError) []string {
+	if se.Schema == nil {
+		return nil
+	}
+	var branches openapi3.SchemaRefs
+	switch se.SchemaField {
+	case "anyOf":
+		branches = se.Schema.AnyOf
+	case "oneOf":
+		branches = se.Schema.OneOf
+	default:
+		return nil
+	}
+	var names []string
+	for _, branch := range branches {
+		if branch.Value == nil || len(branch.Value.Required) == 0 || len(branch.Value.Properties) > 0 || branch.Value.Type != nil && len(*branch.Value.Type) > 0 {
+			return nil
+		}
+		names = append(names, branch.Value.Required...)
+	}
+	return names
+}
+
+// flatten 展开嵌套的 MultiError。
+func flatten(err error) []error {
+	me, ok := err.(openapi3.MultiError)
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, err := range me {
+		errs = append(errs, flatten(err)...)
+	}
+	return errs
+}
+
+func reason(reason string, err error) string {
+	var reasons []string
+	for _, err := range flatten(err) {
+		if se, ok := err.(*openapi3.SchemaError); ok {
+			reasons = append(reasons, schemaReason(se))
+		}
+	}
+	if len(reasons) > 0 {
+		return strings.Join(reasons, "; ")
+	}
+	if err == nil {
+		return reason
+	}
+	if reason == "" {
+		return err.Error()
+	}
+	return reason + ": " + err.Error()
+}
+
+// schemaReason 返回不包含文档和值的错误原因。表单中缺少的字段解码为 null，按缺少处理。
+func schemaReason(se *openapi3.SchemaError) string {
+	if se.SchemaField == "nullable" {
+		return "value is required"
+	}
+	return se.Reason
+}
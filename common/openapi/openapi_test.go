@@ -0,0 +1,157 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSpec = `
+openapi: 3.0.3
+info:
+  title: test
+  version: "1"
+paths:
+  /device/login:
+    post:
+      requestBody:
+        required: true
+        content:
+          application/x-www-form-urlencoded:
+            schema:
+              type: object
+              required: [zone_id, device_id]
+              properties:
+                zone_id: {type: string, minLength: 1}
+                device_id: {type: string, minLength: 1}
+      responses:
+        "200": {description: OK}
+  /instance/manage:
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [zone_id]
+              anyOf:
+                - required: [missing]
+                - required: [flavors]
+              properties:
+                zone_id: {type: string, minLength: 1}
+                missing: {type: integer, minimum: 0}
+                flavors:
+                  type: object
+                  additionalProperties: {type: integer, minimum: 0}
+      responses:
+        "202": {description: Accepted}
+  /decisions:
+    get:
+      parameters:
+        - {name: limit, in: query, schema: {type: integer, minimum: 1, maximum: 10000}}
+      responses:
+        "200": {description: OK}
+`
+
+func serve(t *testing.T, r *http.Request) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	var body string
+	handler := MustLoad([]byte(testSpec)).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+			body = r.PostFormValue("device_id")
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, body
+}
+
+func decodeErrors(t *testing.T, w *httptest.ResponseRecorder) []FieldError {
+	t.Helper()
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	var resp struct {
+		StatusCode uint32       `json:"status_code"`
+		Data       []FieldError `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.StatusCode != 400 {
+		t.Fatalf("unexpected response %+v: %v", resp, err)
+	}
+	return resp.Data
+}
+
+func TestHasOperation(t *testing.T) {
+	spec := MustLoad([]byte(testSpec))
+	if !spec.HasOperation(http.MethodPost, "/device/login") || !spec.HasOperation(http.MethodGet, "/decisions") {
+		t.Errorf("expected documented operations")
+	}
+	if spec.HasOperation(http.MethodGet, "/device/login") || spec.HasOperation(http.MethodGet, "/metrics") {
+		t.Errorf("unexpected operations")
+	}
+}
+
+func TestMiddlewarePassesValidRequests(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/device/login", strings.NewReader("zone_id=huadong&device_id=d1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w, body := serve(t, r)
+	if w.Code != http.StatusOK || body != "d1" {
+		t.Errorf("expected the handler to read the form, got %d %q", w.Code, body)
+	}
+
+	// 没有 Content-Type 时按 JSON 校验，请求体可以再次读取。
+	r = httptest.NewRequest(http.MethodPost, "/instance/manage", strings.NewReader(`{"zone_id":"huadong","flavors":{"small":1}}`))
+	w, body = serve(t, r)
+	if w.Code != http.StatusOK || !strings.Contains(body, "huadong") {
+		t.Errorf("expected the handler to read the body, got %d %q", w.Code, body)
+	}
+
+	// 文档中没有的接口不校验。
+	w, _ = serve(t, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected undocumented routes to pass, got %d", w.Code)
+	}
+}
+
+func TestMiddlewareFieldErrors(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/device/login", strings.NewReader("zone_id="))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w, _ := serve(t, r)
+	fields := map[string]bool{}
+	for _, e := range decodeErrors(t, w) {
+		if e.In != "body" || e.Message == "" {
+			t.Errorf("unexpected error %+v", e)
+		}
+		fields[e.Field] = true
+	}
+	if !fields["zone_id"] || !fields["device_id"] {
+		t.Errorf("expected errors for zone_id and device_id, got %v", fields)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/instance/manage", strings.NewReader(`{"zone_id":"huadong","flavors":{"small":-1}}`))
+	r.Header.Set("Content-Type", "application/json")
+	w, _ = serve(t, r)
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Field != "flavors.small" {
+		t.Errorf("unexpected errors %+v", errs)
+	}
+
+	// 缺少 anyOf 中的全部字段时，每个可选的字段都有错误。
+	r = httptest.NewRequest(http.MethodPost, "/instance/manage", strings.NewReader(`{"zone_id":"huadong"}`))
+	w, _ = serve(t, r)
+	errs := decodeErrors(t, w)
+	if len(errs) != 2 || errs[0].Field != "missing" || errs[1].Field != "flavors" || errs[0].Message != "one of missing, flavors is required" {
+		t.Errorf("unexpected errors %+v", errs)
+	}
+
+	w, _ = serve(t, httptest.NewRequest(http.MethodGet, "/decisions?limit=abc", nil))
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].In != "query" || errs[0].Field != "limit" {
+		t.Errorf("unexpected errors %+v", errs)
+	}
+}
@@ -0,0 +1,97 @@
+// Package tracing 是各服务共用的 OpenTelemetry 链路追踪配置。
+// 服务之间通过 W3C traceparent 请求头传递链路上下文。
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"   // 不导出，只传递链路上下文
+	ExporterOTLP   = "otlp"   // 通过 OTLP/HTTP 导出，地址等参数使用 OTEL_EXPORTER_OTLP_* 环境变量
+	ExporterStdout = "stdout" // 输出到标准输出，用于本地调试
+	ExporterFile   = "file"   // 以 JSON 写入文件，用于离线分析
+)
+
+// Setup 设置全局的 TracerProvider 和传播器，返回的函数用于在退出前导出剩余的 span。
+// exporter 为空时等同于 none；exporter 为 file 时 file 为输出文件路径。
+func Setup(ctx context.Context, service string, exporter string, file string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		spanExporter sdktrace.SpanExporter
+		closeFile    func() error
+		err          error
+	)
+	switch strings.ToLower(exporter) {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New()
+	case ExporterFile:
+		if file == "" {
+			return nil, fmt.Errorf("trace file must be set for the file exporter")
+		}
+		f, openErr := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if openErr != nil {
+			return nil, fmt.Errorf("error opening trace file %s: %w", file, openErr)
+		}
+		closeFile = f.Close
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("invalid trace exporter %q, must be none, otlp, stdout or file", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s trace exporter: %w", exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service)))
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeFile != nil {
+			if closeErr := closeFile(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Tracer 返回指定名称的 tracer，一般使用包路径作为名称。
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// End 结束 span，err 不为空时记录错误并将 span 标记为失败。
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetupFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), "test", ExporterFile, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := Tracer("test").Start(context.Background(), "stage")
+	End(span, errors.New("boom"))
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"Name":"stage"`)) || !bytes.Contains(data, []byte("boom")) {
+		t.Errorf("span not exported: %s", data)
+	}
+}
+
+func TestSetupInvalid(t *testing.T) {
+	if _, err := Setup(context.Background(), "test", "jaeger", ""); err == nil {
+		t.Error("expected error for invalid exporter")
+	}
+	if _, err := Setup(context.Background(), "test", ExporterFile, ""); err == nil {
+		t.Error("expected error for file exporter without path")
+	}
+	shutdown, err := Setup(context.Background(), "test", "", "")
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Errorf("expected no-op setup, got %v", err)
+	}
+}
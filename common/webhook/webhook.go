@@ -0,0 +1,42 @@
+// Package webhook 定义 manager 发送 webhook 时使用的请求头和签名方式，manager 签名，订阅方用同一个密钥校验。
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Dispatcher-Signature" // sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+	TimestampHeader = "X-Dispatcher-Timestamp" // 发送时的 Unix 时间戳（秒）
+	EventHeader     = "X-Dispatcher-Event"
+	DeliveryHeader  = "X-Dispatcher-Delivery"
+)
+
+// Sign 计算 webhook 签名。
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验 webhook 签名，时间戳与当前时间相差超过 tolerance 的请求视为重放。
+func Verify(secret string, timestamp string, signature string, body []byte, tolerance time.Duration) error {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if d := time.Since(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+		return fmt.Errorf("timestamp %s is out of tolerance", timestamp)
+	}
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
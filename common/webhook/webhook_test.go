@@ -0,0 +1,32 @@
+package webhook
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"type":"operation.completed"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := Sign("secret", now, body)
+	if err := Verify("secret", now, signature, body, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// 签名覆盖时间戳和请求体，使用其他密钥也无法通过校验。
+	if err := Verify("other", now, signature, body, time.Minute); err == nil {
+		t.Error("expected a signature mismatch for another secret")
+	}
+	if err := Verify("secret", now, signature, []byte(`{}`), time.Minute); err == nil {
+		t.Error("expected a signature mismatch for another body")
+	}
+
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if err := Verify("secret", stale, Sign("secret", stale, body), body, time.Minute); err == nil {
+		t.Error("expected a stale timestamp to be rejected")
+	}
+	if err := Verify("secret", "abc", signature, body, time.Minute); err == nil {
+		t.Error("expected an invalid timestamp to be rejected")
+	}
+}
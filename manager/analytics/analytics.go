@@ -0,0 +1,146 @@
+// Package analytics 对 bounce 表中每分钟的实际实例数和部署实例数做降采样并计算供需指标。
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Resolutions 是支持的降采样粒度，1m 即原始的每分钟数据。
+var Resolutions = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// ParseResolution 解析降采样粒度，为空时使用 1m。
+func ParseResolution(s string) (time.Duration, error) {
+	if s == "" {
+		return time.Minute, nil
+	}
+	resolution, ok := Resolutions[s]
+	if !ok {
+		return 0, fmt.Errorf("unsupported resolution %q, must be one of 1m, 5m, 1h, 1d", s)
+	}
+	return resolution, nil
+}
+
+// Sample 是一分钟的数据，True 为实际需要的实例数，Pred 为按预测部署的实例数，预测还没有覆盖到该分钟时为 nil。
+type Sample struct {
+	Time time.Time
+	True float64
+	Pred *float64
+}
+
+type Stats struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+// Bucket 是一个降采样区间的统计，Pred 只统计有部署实例数的分钟，没有时为 nil。
+type Bucket struct {
+	Start   time.Time
+	Samples int
+	True    Stats
+	Pred    *Stats
+}
+
+// Summary 是一段时间内的供需指标，只统计有部署实例数的分钟。
+type Summary struct {
+	Minutes int `json:"minutes"`
+	// 部署实例数超过实际需要的部分按分钟累计。
+	OverProvisionedInstanceMinutes float64 `json:"over_provisioned_instance_minutes"`
+	// 部署实例数不足的分钟数，以及不足的部分按分钟累计。
+	UnderProvisionedMinutes         int     `json:"under_provisioned_minutes"`
+	UnderProvisionedInstanceMinutes float64 `json:"under_provisioned_instance_minutes"`
+	// 不足的实例分钟数占实际需要的实例分钟数的比例，即因为实例不足而无法接入的需求比例。
+	BounceRatio float64 `json:"bounce_ratio"`
+}
+
+// bucketStart 返回 t 所在区间的开始时间，按天降采样时以本地时间的零点为界。
+func bucketStart(t time.Time, resolution time.Duration) time.Time {
+	if resolution == 24*time.Hour {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return t.Truncate(resolution)
+}
+
+type accumulator struct {
+	n             int
+	sum, min, max float64
+}
+
+func (a *accumulator) add(v float64) {
+	if a.n == 0 || v < a.min {
+		a.min = v
+	}
+	if a.n == 0 || v > a.max {
+		a.max = v
+	}
+	a.n++
+	a.sum += v
+}
+
+func (a *accumulator) stats() Stats {
+	return Stats{Min: a.min, Avg: a.sum / float64(a.n), Max: a.max}
+}
+
+// Downsample 将按时间排序的每分钟数据按 resolution 分组统计。
+func Downsample(samples []Sample, resolution time.Duration) []Bucket {
+	buckets := []Bucket{}
+	var trueAcc, predAcc accumulator
+	flush := func() {
+		if trueAcc.n == 0 {
+			return
+		}
+		b := &buckets[len(buckets)-1]
+		b.Samples, b.True = trueAcc.n, trueAcc.stats()
+		if predAcc.n > 0 {
+			pred := predAcc.stats()
+			b.Pred = &pred
+		}
+		trueAcc, predAcc = accumulator{}, accumulator{}
+	}
+
+	for _, s := range samples {
+		start := bucketStart(s.Time, resolution)
+		if len(buckets) == 0 || !buckets[len(buckets)-1].Start.Equal(start) {
+			flush()
+			buckets = append(buckets, Bucket{Start: start})
+		}
+		trueAcc.add(s.True)
+		if s.Pred != nil {
+			predAcc.add(*s.Pred)
+		}
+	}
+	flush()
+	return buckets
+}
+
+// Summarize 计算供需指标。
+func Summarize(samples []Sample) Summary {
+	var (
+		summary = Summary{}
+		demand  float64
+	)
+	for _, s := range samples {
+		if s.Pred == nil {
+			continue
+		}
+		summary.Minutes++
+		demand += s.True
+		if diff := *s.Pred - s.True; diff > 0 {
+			summary.OverProvisionedInstanceMinutes += diff
+		} else if diff < 0 {
+			summary.UnderProvisionedMinutes++
+			summary.UnderProvisionedInstanceMinutes += -diff
+		}
+	}
+	if demand > 0 {
+		summary.BounceRatio = math.Round(summary.UnderProvisionedInstanceMinutes/demand*1e6) / 1e6
+	}
+	return summary
+}
@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func pred(v float64) *float64 {
+	return &v
+}
+
+func testSamples() []Sample {
+	start := time.Date(2024, 5, 1, 23, 58, 0, 0, time.Local)
+	return []Sample{
+		{Time: start, True: 10, Pred: pred(12)},
+		{Time: start.Add(time.Minute), True: 14, Pred: pred(12)},
+		{Time: start.Add(2 * time.Minute), True: 8, Pred: pred(12)},
+		{Time: start.Add(3 * time.Minute), True: 6},
+	}
+}
+
+func TestParseResolution(t *testing.T) {
+	if r, err := ParseResolution(""); err != nil || r != time.Minute {
+		t.Fatalf("default resolution = %v, %v", r, err)
+	}
+	if r, err := ParseResolution("1h"); err != nil || r != time.Hour {
+		t.Fatalf("1h resolution = %v, %v", r, err)
+	}
+	if _, err := ParseResolution("2m"); err == nil {
+		t.Fatal("expected error for unsupported resolution")
+	}
+}
+
+func TestDownsampleByDay(t *testing.T) {
+	buckets := Downsample(testSamples(), 24*time.Hour)
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(buckets))
+	}
+
+	first := buckets[0]
+	if first.Start != time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local) || first.Samples != 2 {
+		t.Fatalf("first bucket = %+v", first)
+	}
+	if first.True != (Stats{Min: 10, Avg: 12, Max: 14}) || first.Pred == nil || *first.Pred != (Stats{Min: 12, Avg: 12, Max: 12}) {
+		t.Fatalf("first bucket stats = %+v, %+v", first.True, first.Pred)
+	}
+
+	second := buckets[1]
+	if second.Samples != 2 || second.True != (Stats{Min: 6, Avg: 7, Max: 8}) || *second.Pred != (Stats{Min: 12, Avg: 12, Max: 12}) {
+		t.Fatalf("second bucket = %+v, %+v", second, second.Pred)
+	}
+}
+
+func TestDownsampleWithoutPrediction(t *testing.T) {
+	buckets := Downsample(testSamples()[3:], time.Minute)
+	if len(buckets) != 1 || buckets[0].Pred != nil {
+		t.Fatalf("buckets = %+v", buckets)
+	}
+	if len(Downsample(nil, time.Hour)) != 0 {
+		t.Fatal("expected no buckets for no samples")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summary := Summarize(testSamples())
+	want := Summary{
+		Minutes:                         3,
+		OverProvisionedInstanceMinutes:  6,
+		UnderProvisionedMinutes:         1,
+		UnderProvisionedInstanceMinutes: 2,
+		BounceRatio:                     0.0625,
+	}
+	if summary != want {
+		t.Fatalf("summary = %+v, want %+v", summary, want)
+	}
+}
@@ -0,0 +1,107 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group   = "dispatcher.cloudgame.io"
+	Version = "v1alpha1"
+	Kind    = "ElasticInstancePool"
+)
+
+var (
+	GroupVersion = schema.GroupVersion{Group: Group, Version: Version}
+	// Resource 用于通过 dynamic client 访问 ElasticInstancePool。
+	Resource = GroupVersion.WithResource("elasticinstancepools")
+)
+
+// ElasticInstancePool 描述某个 zone 下某个规格的弹性实例池，
+// manager 会把集群中的弹性实例数量调谐到 spec.replicas。
+type ElasticInstancePool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ElasticInstancePoolSpec   `json:"spec"`
+	Status ElasticInstancePoolStatus `json:"status,omitempty"`
+}
+
+type ElasticInstancePoolSpec struct {
+	ZoneId   string `json:"zoneId"`
+	Flavor   string `json:"flavor"`
+	Replicas int32  `json:"replicas"` // 期望的弹性实例数量
+}
+
+type ElasticInstancePoolStatus struct {
+	Replicas           int32        `json:"replicas"`                     // 集群中实际的弹性实例数量
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"` // 最近一次调谐时的 metadata.generation
+	LastReconcileTime  *metav1.Time `json:"lastReconcileTime,omitempty"`
+	Message            string       `json:"message,omitempty"` // 最近一次调谐失败的原因，成功时为空
+}
+
+type ElasticInstancePoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ElasticInstancePool `json:"items"`
+}
+
+// PoolName 返回 zone 和规格对应的实例池名称。
+func PoolName(zoneId string, flavor string) string {
+	return zoneId + "-" + flavor
+}
+
+func (in *ElasticInstancePool) DeepCopyInto(out *ElasticInstancePool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *ElasticInstancePool) DeepCopy() *ElasticInstancePool {
+	if in == nil {
+		return nil
+	}
+	out := new(ElasticInstancePool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *ElasticInstancePool) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *ElasticInstancePoolStatus) DeepCopyInto(out *ElasticInstancePoolStatus) {
+	*out = *in
+	if in.LastReconcileTime != nil {
+		out.LastReconcileTime = in.LastReconcileTime.DeepCopy()
+	}
+}
+
+func (in *ElasticInstancePoolList) DeepCopyInto(out *ElasticInstancePoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]ElasticInstancePool, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *ElasticInstancePoolList) DeepCopy() *ElasticInstancePoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(ElasticInstancePoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *ElasticInstancePoolList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
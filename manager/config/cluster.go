@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+const DefaultCluster = "default" // 未配置多集群时唯一的目标集群，历史实例都属于该集群
+
+// Cluster 描述一个可以部署弹性实例的目标集群。
+type Cluster struct {
+	Name       string   `json:"name"`
+	Kubeconfig string   `json:"kubeconfig"` // 为空时使用 KUBECONFIG_PATH
+	Capacity   int      `json:"capacity"`   // 该集群弹性实例数量上限，为 0 时不限制
+	Zones      []string `json:"zones"`      // 该集群服务的 zone，为空时服务所有 zone
+	Priority   int      `json:"priority"`   // 成本相同时优先使用 priority 小的集群
+	Cost       float64  `json:"cost"`       // 每个实例的相对成本，扩容优先使用便宜的集群，缩容优先回收贵的集群
+}
+
+// Serves 判断集群是否服务该 zone。
+func (c *Cluster) Serves(zoneId string) bool {
+	if len(c.Zones) == 0 {
+		return true
+	}
+	for _, zone := range c.Zones {
+		if zone == zoneId {
+			return true
+		}
+	}
+	return false
+}
+
+type clusterConfig struct {
+	Clusters []*Cluster `json:"clusters"`
+}
+
+// loadClusters 读取集群配置，未配置时只有一个使用 KUBECONFIG_PATH 的默认集群。
+// 第一个集群为主集群，ElasticInstancePool 等自定义资源保存在主集群中。
+func loadClusters(path string) ([]*Cluster, error) {
+	if path == "" {
+		return []*Cluster{{Name: DefaultCluster, Kubeconfig: K8SCONFIGPATH}}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cluster config %s: %w", path, err)
+	}
+	var conf clusterConfig
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("error parsing cluster config %s: %w", path, err)
+	}
+	if len(conf.Clusters) == 0 {
+		return nil, fmt.Errorf("no cluster is configured in %s", path)
+	}
+
+	names := make(map[string]bool)
+	for _, cluster := range conf.Clusters {
+		if cluster.Name == "" {
+			return nil, fmt.Errorf("cluster name cannot be empty")
+		}
+		if names[cluster.Name] {
+			return nil, fmt.Errorf("duplicate cluster %s", cluster.Name)
+		}
+		names[cluster.Name] = true
+		if cluster.Capacity < 0 {
+			return nil, fmt.Errorf("capacity of cluster %s cannot be negative", cluster.Name)
+		}
+		if cluster.Cost < 0 {
+			return nil, fmt.Errorf("cost of cluster %s cannot be negative", cluster.Name)
+		}
+		if cluster.Kubeconfig == "" {
+			cluster.Kubeconfig = K8SCONFIGPATH
+		}
+	}
+	return conf.Clusters, nil
+}
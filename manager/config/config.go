@@ -1,14 +1,23 @@
 package config
 
 import (
+	"common/logging"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var (
 	MANAGERPORT = "6666" // 资源管理模块服务端口
 
+	LOGLEVEL  string // 日志级别：debug、info、warn、error，默认为 info
+	LOGFORMAT string // 日志格式：json 或 text，默认为 json
+
+	TRACEEXPORTER string // 链路追踪导出方式：none、otlp、stdout 或 file，默认为 none
+	TRACEFILE     string // TRACEEXPORTER 为 file 时的输出文件
+
 	K8SNAMSPACE    string // K8S命名空间
 	K8SCONFIGPATH  string // K8S配置文件地址
 	MYSQLHOST      string // MYSQL服务地址
@@ -19,9 +28,56 @@ var (
 	SCALERATIO     int    // 缩放比例
 	HUADONGTOTAL   int    // 华东实例总数
 	CENTERCAPACITY int    // 弹性实例数量上限
+
+	CLUSTERCONFIGPATH string                               // 多集群配置文件地址，为空时只使用 KUBECONFIG_PATH 对应的集群
+	CLUSTERS          = []*Cluster{{Name: DefaultCluster}} // 目标集群，第一个为主集群
+
+	COSTCONFIGPATH string        // 价格和预算配置文件地址，为空时不计费也不限制预算
+	COST           = emptyCost() // 价格和预算
+
+	FLAVORCONFIGPATH string                                               // 实例规格配置文件地址，为空时只使用默认规格
+	FLAVORS          = map[string]*Flavor{DefaultFlavor: defaultFlavor()} // 实例规格，key 为规格名称
+
+	STANDBYRESIZEENABLED = false // 热备实例是否以较小的 requests 运行、提升时原地调整，集群需要支持原地调整 Pod 资源，默认关闭
+
+	PODTEMPLATEPATH     string // 弹性实例 Pod 模板文件地址，为空时使用内置模板
+	SERVICETEMPLATEPATH string // 弹性实例 Service 模板文件地址，为空时使用内置模板
+
+	POOLCONTROLLERENABLED = false // 是否通过 ElasticInstancePool 自定义资源管理弹性实例，默认关闭
+
+	RECONCILEINTERVAL            = 60      // 后台一致性调谐间隔（秒），为 0 时关闭后台调谐
+	RECONCILESTUCKTIMEOUT        = 300     // Pod 未就绪超过该时间（秒）视为卡住
+	RECONCILEORPHANPODACTION     = "alert" // 集群中有 Pod 但数据库中没有记录时的处理方式：adopt、delete 或 alert
+	RECONCILEORPHANROWACTION     = "alert" // 数据库中有记录但集群中没有 Pod 时的处理方式：delete 或 alert
+	RECONCILEORPHANSERVICEACTION = "alert" // service-* 没有对应 Pod 时的处理方式：delete 或 alert
+	RECONCILESTUCKPODACTION      = "alert" // Pod 长时间未就绪时的处理方式：delete 或 alert
+
+	WEBHOOKMAXATTEMPTS = 5    // webhook 最大投递次数，超过后写入死信表
+	WEBHOOKSECRETKEY   string // 加密数据库中 webhook 订阅密钥的密钥，为空时不能注册订阅，也不投递事件
+
+	IDEMPOTENCYKEYTTL = 24 * time.Hour // /instance/manage 幂等键的保留时间
+
+	SCALEMAXATTEMPTS  = 3               // 单个实例创建或删除的最大尝试次数
+	SCALERETRYBACKOFF = 2 * time.Second // 第一次重试前的等待时间，之后每次翻倍
+
+	MAINTENANCEDRAINNOTICE = 10 * time.Minute // 维护窗口开始前多久通知正在使用边缘实例的终端迁移
+
+	EDGEPROBEINTERVAL         = 30 * time.Second // 边缘固定实例健康检查间隔，为 0 时关闭健康检查
+	EDGEPROBETIMEOUT          = 3 * time.Second  // 单次健康检查请求的超时时间
+	EDGEPROBEFAILURETHRESHOLD = 3                // 连续失败多少次后隔离实例
+	EDGEPROBESUCCESSTHRESHOLD = 3                // 隔离的实例连续成功多少次后恢复
 )
 
-func init() {
+// Load 从环境变量和配置文件读取配置，配置不合法时退出。未调用时各项为默认值，单元测试直接设置需要的配置。
+func Load() {
+	LOGLEVEL = os.Getenv("LOG_LEVEL")
+	LOGFORMAT = os.Getenv("LOG_FORMAT")
+	if err := logging.Setup("manager", LOGLEVEL, LOGFORMAT); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	TRACEEXPORTER = os.Getenv("TRACE_EXPORTER")
+	TRACEFILE = os.Getenv("TRACE_FILE")
+
 	K8SNAMSPACE = os.Getenv("NAMESPACE")
 	if K8SNAMSPACE == "" {
 		log.Fatalf("Failed to get namespace from env")
@@ -78,4 +134,121 @@ func init() {
 	} else if CENTERCAPACITY == 0 {
 		log.Fatal("Number of center capacity in huadong cannot be zero")
 	}
+
+	CLUSTERCONFIGPATH = os.Getenv("CLUSTER_CONFIG_PATH")
+	CLUSTERS, err = loadClusters(CLUSTERCONFIGPATH)
+	if err != nil {
+		log.Fatalf("Failed to load clusters: %v", err)
+	}
+
+	COSTCONFIGPATH = os.Getenv("COST_CONFIG_PATH")
+	COST, err = loadCost(COSTCONFIGPATH)
+	if err != nil {
+		log.Fatalf("Failed to load cost config: %v", err)
+	}
+
+	FLAVORCONFIGPATH = os.Getenv("FLAVOR_CONFIG_PATH")
+	STANDBYRESIZEENABLED = strings.EqualFold(os.Getenv("STANDBY_RESIZE_ENABLED"), "true")
+	FLAVORS, err = loadFlavors(FLAVORCONFIGPATH, STANDBYRESIZEENABLED)
+	if err != nil {
+		log.Fatalf("Failed to load flavors: %v", err)
+	}
+
+	PODTEMPLATEPATH = os.Getenv("POD_TEMPLATE_PATH")
+	SERVICETEMPLATEPATH = os.Getenv("SERVICE_TEMPLATE_PATH")
+
+	POOLCONTROLLERENABLED = strings.EqualFold(os.Getenv("POOL_CONTROLLER_ENABLED"), "true")
+
+	if v := os.Getenv("RECONCILE_INTERVAL"); v != "" {
+		RECONCILEINTERVAL, err = strconv.Atoi(v)
+		if err != nil || RECONCILEINTERVAL < 0 {
+			log.Fatal("Reconcile interval must be a non-negative integer")
+		}
+	}
+	if v := os.Getenv("RECONCILE_STUCK_TIMEOUT"); v != "" {
+		RECONCILESTUCKTIMEOUT, err = strconv.Atoi(v)
+		if err != nil || RECONCILESTUCKTIMEOUT <= 0 {
+			log.Fatal("Reconcile stuck timeout must be a positive integer")
+		}
+	}
+	RECONCILEORPHANPODACTION = getAction("RECONCILE_ORPHAN_POD_ACTION", RECONCILEORPHANPODACTION, "adopt", "delete", "alert")
+	RECONCILEORPHANROWACTION = getAction("RECONCILE_ORPHAN_ROW_ACTION", RECONCILEORPHANROWACTION, "delete", "alert")
+	RECONCILEORPHANSERVICEACTION = getAction("RECONCILE_ORPHAN_SERVICE_ACTION", RECONCILEORPHANSERVICEACTION, "delete", "alert")
+	RECONCILESTUCKPODACTION = getAction("RECONCILE_STUCK_POD_ACTION", RECONCILESTUCKPODACTION, "delete", "alert")
+
+	WEBHOOKSECRETKEY = os.Getenv("WEBHOOK_SECRET_KEY")
+
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		WEBHOOKMAXATTEMPTS, err = strconv.Atoi(v)
+		if err != nil || WEBHOOKMAXATTEMPTS <= 0 {
+			log.Fatal("Webhook max attempts must be a positive integer")
+		}
+	}
+
+	if v := os.Getenv("IDEMPOTENCY_KEY_TTL"); v != "" {
+		IDEMPOTENCYKEYTTL, err = time.ParseDuration(v)
+		if err != nil || IDEMPOTENCYKEYTTL <= 0 {
+			log.Fatal("Idempotency key ttl must be a positive duration")
+		}
+	}
+
+	if v := os.Getenv("SCALE_MAX_ATTEMPTS"); v != "" {
+		SCALEMAXATTEMPTS, err = strconv.Atoi(v)
+		if err != nil || SCALEMAXATTEMPTS <= 0 {
+			log.Fatal("Scale max attempts must be a positive integer")
+		}
+	}
+	if v := os.Getenv("SCALE_RETRY_BACKOFF"); v != "" {
+		SCALERETRYBACKOFF, err = time.ParseDuration(v)
+		if err != nil || SCALERETRYBACKOFF < 0 {
+			log.Fatal("Scale retry backoff must be a non-negative duration")
+		}
+	}
+
+	if v := os.Getenv("MAINTENANCE_DRAIN_NOTICE"); v != "" {
+		MAINTENANCEDRAINNOTICE, err = time.ParseDuration(v)
+		if err != nil || MAINTENANCEDRAINNOTICE < 0 {
+			log.Fatal("Maintenance drain notice must be a non-negative duration")
+		}
+	}
+
+	if v := os.Getenv("EDGE_PROBE_INTERVAL"); v != "" {
+		EDGEPROBEINTERVAL, err = time.ParseDuration(v)
+		if err != nil || EDGEPROBEINTERVAL < 0 {
+			log.Fatal("Edge probe interval must be a non-negative duration")
+		}
+	}
+	if v := os.Getenv("EDGE_PROBE_TIMEOUT"); v != "" {
+		EDGEPROBETIMEOUT, err = time.ParseDuration(v)
+		if err != nil || EDGEPROBETIMEOUT <= 0 {
+			log.Fatal("Edge probe timeout must be a positive duration")
+		}
+	}
+	if v := os.Getenv("EDGE_PROBE_FAILURE_THRESHOLD"); v != "" {
+		EDGEPROBEFAILURETHRESHOLD, err = strconv.Atoi(v)
+		if err != nil || EDGEPROBEFAILURETHRESHOLD <= 0 {
+			log.Fatal("Edge probe failure threshold must be a positive integer")
+		}
+	}
+	if v := os.Getenv("EDGE_PROBE_SUCCESS_THRESHOLD"); v != "" {
+		EDGEPROBESUCCESSTHRESHOLD, err = strconv.Atoi(v)
+		if err != nil || EDGEPROBESUCCESSTHRESHOLD <= 0 {
+			log.Fatal("Edge probe success threshold must be a positive integer")
+		}
+	}
+}
+
+// getAction 从环境变量读取调谐动作，未设置时使用默认值，不在 allowed 中时退出。
+func getAction(key string, defaultAction string, allowed ...string) string {
+	action := strings.ToLower(os.Getenv(key))
+	if action == "" {
+		return defaultAction
+	}
+	for _, a := range allowed {
+		if action == a {
+			return action
+		}
+	}
+	log.Fatalf("Invalid %s %q, must be one of %v", key, action, allowed)
+	return ""
 }
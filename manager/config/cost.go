@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// CostConfig 是弹性实例的价格和预算，价格为每个实例每小时的费用。
+type CostConfig struct {
+	Currency string               `json:"currency"`
+	Prices   map[string]float64   `json:"prices"` // 各规格的价格，对所有 zone 生效
+	Zones    map[string]*ZoneCost `json:"zones"`
+}
+
+// ZoneCost 是某个 zone 的价格和预算，预算为 0 时不限制。
+type ZoneCost struct {
+	Prices        map[string]float64 `json:"prices"` // 覆盖全局的规格价格
+	DailyBudget   float64            `json:"dailyBudget"`
+	MonthlyBudget float64            `json:"monthlyBudget"`
+}
+
+// Price 返回 zone 中某个规格的价格，没有配置时为 0，即不计费。
+func (c *CostConfig) Price(zoneId string, flavor string) float64 {
+	if zone, ok := c.Zones[zoneId]; ok {
+		if price, ok := zone.Prices[flavor]; ok {
+			return price
+		}
+	}
+	return c.Prices[flavor]
+}
+
+// Budget 返回 zone 的日预算和月预算。
+func (c *CostConfig) Budget(zoneId string) (float64, float64) {
+	if zone, ok := c.Zones[zoneId]; ok {
+		return zone.DailyBudget, zone.MonthlyBudget
+	}
+	return 0, 0
+}
+
+// emptyCost 返回不计费也不限制预算的配置。
+func emptyCost() *CostConfig {
+	return &CostConfig{Prices: map[string]float64{}, Zones: map[string]*ZoneCost{}}
+}
+
+func loadCost(path string) (*CostConfig, error) {
+	cost := emptyCost()
+	if path == "" {
+		return cost, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cost config %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, cost); err != nil {
+		return nil, fmt.Errorf("error parsing cost config %s: %w", path, err)
+	}
+	if cost.Prices == nil {
+		cost.Prices = map[string]float64{}
+	}
+	if cost.Zones == nil {
+		cost.Zones = map[string]*ZoneCost{}
+	}
+
+	for flavor, price := range cost.Prices {
+		if price < 0 {
+			return nil, fmt.Errorf("price of flavor %s cannot be negative", flavor)
+		}
+	}
+	for zoneId, zone := range cost.Zones {
+		if zone == nil {
+			return nil, fmt.Errorf("cost of zone %s cannot be empty", zoneId)
+		}
+		for flavor, price := range zone.Prices {
+			if price < 0 {
+				return nil, fmt.Errorf("price of flavor %s in zone %s cannot be negative", flavor, zoneId)
+			}
+		}
+		if zone.DailyBudget < 0 || zone.MonthlyBudget < 0 {
+			return nil, fmt.Errorf("budget of zone %s cannot be negative", zoneId)
+		}
+	}
+	return cost, nil
+}
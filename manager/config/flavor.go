@@ -0,0 +1,176 @@
+package config
+
+import (
+	"common/flavor"
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+const DefaultFlavor = flavor.Default // 默认规格，未指定规格的请求都使用该规格
+
+// Flavor 描述一种弹性实例规格，例如不同的 GPU 档位或分辨率。
+type Flavor struct {
+	Name         string                      `json:"name"`
+	Image        string                      `json:"image"`
+	Capacity     int                         `json:"capacity"` // 该规格弹性实例数量上限，为 0 时只受 CENTERCAPACITY 限制
+	Standby      int                         `json:"standby"`  // 每个 zone 预先创建的热备实例数量，为 0 时不使用热备池
+	NodeSelector map[string]string           `json:"nodeSelector"`
+	Resources    corev1.ResourceRequirements `json:"resources"`
+	Ports        []corev1.ContainerPort      `json:"ports"` // 第一个端口用于健康检查和 NodePort 暴露
+	// StandbyRequests 是热备实例的 cpu 和 memory requests，提升时原地调整为 resources.requests。
+	// 只有开启 STANDBYRESIZEENABLED 时才能配置，未配置时为 resources.requests 的四分之一，requests 与 limits 相同的规格不降低；
+	// 未开启时热备实例按完整规格申请。
+	StandbyRequests corev1.ResourceList `json:"standbyRequests"`
+}
+
+// standbyResources 是可以原地调整的资源，其他资源（例如 GPU）热备时也按完整规格申请。
+var standbyResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+// StandbyResources 返回热备实例的资源配置。
+func (f *Flavor) StandbyResources() corev1.ResourceRequirements {
+	resources := *f.Resources.DeepCopy()
+	for name, quantity := range f.StandbyRequests {
+		resources.Requests[name] = quantity
+	}
+	return resources
+}
+
+// defaultStandbyRequests 将 cpu 和 memory 的 requests 降为四分之一。
+// 原地调整不能改变 Pod 的 QoS 类别，requests 与 limits 完全相同（Guaranteed）的规格保持完整规格。
+func defaultStandbyRequests(resources corev1.ResourceRequirements) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	guaranteed := len(resources.Limits) > 0
+	for _, name := range standbyResources {
+		request, ok := resources.Requests[name]
+		if !ok {
+			continue
+		}
+		if limit, ok := resources.Limits[name]; !ok || limit.Cmp(request) != 0 {
+			guaranteed = false
+		}
+		switch name {
+		case corev1.ResourceCPU:
+			requests[name] = *resource.NewMilliQuantity((request.MilliValue()+3)/4, request.Format)
+		default:
+			requests[name] = *resource.NewQuantity((request.Value()+3)/4, request.Format)
+		}
+	}
+	if guaranteed {
+		return nil
+	}
+	return requests
+}
+
+// validateStandbyRequests 检查热备实例的 requests 只包含 cpu 和 memory，且不超过规格的 requests。
+func validateStandbyRequests(flavor *Flavor) error {
+	for name, quantity := range flavor.StandbyRequests {
+		if name != corev1.ResourceCPU && name != corev1.ResourceMemory {
+			return fmt.Errorf("standby requests of flavor %s can only contain cpu and memory", flavor.Name)
+		}
+		request, ok := flavor.Resources.Requests[name]
+		if !ok || quantity.Sign() <= 0 || quantity.Cmp(request) > 0 {
+			return fmt.Errorf("standby request %s of flavor %s must be positive and no more than its request", name, flavor.Name)
+		}
+	}
+	return nil
+}
+
+type flavorConfig struct {
+	Flavors []*Flavor `json:"flavors"`
+}
+
+// defaultFlavor 与最初写死在 podFactory 中的配置保持一致。
+func defaultFlavor() *Flavor {
+	flavor := &Flavor{
+		Name:  DefaultFlavor,
+		Image: "cloudgame:latest",
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("50m"),
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("25m"),
+				corev1.ResourceMemory: resource.MustParse("32Mi"),
+			},
+		},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "http",
+				ContainerPort: 8080,
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+	}
+	return flavor
+}
+
+// setStandbyRequests 设置热备实例的 requests。集群支持原地调整 Pod 资源并显式开启 resize 时，
+// 热备实例才以较小的 requests 运行，否则按完整规格运行，提升时不需要调整。
+func setStandbyRequests(flavor *Flavor, resize bool) error {
+	if !resize {
+		if flavor.StandbyRequests != nil {
+			return fmt.Errorf("standby requests of flavor %s require STANDBY_RESIZE_ENABLED=true", flavor.Name)
+		}
+		return nil
+	}
+	if flavor.StandbyRequests == nil {
+		flavor.StandbyRequests = defaultStandbyRequests(flavor.Resources)
+		return nil
+	}
+	return validateStandbyRequests(flavor)
+}
+
+func loadFlavors(path string, resize bool) (map[string]*Flavor, error) {
+	flavors := map[string]*Flavor{DefaultFlavor: defaultFlavor()}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading flavor config %s: %w", path, err)
+		}
+		var conf flavorConfig
+		if err := yaml.Unmarshal(data, &conf); err != nil {
+			return nil, fmt.Errorf("error parsing flavor config %s: %w", path, err)
+		}
+
+		for _, flavor := range conf.Flavors {
+			if flavor.Name == "" {
+				return nil, fmt.Errorf("flavor name cannot be empty")
+			}
+			if flavor.Image == "" {
+				return nil, fmt.Errorf("image of flavor %s cannot be empty", flavor.Name)
+			}
+			if len(flavor.Ports) == 0 {
+				return nil, fmt.Errorf("ports of flavor %s cannot be empty", flavor.Name)
+			}
+			if flavor.Capacity < 0 {
+				return nil, fmt.Errorf("capacity of flavor %s cannot be negative", flavor.Name)
+			}
+			if flavor.Standby < 0 {
+				return nil, fmt.Errorf("standby of flavor %s cannot be negative", flavor.Name)
+			}
+			// 配置文件中的同名规格会覆盖默认规格。
+			flavors[flavor.Name] = flavor
+		}
+	}
+
+	for _, flavor := range flavors {
+		if err := setStandbyRequests(flavor, resize); err != nil {
+			return nil, err
+		}
+	}
+	return flavors, nil
+}
+
+// GetFlavor 根据名称获取规格，名称为空时返回默认规格。
+func GetFlavor(name string) (*Flavor, bool) {
+	if name == "" {
+		name = DefaultFlavor
+	}
+	flavor, ok := FLAVORS[name]
+	return flavor, ok
+}
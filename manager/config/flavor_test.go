@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestDefaultStandbyRequests(t *testing.T) {
+	resources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("2"),
+			corev1.ResourceMemory: resource.MustParse("4Gi"),
+			"nvidia.com/gpu":      resource.MustParse("1"),
+		},
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("2Gi"),
+			"nvidia.com/gpu":      resource.MustParse("1"),
+		},
+	}
+	flavor := &Flavor{Name: "gpu", Resources: resources, StandbyRequests: defaultStandbyRequests(resources)}
+	standby := flavor.StandbyResources()
+	if cpu := standby.Requests[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse("250m")) != 0 {
+		t.Errorf("expected cpu request 250m, got %s", cpu.String())
+	}
+	if memory := standby.Requests[corev1.ResourceMemory]; memory.Cmp(resource.MustParse("512Mi")) != 0 {
+		t.Errorf("expected memory request 512Mi, got %s", memory.String())
+	}
+	// GPU 不能原地调整，热备时也完整申请；limits 不变，QoS 类别不变。
+	if gpu := standby.Requests["nvidia.com/gpu"]; gpu.Cmp(resource.MustParse("1")) != 0 {
+		t.Errorf("expected gpu request 1, got %s", gpu.String())
+	}
+	if limit := standby.Limits[corev1.ResourceCPU]; limit.Cmp(resource.MustParse("2")) != 0 {
+		t.Errorf("expected cpu limit 2, got %s", limit.String())
+	}
+	if cpu := flavor.Resources.Requests[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse("1")) != 0 {
+		t.Errorf("flavor requests were modified: %s", cpu.String())
+	}
+
+	guaranteed := corev1.ResourceRequirements{Limits: resources.Requests, Requests: resources.Requests}
+	if requests := defaultStandbyRequests(guaranteed); requests != nil {
+		t.Errorf("expected guaranteed flavors to keep full requests, got %v", requests)
+	}
+}
+
+func TestValidateStandbyRequests(t *testing.T) {
+	resources := corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}}
+	for _, c := range []struct {
+		requests corev1.ResourceList
+		valid    bool
+	}{
+		{corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}, true},
+		{corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}, false},
+		{corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("0")}, false},
+		{corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}, false},
+		{corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")}, false},
+	} {
+		err := validateStandbyRequests(&Flavor{Name: "test", Resources: resources, StandbyRequests: c.requests})
+		if (err == nil) != c.valid {
+			t.Errorf("unexpected result for %v: %v", c.requests, err)
+		}
+	}
+}
+
+func TestLoadFlavorsStandbyRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flavors.yaml")
+	data := `flavors:
+  - name: gpu
+    image: cloudgame-gpu:latest
+    ports:
+      - containerPort: 8080
+    resources:
+      requests:
+        cpu: "1"
+        memory: 2Gi
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 默认不原地调整，热备实例按完整规格申请。
+	flavors, err := loadFlavors(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, flavor := range flavors {
+		if flavor.StandbyRequests != nil {
+			t.Errorf("expected full standby requests for flavor %s, got %v", name, flavor.StandbyRequests)
+		}
+	}
+
+	flavors, err = loadFlavors(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpu := flavors["gpu"].StandbyRequests[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse("250m")) != 0 {
+		t.Errorf("expected cpu standby request 250m, got %s", cpu.String())
+	}
+
+	// 未开启原地调整时不能配置较小的 requests。
+	if err := os.WriteFile(path, []byte(data+"    standbyRequests:\n      cpu: 250m\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadFlavors(path, false); err == nil {
+		t.Error("expected an error for standby requests without in-place resize")
+	}
+	if _, err := loadFlavors(path, true); err != nil {
+		t.Error(err)
+	}
+}
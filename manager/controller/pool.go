@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"manager/api/v1alpha1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Scaler 负责实际创建和删除弹性实例，由 apis 包基于 apply 和 release 实现。
+type Scaler interface {
+	// Current 返回集群中某个 zone 某个规格的弹性实例数量。
+	Current(ctx context.Context, zoneId string, flavor string) (int32, error)
+	// Apply 申请 replica 个弹性实例。
+	Apply(ctx context.Context, zoneId string, flavor string, replica int32) error
+	// Release 回收 replica 个空闲的弹性实例。
+	Release(ctx context.Context, zoneId string, flavor string, replica int32) error
+}
+
+// PoolController 将集群中的弹性实例数量调谐到 ElasticInstancePool 的 spec.replicas。
+// 除了 ElasticInstancePool 变化时触发调谐外，还会按 resyncPeriod 周期性调谐，
+// 因此实例被误删后会自动补齐。
+type PoolController struct {
+	client    dynamic.Interface
+	namespace string
+	scaler    Scaler
+
+	informer cache.SharedIndexInformer
+	queue    workqueue.RateLimitingInterface
+}
+
+func NewPoolController(client dynamic.Interface, namespace string, scaler Scaler, resyncPeriod time.Duration) *PoolController {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod, namespace, nil)
+	c := &PoolController{
+		client:    client,
+		namespace: namespace,
+		scaler:    scaler,
+		informer:  factory.ForResource(v1alpha1.Resource).Informer(),
+		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+
+	enqueue := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			utilruntime.HandleError(err)
+			return
+		}
+		c.queue.Add(key)
+	}
+	_, _ = c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, obj interface{}) { enqueue(obj) },
+	})
+	return c
+}
+
+// Run 启动 informer 和 workers 个调谐协程，直到 ctx 结束。
+func (c *PoolController) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	go c.informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return fmt.Errorf("failed to sync elastic instance pool cache")
+	}
+
+	slog.Info("Elastic instance pool controller started", "workers", workers)
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (c *PoolController) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *PoolController) processNextItem(ctx context.Context) bool {
+	item, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(item)
+
+	key := item.(string)
+	if err := c.Reconcile(ctx, key); err != nil {
+		slog.Error("Failed to reconcile elastic instance pool", "pool", key, "error", err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// Reconcile 对 namespace/name 对应的实例池执行一次调谐。
+func (c *PoolController) Reconcile(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	pool, err := c.getPool(ctx, namespace, name)
+	if apierrors.IsNotFound(err) {
+		// 实例池被删除时不主动回收实例，避免误删正在使用的实例。
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	current, err := c.scaler.Current(ctx, pool.Spec.ZoneId, pool.Spec.Flavor)
+	if err != nil {
+		return fmt.Errorf("error querying current instances: %w", err)
+	}
+
+	var scaleErr error
+	if replica := pool.Spec.Replicas - current; replica > 0 {
+		slog.Info("Applying instances", "pool", key, "zone_id", pool.Spec.ZoneId, "flavor", pool.Spec.Flavor, "desired", pool.Spec.Replicas, "current", current, "replica", replica)
+		scaleErr = c.scaler.Apply(ctx, pool.Spec.ZoneId, pool.Spec.Flavor, replica)
+	} else if replica < 0 {
+		slog.Info("Releasing instances", "pool", key, "zone_id", pool.Spec.ZoneId, "flavor", pool.Spec.Flavor, "desired", pool.Spec.Replicas, "current", current, "replica", -replica)
+		scaleErr = c.scaler.Release(ctx, pool.Spec.ZoneId, pool.Spec.Flavor, -replica)
+	}
+
+	if current, err = c.scaler.Current(ctx, pool.Spec.ZoneId, pool.Spec.Flavor); err != nil {
+		return fmt.Errorf("error querying current instances: %w", err)
+	}
+	now := metav1.Now()
+	pool.Status.Replicas = current
+	pool.Status.ObservedGeneration = pool.Generation
+	pool.Status.LastReconcileTime = &now
+	pool.Status.Message = ""
+	if scaleErr != nil {
+		pool.Status.Message = scaleErr.Error()
+	}
+	if err := c.updateStatus(ctx, pool); err != nil {
+		return fmt.Errorf("error updating status: %w", err)
+	}
+	return scaleErr
+}
+
+// SetDesiredReplicas 设置 zone 下某个规格的期望实例数量，实例池不存在时会自动创建。
+func (c *PoolController) SetDesiredReplicas(ctx context.Context, zoneId string, flavor string, replicas int32) error {
+	if replicas < 0 {
+		replicas = 0
+	}
+	name := v1alpha1.PoolName(zoneId, flavor)
+	pool, err := c.getPool(ctx, c.namespace, name)
+	if apierrors.IsNotFound(err) {
+		pool = &v1alpha1.ElasticInstancePool{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: v1alpha1.GroupVersion.String(),
+				Kind:       v1alpha1.Kind,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: c.namespace,
+				Labels:    map[string]string{"zone_id": zoneId, "flavor": flavor},
+			},
+			Spec: v1alpha1.ElasticInstancePoolSpec{
+				ZoneId:   zoneId,
+				Flavor:   flavor,
+				Replicas: replicas,
+			},
+		}
+		obj, err := toUnstructured(pool)
+		if err != nil {
+			return err
+		}
+		_, err = c.client.Resource(v1alpha1.Resource).Namespace(c.namespace).Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if pool.Spec.Replicas == replicas {
+		return nil
+	}
+	pool.Spec.Replicas = replicas
+	obj, err := toUnstructured(pool)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Resource(v1alpha1.Resource).Namespace(c.namespace).Update(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *PoolController) getPool(ctx context.Context, namespace string, name string) (*v1alpha1.ElasticInstancePool, error) {
+	obj, err := c.client.Resource(v1alpha1.Resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pool := &v1alpha1.ElasticInstancePool{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, pool); err != nil {
+		return nil, fmt.Errorf("error converting elastic instance pool %s: %w", name, err)
+	}
+	return pool, nil
+}
+
+func (c *PoolController) updateStatus(ctx context.Context, pool *v1alpha1.ElasticInstancePool) error {
+	obj, err := toUnstructured(pool)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Resource(v1alpha1.Resource).Namespace(pool.Namespace).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+func toUnstructured(pool *v1alpha1.ElasticInstancePool) (*unstructured.Unstructured, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pool)
+	if err != nil {
+		return nil, fmt.Errorf("error converting elastic instance pool %s: %w", pool.Name, err)
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
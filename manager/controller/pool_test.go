@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"manager/api/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+type fakeScaler struct {
+	current    int32
+	releasable int32 // 可以被回收的空闲实例数量
+	applyErr   error
+}
+
+func (s *fakeScaler) Current(_ context.Context, _ string, _ string) (int32, error) {
+	return s.current, nil
+}
+
+func (s *fakeScaler) Apply(_ context.Context, _ string, _ string, replica int32) error {
+	if s.applyErr != nil {
+		return s.applyErr
+	}
+	s.current += replica
+	return nil
+}
+
+func (s *fakeScaler) Release(_ context.Context, _ string, _ string, replica int32) error {
+	if replica > s.releasable {
+		replica = s.releasable
+	}
+	s.current -= replica
+	s.releasable -= replica
+	return nil
+}
+
+func newTestController(scaler Scaler) *PoolController {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		v1alpha1.Resource: "ElasticInstancePoolList",
+	})
+	return NewPoolController(client, "cloudgame", scaler, time.Minute)
+}
+
+func Test_ReconcileScaleUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	scaler := &fakeScaler{current: 2, releasable: 5}
+	c := newTestController(scaler)
+
+	if err := c.SetDesiredReplicas(ctx, "huadong", "default", 5); err != nil {
+		t.Fatalf("failed to set desired replicas: %v", err)
+	}
+	if err := c.Reconcile(ctx, "cloudgame/huadong-default"); err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	if scaler.current != 5 {
+		t.Errorf("expected 5 instances after scale up, got %d", scaler.current)
+	}
+	pool, err := c.getPool(ctx, "cloudgame", "huadong-default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Status.Replicas != 5 || pool.Status.Message != "" || pool.Status.LastReconcileTime == nil {
+		t.Errorf("unexpected status %+v", pool.Status)
+	}
+
+	if err := c.SetDesiredReplicas(ctx, "huadong", "default", 1); err != nil {
+		t.Fatalf("failed to set desired replicas: %v", err)
+	}
+	if err := c.Reconcile(ctx, "cloudgame/huadong-default"); err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	if scaler.current != 1 {
+		t.Errorf("expected 1 instance after scale down, got %d", scaler.current)
+	}
+}
+
+func Test_ReconcileSelfHealing(t *testing.T) {
+	ctx := context.Background()
+	scaler := &fakeScaler{current: 0}
+	c := newTestController(scaler)
+
+	if err := c.SetDesiredReplicas(ctx, "huadong", "default", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reconcile(ctx, "cloudgame/huadong-default"); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟实例被误删，再次调谐后应该补齐。
+	scaler.current = 1
+	if err := c.Reconcile(ctx, "cloudgame/huadong-default"); err != nil {
+		t.Fatal(err)
+	}
+	if scaler.current != 3 {
+		t.Errorf("expected 3 instances after self healing, got %d", scaler.current)
+	}
+}
+
+func Test_ReconcileRecordsFailure(t *testing.T) {
+	ctx := context.Background()
+	scaler := &fakeScaler{applyErr: errors.New("zone is full")}
+	c := newTestController(scaler)
+
+	if err := c.SetDesiredReplicas(ctx, "huadong", "default", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reconcile(ctx, "cloudgame/huadong-default"); err == nil {
+		t.Fatal("expected reconcile error")
+	}
+	pool, err := c.getPool(ctx, "cloudgame", "huadong-default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Status.Message != "zone is full" {
+		t.Errorf("expected failure message in status, got %q", pool.Status.Message)
+	}
+}
+
+func Test_ReconcileMissingPool(t *testing.T) {
+	c := newTestController(&fakeScaler{})
+	if err := c.Reconcile(context.Background(), "cloudgame/not-exist"); err != nil {
+		t.Errorf("missing pool should be ignored, got %v", err)
+	}
+}
@@ -4,16 +4,27 @@ import (
 	"log"
 	"manager/config"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-var TargetClient *kubernetes.Clientset
-var LocalClient *kubernetes.Clientset
+// Cluster 是一个目标集群及其客户端。
+type Cluster struct {
+	*config.Cluster
+	Client        kubernetes.Interface
+	DynamicClient dynamic.Interface
+}
+
+var Clusters []*Cluster // 所有目标集群，顺序与配置一致，第一个为主集群
 
-func init() {
+var TargetClient kubernetes.Interface
+var TargetDynamicClient dynamic.Interface // 用于访问 ElasticInstancePool 等自定义资源
+var LocalClient kubernetes.Interface
 
+// Connect 按配置创建本集群和各目标集群的客户端，单元测试直接设置 fake 客户端。
+func Connect() {
 	// 从业务集群中获取 config，并创建客户端。
 	c, err := rest.InClusterConfig()
 	if err != nil {
@@ -24,17 +35,36 @@ func init() {
 		log.Fatalf("Error connecting local Kubernetes client: %v", err)
 	}
 
-	// 从环境变量获取目标集群config，并创建客户端
-	c, err = clientcmd.BuildConfigFromFlags("", config.K8SCONFIGPATH)
+	// 为每个目标集群创建客户端
+	for _, clusterConfig := range config.CLUSTERS {
+		cluster, err := newCluster(clusterConfig)
+		if err != nil {
+			log.Fatalf("Error connecting target Kubernetes cluster %s: %v", clusterConfig.Name, err)
+		}
+		Clusters = append(Clusters, cluster)
+	}
+
+	// 主集群
+	TargetClient = Clusters[0].Client
+	TargetDynamicClient = Clusters[0].DynamicClient
+}
+
+func newCluster(clusterConfig *config.Cluster) (*Cluster, error) {
+	c, err := clientcmd.BuildConfigFromFlags("", clusterConfig.Kubeconfig)
 	if err != nil {
-		log.Fatalf("Error creating target Kubernetes config: %v", err)
+		return nil, err
 	}
 	c.QPS = 500    // QPS 参数定义了客户端每秒钟可以发送到 API 服务器的最大请求数。这是一个平均值，客户端会尝试不超过这个速率。
 	c.Burst = 1000 // Burst 参数定义了在短时间内可以发送到 API 服务器的请求的最大数量，即使这会超过 QPS 设置的速率。当突发请求完成后，客户端将降低请求速率以遵守 QPS 的限制。
 
-	TargetClient, err = kubernetes.NewForConfig(c)
+	cluster := &Cluster{Cluster: clusterConfig}
+	cluster.Client, err = kubernetes.NewForConfig(c)
 	if err != nil {
-		log.Fatalf("Error connecting target Kubernetes config: %v", err)
+		return nil, err
 	}
-
+	cluster.DynamicClient, err = dynamic.NewForConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return cluster, nil
 }
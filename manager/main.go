@@ -1,16 +1,21 @@
 package main
 
 import (
+	"common/tracing"
 	"context"
 	"errors"
-	"fmt"
+	"log"
+	"log/slog"
 	"manager/config"
+	"manager/mysql"
 	"manager/server"
+	"manager/server/apis"
 	"os/signal"
 	"syscall"
 	"time"
 
 	k8s_client "manager/k8s-client"
+	mysql_service "manager/mysql/service"
 
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/client-go/tools/leaderelection"
@@ -19,16 +24,58 @@ import (
 )
 
 func main() {
+	config.Load()
+	mysql.Connect()
+	k8s_client.Connect()
+	if err := apis.LoadTemplates(); err != nil {
+		log.Fatalf("Error loading pod and service templates: %v", err)
+	}
+
 	ctx, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	klog.SetSlogLogger(slog.Default())
+
+	shutdownTracing, err := tracing.Setup(ctx, "manager", config.TRACEEXPORTER, config.TRACEFILE)
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("Failed to shut down tracing", "error", err)
+		}
+	}()
 
 	run := func(ctx context.Context) {
+		// 开始服务之前补齐表结构。
+		if err := mysql.EnsureSchema(); err != nil {
+			klog.Fatalf("error ensuring database schema: %v", err)
+		}
+		if err := mysql_service.SealWebhookSecrets(); err != nil {
+			klog.Fatalf("error encrypting webhook secrets: %v", err)
+		}
+		if err := apis.FailOrphanedOperations(); err != nil {
+			klog.Fatalf("error failing orphaned operations: %v", err)
+		}
+
+		if err := apis.StartInformers(ctx); err != nil {
+			klog.Fatalf("error starting informers: %v", err)
+		}
+		apis.StartReconciler(ctx)
+		apis.StartStandbyPool(ctx)
+		apis.StartUsageSync(ctx)
+		apis.StartMaintenanceNotifier(ctx)
+		apis.StartEdgeProber(ctx)
+
+		if config.POOLCONTROLLERENABLED {
+			apis.StartPoolController(ctx)
+		}
+
 		// OnStartedLeading 会传入 ctx，这里的 ctx 是传给 RunOrDie 的 ctx。
 		// http server 应当监听 0.0.0.0。
 		err := errors.New("error")
 		for err != nil {
 			err = server.Serve(ctx, "0.0.0.0", config.MANAGERPORT)
 		}
-		fmt.Printf("server started\n")
+		slog.Info("Server stopped")
 	}
 
 	// 创建分布式锁。
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"log/slog"
+	mysql_service "manager/mysql/service"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "dispatcher_manager"
+
+var (
+	// ScaleDuration 是一次扩容或缩容某种规格实例的耗时。
+	ScaleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scale_duration_seconds",
+		Help:      "Duration of applying or releasing elastic instances of a flavor in a zone.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200},
+	}, []string{"action", "zone", "flavor", "result"})
+
+	// PodReadyDuration 是弹性实例从创建 Pod 到就绪的耗时。
+	PodReadyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pod_ready_duration_seconds",
+		Help:      "Time from creating an elastic pod to the pod being ready.",
+		Buckets:   []float64{1, 2, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"cluster", "flavor"})
+
+	// InstanceFailures 是最终失败的实例创建和回收次数，不包括重试成功的中间失败。
+	InstanceFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "instance_failures_total",
+		Help:      "Number of elastic instances that failed to be applied or released.",
+	}, []string{"action", "zone", "flavor"})
+
+	// EdgeProbes 是边缘固定实例的健康检查次数。
+	EdgeProbes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "edge_probes_total",
+		Help:      "Number of health probes of fixed edge instances.",
+	}, []string{"zone", "site", "result"})
+)
+
+var instancesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "instances"),
+	"Number of instances in the database by zone, flavor, source and status.",
+	[]string{"zone", "flavor", "source", "status"}, nil,
+)
+
+// instanceCollector 在抓取时从数据库统计实例数量，多个副本的结果保持一致。
+type instanceCollector struct{}
+
+func (instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- instancesDesc
+}
+
+func (instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	zones, err := mysql_service.GetZoneListInDB()
+	if err != nil {
+		slog.Error("Failed to get zone list when collecting metrics", "error", err)
+		return
+	}
+	for _, zoneId := range zones {
+		counts, err := mysql_service.CountInstances(zoneId)
+		if err != nil {
+			slog.Error("Failed to count instances when collecting metrics", "zone_id", zoneId, "error", err)
+			continue
+		}
+		for _, count := range counts {
+			source := "edge"
+			if count.IsElastic == 1 {
+				source = "center"
+			}
+			ch <- prometheus.MustNewConstMetric(instancesDesc, prometheus.GaugeValue, float64(count.Count), zoneId, count.Flavor, source, count.Status)
+		}
+	}
+}
+
+func init() {
+	prometheus.MustRegister(instanceCollector{})
+}
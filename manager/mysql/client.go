@@ -3,6 +3,7 @@ package mysql
 import (
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"manager/config"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -10,7 +11,8 @@ import (
 
 var DB *sql.DB
 
-func init() {
+// Connect 按配置连接数据库，单元测试直接替换 DB。
+func Connect() {
 	//构建连接："用户名:密码@tcp(IP:端口)/数据库?charset=utf8"
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8", config.MYSQLUSER, config.MYSQLPASSWORD, config.MYSQLHOST, config.MYSQLPORT, config.MYSQLDATABASE)
 	//打开数据库,前者是驱动名，所以要导入： _ "github.com/go-sql-driver/mysql"
@@ -20,8 +22,8 @@ func init() {
 	DB.SetMaxOpenConns(2000)
 	//验证连接
 	if err := DB.Ping(); err != nil {
-		fmt.Println("open database fail")
+		slog.Error("Failed to open database", "error", err)
 		return
 	}
-	fmt.Println("connect success")
+	slog.Info("Database connected")
 }
@@ -0,0 +1,215 @@
+package mysql
+
+import (
+	"common/instance"
+	"fmt"
+	"log/slog"
+)
+
+// tables 是 manager 自己维护的表，不随 zone 变化。
+var tables = []string{
+	// 扩缩容操作及其中每个实例的进度。
+	`CREATE TABLE IF NOT EXISTS operations (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		zone_id VARCHAR(64) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		request TEXT NOT NULL,
+		result TEXT NULL,
+		message TEXT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		INDEX idx_zone_created (zone_id, created_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS operation_instances (
+		id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		operation_id VARCHAR(64) NOT NULL,
+		flavor VARCHAR(64) NOT NULL,
+		instance_id VARCHAR(255) NOT NULL,
+		pod_name VARCHAR(255) NOT NULL,
+		action VARCHAR(16) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		message TEXT NULL,
+		updated_at DATETIME NOT NULL,
+		UNIQUE KEY uk_operation_instance (operation_id, instance_id),
+		INDEX idx_operation (operation_id)
+	)`,
+	// /instance/manage 的幂等键，过期的键在写入新键时清理。
+	`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		idempotency_key VARCHAR(255) NOT NULL PRIMARY KEY,
+		zone_id VARCHAR(64) NOT NULL,
+		request_hash CHAR(64) NOT NULL,
+		operation_id VARCHAR(64) NOT NULL,
+		created_at DATETIME NOT NULL,
+		INDEX idx_created (created_at)
+	)`,
+	// webhook 订阅，events 为逗号分隔的事件类型，为空时订阅所有事件。
+	`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		url VARCHAR(1024) NOT NULL,
+		secret VARCHAR(1024) NOT NULL,
+		events VARCHAR(1024) NOT NULL,
+		created_at DATETIME NOT NULL
+	)`,
+	// 重试多次仍然投递失败的 webhook 事件。
+	`CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+		id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		subscription_id VARCHAR(64) NOT NULL,
+		url VARCHAR(1024) NOT NULL,
+		event_id VARCHAR(64) NOT NULL,
+		event_type VARCHAR(64) NOT NULL,
+		payload TEXT NOT NULL,
+		attempts INT NOT NULL,
+		last_error TEXT NULL,
+		created_at DATETIME NOT NULL
+	)`,
+	// 弹性实例 Pod 的生命周期，用于累计实例小时数和费用，price 为 Pod 创建时的每小时价格，
+	// last_seen_at 为最后一次看到 Pod 的时间，Pod 在 manager 停止期间被删除时以它作为结束时间。
+	`CREATE TABLE IF NOT EXISTS instance_usage (
+		pod_name VARCHAR(255) NOT NULL PRIMARY KEY,
+		zone_id VARCHAR(64) NOT NULL,
+		flavor VARCHAR(64) NOT NULL,
+		cluster VARCHAR(64) NOT NULL,
+		price DOUBLE NOT NULL,
+		started_at DATETIME NOT NULL,
+		ended_at DATETIME NULL,
+		last_seen_at DATETIME NULL,
+		INDEX idx_zone_started (zone_id, started_at),
+		INDEX idx_ended (ended_at)
+	)`,
+	// predict 每轮预测的决策记录，kind 为 site 时是站点某个规格的缺口计算，为 zone 时是发给 manager 的汇总请求，
+	// 同一轮预测的记录共用 correlation_id，operation_id 为 manager 受理请求后的操作 ID。
+	`CREATE TABLE IF NOT EXISTS decisions (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		zone_id VARCHAR(64) NOT NULL,
+		site_id VARCHAR(255) NOT NULL,
+		flavor VARCHAR(64) NOT NULL,
+		kind VARCHAR(16) NOT NULL,
+		correlation_id VARCHAR(64) NOT NULL,
+		operation_id VARCHAR(64) NULL,
+		forecast DOUBLE NULL,
+		missing INT NOT NULL,
+		detail TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		INDEX idx_zone_created (zone_id, created_at),
+		INDEX idx_correlation (correlation_id)
+	)`,
+	// 边缘站点，cordoned 为 1 时站点上的固定实例不再分配给终端，也不计入站点容量。
+	`CREATE TABLE IF NOT EXISTS sites (
+		zone_id VARCHAR(64) NOT NULL,
+		site_id VARCHAR(255) NOT NULL,
+		description VARCHAR(1024) NOT NULL DEFAULT '',
+		cordoned TINYINT NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (zone_id, site_id)
+	)`,
+	// 维护窗口，site_id 为空时对整个 zone 的边缘站点生效，[starts_at, ends_at) 内站点的固定实例不再分配给终端，
+	// drain_notified_at 为通知终端迁移的时间。
+	`CREATE TABLE IF NOT EXISTS maintenance_windows (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		zone_id VARCHAR(64) NOT NULL,
+		site_id VARCHAR(255) NOT NULL DEFAULT '',
+		starts_at DATETIME NOT NULL,
+		ends_at DATETIME NOT NULL,
+		reason VARCHAR(1024) NOT NULL,
+		drain_notified_at DATETIME NULL,
+		created_at DATETIME NOT NULL,
+		INDEX idx_zone_ends (zone_id, ends_at)
+	)`,
+	// 实例状态的变更历史，由各服务通过 common/instance 写入。
+	`CREATE TABLE IF NOT EXISTS instance_state_history (
+		id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		zone_id VARCHAR(64) NOT NULL,
+		instance_id VARCHAR(255) NOT NULL,
+		from_state VARCHAR(16) NOT NULL,
+		to_state VARCHAR(16) NOT NULL,
+		reason VARCHAR(1024) NOT NULL,
+		service VARCHAR(64) NOT NULL,
+		created_at DATETIME NOT NULL,
+		INDEX idx_instance_created (zone_id, instance_id, created_at)
+	)`,
+}
+
+// EnsureSchema 在启动时补齐各服务依赖的表结构，已存在的表和列不会被修改。
+func EnsureSchema() error {
+	for _, table := range tables {
+		if _, err := DB.Exec(table); err != nil {
+			return fmt.Errorf("error creating table: %w", err)
+		}
+	}
+
+	zones, err := listZones()
+	if err != nil {
+		return fmt.Errorf("error listing zones: %w", err)
+	}
+
+	for _, zoneId := range zones {
+		// 规格列，历史数据均视为默认规格。
+		if err := ensureColumn(fmt.Sprintf("instance_%s", zoneId), "flavor", "VARCHAR(64) NOT NULL DEFAULT 'default'"); err != nil {
+			return err
+		}
+		// 集群列，历史数据均属于默认集群。
+		if err := ensureColumn(fmt.Sprintf("instance_%s", zoneId), "cluster", "VARCHAR(64) NOT NULL DEFAULT 'default'"); err != nil {
+			return err
+		}
+		// 封锁列，封锁的固定实例不再分配给终端，也不计入站点容量。
+		if err := ensureColumn(fmt.Sprintf("instance_%s", zoneId), "cordoned", "TINYINT NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		// 手工写入实例表的固定实例所在的站点补录到站点表。
+		if _, err := DB.Exec(fmt.Sprintf("INSERT IGNORE INTO sites (zone_id, site_id, created_at, updated_at) SELECT DISTINCT ?, site_id, NOW(), NOW() FROM instance_%s WHERE is_elastic = 0", zoneId), zoneId); err != nil {
+			return fmt.Errorf("error registering sites of %s: %w", zoneId, err)
+		}
+		if err := ensureColumn(fmt.Sprintf("record_%s", zoneId), "flavor", "VARCHAR(64) NOT NULL DEFAULT 'default'"); err != nil {
+			return err
+		}
+	}
+	if err := ensureColumn("login_failures", "flavor", "VARCHAR(64) NOT NULL DEFAULT 'default'"); err != nil {
+		return err
+	}
+	if err := ensureColumn("instance_usage", "last_seen_at", "DATETIME NULL"); err != nil {
+		return err
+	}
+	// 订阅密钥加密后比明文长。
+	if _, err := DB.Exec("ALTER TABLE webhook_subscriptions MODIFY secret VARCHAR(1024) NOT NULL"); err != nil {
+		return fmt.Errorf("error widening webhook secret column: %w", err)
+	}
+	return nil
+}
+
+func listZones() ([]string, error) {
+	rows, err := DB.Query("SHOW TABLES LIKE 'instance_%'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var zones []string
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			return nil, err
+		}
+		if zoneId, ok := instance.ZoneFromTable(tableName); ok {
+			zones = append(zones, zoneId)
+		}
+	}
+	return zones, rows.Err()
+}
+
+func ensureColumn(table string, column string, definition string) error {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?", table, column).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("error checking column %s of %s: %w", column, table, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("error adding column %s to %s: %w", column, table, err)
+	}
+	slog.Info("Column added", "table", table, "column", column)
+	return nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"fmt"
+	"manager/mysql"
+	"time"
+)
+
+// SiteInstanceCount 是 zone 中某个站点某种规格、来源和状态的实例数量，弹性实例未接入终端时 SiteId 为 null。
+type SiteInstanceCount struct {
+	SiteId    string `json:"site_id"`
+	Flavor    string `json:"flavor"`
+	IsElastic int    `json:"is_elastic"`
+	Status    string `json:"status"`
+	Count     int    `json:"count"`
+}
+
+// CountInstancesBySite 按站点、规格、是否弹性实例和状态统计 zone 中的实例数量。
+func CountInstancesBySite(zoneId string) ([]SiteInstanceCount, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT site_id, flavor, is_elastic, status, COUNT(*) FROM instance_%s GROUP BY site_id, flavor, is_elastic, status ORDER BY site_id, flavor", zoneId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []SiteInstanceCount{}
+	for rows.Next() {
+		var count SiteInstanceCount
+		if err := rows.Scan(&count.SiteId, &count.Flavor, &count.IsElastic, &count.Status, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// GetSiteList 返回 zone 中有固定实例的边缘站点。
+func GetSiteList(zoneId string) ([]string, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT DISTINCT site_id FROM instance_%s WHERE is_elastic = 0 ORDER BY site_id", zoneId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sites := []string{}
+	for rows.Next() {
+		var siteId string
+		if err := rows.Scan(&siteId); err != nil {
+			return nil, err
+		}
+		sites = append(sites, siteId)
+	}
+	return sites, rows.Err()
+}
+
+// SiteLoginFailures 是一段时间内某个站点的需求量和登录失败次数。
+// 需求量与 predict 的预测口径一致，为每分钟正在使用的实例数与登录失败次数之和的累计。
+type SiteLoginFailures struct {
+	SiteId   string  `json:"site_id"`
+	Demand   int64   `json:"demand"`
+	Failures int64   `json:"failures"`
+	Rate     float64 `json:"rate"`
+}
+
+// GetLoginFailures 按站点统计 [from, to) 内的登录失败率。
+func GetLoginFailures(zoneId string, from time.Time, to time.Time) ([]SiteLoginFailures, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT site_id, SUM(instances + login_failures), SUM(login_failures) FROM record_%s WHERE date >= ? AND date < ? GROUP BY site_id ORDER BY site_id", zoneId),
+		from.Format(timeLayout), to.Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sites := []SiteLoginFailures{}
+	for rows.Next() {
+		var site SiteLoginFailures
+		if err := rows.Scan(&site.SiteId, &site.Demand, &site.Failures); err != nil {
+			return nil, err
+		}
+		if site.Demand > 0 {
+			site.Rate = float64(site.Failures) / float64(site.Demand)
+		}
+		sites = append(sites, site)
+	}
+	return sites, rows.Err()
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"manager/mysql"
+	"strings"
+	"time"
+)
+
+const DecisionKindZone = "zone"
+
+// Decision 是 predict 保存的一条扩缩容决策记录，Detail 为 JSON 格式的输入和计算步骤。
+type Decision struct {
+	Id            string   `json:"id"`
+	ZoneId        string   `json:"zone_id"`
+	SiteId        string   `json:"site_id,omitempty"`
+	Flavor        string   `json:"flavor,omitempty"`
+	Kind          string   `json:"kind"`
+	CorrelationId string   `json:"correlation_id"`
+	OperationId   string   `json:"operation_id,omitempty"`
+	Forecast      *float64 `json:"forecast,omitempty"`
+	Missing       int32    `json:"missing"`
+	Detail        string   `json:"-"`
+	CreatedAt     string   `json:"created_at"`
+}
+
+const decisionColumns = "id, zone_id, site_id, flavor, kind, correlation_id, IFNULL(operation_id, ''), forecast, missing, detail, created_at"
+
+func scanDecision(scan func(dest ...interface{}) error) (*Decision, error) {
+	var (
+		d        Decision
+		forecast sql.NullFloat64
+	)
+	if err := scan(&d.Id, &d.ZoneId, &d.SiteId, &d.Flavor, &d.Kind, &d.CorrelationId, &d.OperationId, &forecast, &d.Missing, &d.Detail, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	if forecast.Valid {
+		d.Forecast = &forecast.Float64
+	}
+	return &d, nil
+}
+
+// ListDecisions 按时间顺序返回 [from, to) 内的决策记录，zoneId 为空时返回所有 zone，最多返回 limit 条。
+func ListDecisions(zoneId string, from time.Time, to time.Time, limit int) ([]*Decision, error) {
+	conditions, args := []string{"created_at >= ?", "created_at < ?"}, []interface{}{from.Format(timeLayout), to.Format(timeLayout)}
+	if zoneId != "" {
+		conditions = append(conditions, "zone_id = ?")
+		args = append(args, zoneId)
+	}
+	args = append(args, limit)
+	return queryDecisions(fmt.Sprintf("SELECT %s FROM decisions WHERE %s ORDER BY created_at, kind DESC, site_id, flavor LIMIT ?", decisionColumns, strings.Join(conditions, " AND ")), args...)
+}
+
+// GetDecision 查询一条决策记录，不存在时返回 nil。
+func GetDecision(id string) (*Decision, error) {
+	d, err := scanDecision(mysql.DB.QueryRow(fmt.Sprintf("SELECT %s FROM decisions WHERE id = ?", decisionColumns), id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying decision %s: %w", id, err)
+	}
+	return d, nil
+}
+
+// ListCycleDecisions 返回同一轮预测中 zone 的所有决策记录。
+func ListCycleDecisions(zoneId string, correlationId string) ([]*Decision, error) {
+	return queryDecisions(fmt.Sprintf("SELECT %s FROM decisions WHERE zone_id = ? AND correlation_id = ? ORDER BY kind DESC, site_id, flavor", decisionColumns), zoneId, correlationId)
+}
+
+func queryDecisions(query string, args ...interface{}) ([]*Decision, error) {
+	rows, err := mysql.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := []*Decision{}
+	for rows.Next() {
+		d, err := scanDecision(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, rows.Err()
+}
+
+// ListRecentDecisions 返回 zone 最近的 limit 条决策记录，新的在前。
+func ListRecentDecisions(zoneId string, limit int) ([]*Decision, error) {
+	return queryDecisions(fmt.Sprintf("SELECT %s FROM decisions WHERE zone_id = ? ORDER BY created_at DESC, kind DESC, site_id, flavor LIMIT ?", decisionColumns), zoneId, limit)
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"manager/mysql"
+	"time"
+)
+
+// IdempotentOperation 是幂等键第一次使用时创建的操作。
+type IdempotentOperation struct {
+	OperationId string
+	RequestHash string
+	Status      string // 操作的状态，操作已经不存在时为空
+}
+
+// InsertOperationWithKey 在同一个事务中保存幂等键和操作。
+// 幂等键已经存在且未过期时，请求内容不同或者 replay 返回 true 时不创建操作，返回该键对应的操作；
+// 否则（例如之前的操作已经失败）创建新的操作并接管该键。
+func InsertOperationWithKey(key string, ttl time.Duration, requestHash string, id string, zoneId string, status string, request string, replay func(*IdempotentOperation) bool) (*IdempotentOperation, error) {
+	tx, err := mysql.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.Exec("DELETE FROM idempotency_keys WHERE created_at < ?", now.Add(-ttl).Format(timeLayout)); err != nil {
+		return nil, fmt.Errorf("error purging expired idempotency keys: %w", err)
+	}
+
+	// 并发的相同请求会阻塞在这里，直到先到的事务提交。
+	result, err := tx.Exec("INSERT IGNORE INTO idempotency_keys (idempotency_key, zone_id, request_hash, operation_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		key, zoneId, requestHash, id, now.Format(timeLayout))
+	if err != nil {
+		return nil, fmt.Errorf("error saving idempotency key %s: %w", key, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		existing := &IdempotentOperation{}
+		err := tx.QueryRow("SELECT k.operation_id, k.request_hash, IFNULL(o.status, '') FROM idempotency_keys k LEFT JOIN operations o ON o.id = k.operation_id WHERE k.idempotency_key = ? FOR UPDATE", key).
+			Scan(&existing.OperationId, &existing.RequestHash, &existing.Status)
+		if err != nil {
+			return nil, fmt.Errorf("error querying idempotency key %s: %w", key, err)
+		}
+		if existing.RequestHash != requestHash || replay(existing) {
+			return existing, nil
+		}
+		if _, err := tx.Exec("UPDATE idempotency_keys SET operation_id = ?, created_at = ? WHERE idempotency_key = ?", id, now.Format(timeLayout), key); err != nil {
+			return nil, fmt.Errorf("error taking over idempotency key %s: %w", key, err)
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO operations (id, zone_id, status, request, result, message, created_at, updated_at) VALUES (?, ?, ?, ?, '', '', ?, ?)",
+		id, zoneId, status, request, now.Format(timeLayout), now.Format(timeLayout)); err != nil {
+		return nil, err
+	}
+	return nil, tx.Commit()
+}
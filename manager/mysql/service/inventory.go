@@ -0,0 +1,234 @@
+package service
+
+import (
+	"common/instance"
+	"database/sql"
+	"fmt"
+	"manager/mysql"
+	"time"
+)
+
+// Site 是 zone 中的一个边缘站点，Instances 为站点上登记的固定实例数。
+type Site struct {
+	ZoneId      string `json:"zone_id"`
+	SiteId      string `json:"site_id"`
+	Description string `json:"description"`
+	Cordoned    bool   `json:"cordoned"`
+	Instances   int    `json:"instances"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// EdgeInstance 是边缘站点上的固定实例。
+type EdgeInstance struct {
+	ZoneId     string         `json:"zone_id"`
+	SiteId     string         `json:"site_id"`
+	InstanceId string         `json:"instance_id"`
+	PodName    string         `json:"pod_name"`
+	ServerIp   string         `json:"server_ip"`
+	Port       int32          `json:"port"`
+	Flavor     string         `json:"flavor"`
+	Status     instance.State `json:"status"`
+	DeviceId   string         `json:"device_id"`
+	Cordoned   bool           `json:"cordoned"`
+}
+
+const siteColumns = "s.zone_id, s.site_id, s.description, s.cordoned, s.created_at, s.updated_at"
+
+func scanSite(scanner interface{ Scan(...interface{}) error }, site *Site) error {
+	return scanner.Scan(&site.ZoneId, &site.SiteId, &site.Description, &site.Cordoned, &site.CreatedAt, &site.UpdatedAt, &site.Instances)
+}
+
+func InsertSite(site *Site) error {
+	now := time.Now().Format(timeLayout)
+	site.CreatedAt, site.UpdatedAt = now, now
+	_, err := mysql.DB.Exec("INSERT INTO sites (zone_id, site_id, description, cordoned, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		site.ZoneId, site.SiteId, site.Description, site.Cordoned, site.CreatedAt, site.UpdatedAt)
+	return err
+}
+
+// GetSite 返回站点及其固定实例数，站点不存在时返回 nil。
+func GetSite(zoneId string, siteId string) (*Site, error) {
+	row := mysql.DB.QueryRow(fmt.Sprintf("SELECT %s, (SELECT COUNT(*) FROM instance_%s i WHERE i.is_elastic = 0 AND i.site_id = s.site_id) FROM sites s WHERE s.zone_id = ? AND s.site_id = ?", siteColumns, zoneId), zoneId, siteId)
+	site := &Site{}
+	if err := scanSite(row, site); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return site, nil
+}
+
+func ListSites(zoneId string) ([]*Site, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT %s, (SELECT COUNT(*) FROM instance_%s i WHERE i.is_elastic = 0 AND i.site_id = s.site_id) FROM sites s WHERE s.zone_id = ? ORDER BY s.site_id", siteColumns, zoneId), zoneId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sites := []*Site{}
+	for rows.Next() {
+		site := &Site{}
+		if err := scanSite(rows, site); err != nil {
+			return nil, err
+		}
+		sites = append(sites, site)
+	}
+	return sites, rows.Err()
+}
+
+func UpdateSiteDescription(zoneId string, siteId string, description string) error {
+	_, err := mysql.DB.Exec("UPDATE sites SET description = ?, updated_at = ? WHERE zone_id = ? AND site_id = ?",
+		description, time.Now().Format(timeLayout), zoneId, siteId)
+	return err
+}
+
+// SetSiteCordoned 封锁或解除封锁站点。
+func SetSiteCordoned(zoneId string, siteId string, cordoned bool) error {
+	_, err := mysql.DB.Exec("UPDATE sites SET cordoned = ?, updated_at = ? WHERE zone_id = ? AND site_id = ?",
+		cordoned, time.Now().Format(timeLayout), zoneId, siteId)
+	return err
+}
+
+// DeleteSite 删除没有固定实例的站点，返回站点是否被删除。
+func DeleteSite(zoneId string, siteId string) (bool, error) {
+	return execAffected(fmt.Sprintf("DELETE FROM sites WHERE zone_id = ? AND site_id = ? AND NOT EXISTS (SELECT 1 FROM instance_%s WHERE is_elastic = 0 AND site_id = ?)", zoneId),
+		zoneId, siteId, siteId)
+}
+
+const edgeInstanceColumns = "site_id, instance_id, pod_name, server_ip, port, flavor, status, device_id, cordoned"
+
+func scanEdgeInstance(scanner interface{ Scan(...interface{}) error }, instance *EdgeInstance) error {
+	return scanner.Scan(&instance.SiteId, &instance.InstanceId, &instance.PodName, &instance.ServerIp, &instance.Port, &instance.Flavor, &instance.Status, &instance.DeviceId, &instance.Cordoned)
+}
+
+// GetEdgeInstance 返回固定实例，实例不存在时返回 nil。
+func GetEdgeInstance(zoneId string, instanceId string) (*EdgeInstance, error) {
+	row := mysql.DB.QueryRow(fmt.Sprintf("SELECT %s FROM instance_%s WHERE is_elastic = 0 AND instance_id = ?", edgeInstanceColumns, zoneId), instanceId)
+	instance := &EdgeInstance{ZoneId: zoneId}
+	if err := scanEdgeInstance(row, instance); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return instance, nil
+}
+
+func ListEdgeInstances(zoneId string, siteId string) ([]*EdgeInstance, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT %s FROM instance_%s WHERE is_elastic = 0 AND site_id = ? ORDER BY instance_id", edgeInstanceColumns, zoneId), siteId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	instances := []*EdgeInstance{}
+	for rows.Next() {
+		instance := &EdgeInstance{ZoneId: zoneId}
+		if err := scanEdgeInstance(rows, instance); err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	return instances, rows.Err()
+}
+
+// GetProbeTargets 返回 zone 中需要健康检查的固定实例，即可用和被隔离的实例，正在使用的实例由终端负责。
+func GetProbeTargets(zoneId string) ([]*EdgeInstance, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT %s FROM instance_%s WHERE is_elastic = 0 AND status IN ('available', 'quarantined')", edgeInstanceColumns, zoneId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	instances := []*EdgeInstance{}
+	for rows.Next() {
+		instance := &EdgeInstance{ZoneId: zoneId}
+		if err := scanEdgeInstance(rows, instance); err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	return instances, rows.Err()
+}
+
+// InstanceExists 返回 zone 中是否已有该 ID 的实例，包括弹性实例。
+func InstanceExists(zoneId string, instanceId string) (bool, error) {
+	var count int
+	err := mysql.DB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM instance_%s WHERE instance_id = ?", zoneId), instanceId).Scan(&count)
+	return count > 0, err
+}
+
+// AddressInUse 返回 zone 中除 instanceId 外是否已有实例使用该地址。
+func AddressInUse(zoneId string, serverIp string, port int32, instanceId string) (bool, error) {
+	var count int
+	err := mysql.DB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM instance_%s WHERE server_ip = ? AND port = ? AND instance_id != ?", zoneId), serverIp, port, instanceId).Scan(&count)
+	return count > 0, err
+}
+
+// InsertEdgeInstance 登记一个可用的固定实例。
+func InsertEdgeInstance(instance *EdgeInstance) error {
+	instance.Status, instance.DeviceId = "available", "null"
+	_, err := mysql.DB.Exec(fmt.Sprintf("INSERT INTO instance_%s (site_id, server_ip, instance_id, pod_name, port, is_elastic, status, device_id, flavor, cordoned) VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?)", instance.ZoneId),
+		instance.SiteId, instance.ServerIp, instance.InstanceId, instance.PodName, instance.Port, instance.Status, instance.DeviceId, instance.Flavor, instance.Cordoned)
+	return err
+}
+
+// UpdateEdgeInstance 更新固定实例的地址和规格，只在实例没有接入终端时更新，返回是否有记录被修改。
+// 各字段都没有变化时也不会修改记录。
+func UpdateEdgeInstance(instance *EdgeInstance) (bool, error) {
+	return execAffected(fmt.Sprintf("UPDATE instance_%s SET server_ip = ?, port = ?, pod_name = ?, flavor = ? WHERE is_elastic = 0 AND instance_id = ? AND NOT (%s)", instance.ZoneId, inSession),
+		instance.ServerIp, instance.Port, instance.PodName, instance.Flavor, instance.InstanceId)
+}
+
+// SetInstanceCordoned 封锁或解除封锁固定实例，已接入的终端不受影响。
+func SetInstanceCordoned(zoneId string, instanceId string, cordoned bool) error {
+	_, err := mysql.DB.Exec(fmt.Sprintf("UPDATE instance_%s SET cordoned = ? WHERE is_elastic = 0 AND instance_id = ?", zoneId), cordoned, instanceId)
+	return err
+}
+
+// DecommissionEdgeInstance 删除没有接入终端的固定实例，返回实例是否被删除。
+func DecommissionEdgeInstance(zoneId string, instanceId string) (bool, error) {
+	return execAffected(fmt.Sprintf("DELETE FROM instance_%s WHERE is_elastic = 0 AND instance_id = ? AND NOT (%s)", zoneId, inSession), instanceId)
+}
+
+func execAffected(query string, args ...interface{}) (bool, error) {
+	result, err := mysql.DB.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// StateChange 是一条实例状态变更记录。
+type StateChange struct {
+	From      instance.State `json:"from"`
+	To        instance.State `json:"to"`
+	Reason    string         `json:"reason"`
+	Service   string         `json:"service"`
+	CreatedAt string         `json:"created_at"`
+}
+
+// GetInstanceHistory 按时间倒序返回实例最近 limit 条状态变更记录。
+func GetInstanceHistory(zoneId string, instanceId string, limit int) ([]StateChange, error) {
+	rows, err := mysql.DB.Query("SELECT from_state, to_state, reason, service, created_at FROM instance_state_history WHERE zone_id = ? AND instance_id = ? ORDER BY id DESC LIMIT ?", zoneId, instanceId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []StateChange{}
+	for rows.Next() {
+		var change StateChange
+		if err := rows.Scan(&change.From, &change.To, &change.Reason, &change.Service, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
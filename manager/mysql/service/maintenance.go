@@ -0,0 +1,189 @@
+package service
+
+import (
+	"common/instance"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"manager/mysql"
+	"time"
+)
+
+// MaintenanceWindow 是边缘站点的维护窗口，SiteId 为空时对整个 zone 的边缘站点生效。
+type MaintenanceWindow struct {
+	Id              string `json:"id"`
+	ZoneId          string `json:"zone_id"`
+	SiteId          string `json:"site_id"`
+	StartsAt        string `json:"starts_at"`
+	EndsAt          string `json:"ends_at"`
+	Reason          string `json:"reason"`
+	DrainNotifiedAt string `json:"drain_notified_at,omitempty"`
+	CreatedAt       string `json:"created_at"`
+}
+
+// Session 是正在使用边缘实例的终端。
+type Session struct {
+	SiteId     string `json:"site_id"`
+	InstanceId string `json:"instance_id"`
+	DeviceId   string `json:"device_id"`
+}
+
+// inSession 筛选接入了终端的实例。迁移中的实例在终端登出之前仍然接入着终端，登出后 device_id 变为 'null'。
+const inSession = "status IN ('using', 'draining') AND device_id != 'null'"
+
+const maintenanceColumns = "id, zone_id, site_id, starts_at, ends_at, reason, drain_notified_at, created_at"
+
+func scanMaintenanceWindow(scanner interface{ Scan(...interface{}) error }, window *MaintenanceWindow) error {
+	var notifiedAt sql.NullString
+	if err := scanner.Scan(&window.Id, &window.ZoneId, &window.SiteId, &window.StartsAt, &window.EndsAt, &window.Reason, &notifiedAt, &window.CreatedAt); err != nil {
+		return err
+	}
+	window.DrainNotifiedAt = notifiedAt.String
+	return nil
+}
+
+func queryMaintenanceWindows(query string, args ...interface{}) ([]*MaintenanceWindow, error) {
+	rows, err := mysql.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []*MaintenanceWindow{}
+	for rows.Next() {
+		window := &MaintenanceWindow{}
+		if err := scanMaintenanceWindow(rows, window); err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, rows.Err()
+}
+
+func InsertMaintenanceWindow(window *MaintenanceWindow) error {
+	window.CreatedAt = time.Now().Format(timeLayout)
+	_, err := mysql.DB.Exec("INSERT INTO maintenance_windows (id, zone_id, site_id, starts_at, ends_at, reason, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		window.Id, window.ZoneId, window.SiteId, window.StartsAt, window.EndsAt, window.Reason, window.CreatedAt)
+	return err
+}
+
+// ListMaintenanceWindows 按开始时间返回 zone 的维护窗口，ended 为 false 时不返回已经结束的窗口。
+func ListMaintenanceWindows(zoneId string, ended bool) ([]*MaintenanceWindow, error) {
+	if ended {
+		return queryMaintenanceWindows(fmt.Sprintf("SELECT %s FROM maintenance_windows WHERE zone_id = ? ORDER BY starts_at", maintenanceColumns), zoneId)
+	}
+	return queryMaintenanceWindows(fmt.Sprintf("SELECT %s FROM maintenance_windows WHERE zone_id = ? AND ends_at > ? ORDER BY starts_at", maintenanceColumns),
+		zoneId, time.Now().Format(timeLayout))
+}
+
+// GetMaintenanceWindow 返回维护窗口，窗口不存在时返回 nil。
+func GetMaintenanceWindow(zoneId string, id string) (*MaintenanceWindow, error) {
+	row := mysql.DB.QueryRow(fmt.Sprintf("SELECT %s FROM maintenance_windows WHERE zone_id = ? AND id = ?", maintenanceColumns), zoneId, id)
+	window := &MaintenanceWindow{}
+	if err := scanMaintenanceWindow(row, window); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return window, nil
+}
+
+// DeleteMaintenanceWindow 取消维护窗口，返回窗口是否存在。
+func DeleteMaintenanceWindow(zoneId string, id string) (bool, error) {
+	return execAffected("DELETE FROM maintenance_windows WHERE zone_id = ? AND id = ?", zoneId, id)
+}
+
+// GetPendingDrainNotices 返回在 before 之前开始、还没有结束且还没有通知终端迁移的维护窗口。
+func GetPendingDrainNotices(before time.Time) ([]*MaintenanceWindow, error) {
+	return queryMaintenanceWindows(fmt.Sprintf("SELECT %s FROM maintenance_windows WHERE drain_notified_at IS NULL AND starts_at <= ? AND ends_at > ? ORDER BY starts_at", maintenanceColumns),
+		before.Format(timeLayout), time.Now().Format(timeLayout))
+}
+
+func SetDrainNotified(id string, notifiedAt time.Time) error {
+	_, err := mysql.DB.Exec("UPDATE maintenance_windows SET drain_notified_at = ? WHERE id = ?", notifiedAt.Format(timeLayout), id)
+	return err
+}
+
+// GetEdgeSessions 返回 zone 中正在使用边缘实例的终端，siteId 为空时返回所有站点。
+func GetEdgeSessions(zoneId string, siteId string) ([]Session, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT site_id, instance_id, device_id FROM instance_%s WHERE is_elastic = 0 AND %s AND (? = '' OR site_id = ?) ORDER BY site_id, instance_id", zoneId, inSession), siteId, siteId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.SiteId, &session.InstanceId, &session.DeviceId); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// DrainEdgeInstances 将站点中可用和正在使用的固定实例改为 draining，siteId 为空时修改所有站点，返回修改的实例个数。
+// 状态已经被其他服务修改的实例跳过。
+func DrainEdgeInstances(zoneId string, siteId string, reason string) (int, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT instance_id, status FROM instance_%s WHERE is_elastic = 0 AND status IN ('available', 'using') AND (? = '' OR site_id = ?)", zoneId), siteId, siteId)
+	if err != nil {
+		return 0, err
+	}
+	changes := []instance.Change{}
+	for rows.Next() {
+		c := instance.Change{ZoneId: zoneId, To: instance.Draining, Reason: reason}
+		if err := rows.Scan(&c.InstanceId, &c.From); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		changes = append(changes, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return applyChanges(changes)
+}
+
+// RestoreDrainedInstances 将 zone 中已经没有终端、且不在已通知迁移的维护窗口内的固定实例从 draining 恢复为 available，
+// 返回恢复的实例个数。维护窗口结束或被取消后，站点的实例由此恢复分配。
+func RestoreDrainedInstances(zoneId string) (int, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf(`SELECT instance_id FROM instance_%s i WHERE is_elastic = 0 AND status = 'draining' AND device_id = 'null'
+		AND NOT EXISTS (SELECT 1 FROM maintenance_windows m WHERE m.zone_id = ? AND (m.site_id = '' OR m.site_id = i.site_id) AND m.drain_notified_at IS NOT NULL AND m.ends_at > ?)`, zoneId),
+		zoneId, time.Now().Format(timeLayout))
+	if err != nil {
+		return 0, err
+	}
+	changes := []instance.Change{}
+	for rows.Next() {
+		c := instance.Change{ZoneId: zoneId, From: instance.Draining, To: instance.Available, Reason: "maintenance ended"}
+		if err := rows.Scan(&c.InstanceId); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		changes = append(changes, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return applyChanges(changes)
+}
+
+func applyChanges(changes []instance.Change) (int, error) {
+	applied := 0
+	for _, c := range changes {
+		err := instance.Apply(context.Background(), mysql.DB, serviceName, c)
+		if errors.Is(err, instance.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
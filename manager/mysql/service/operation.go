@@ -0,0 +1,112 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"manager/mysql"
+	"time"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+type Operation struct {
+	Id        string              `json:"id"`
+	ZoneId    string              `json:"zone_id"`
+	Status    string              `json:"status"`
+	Request   string              `json:"request"`
+	Result    string              `json:"result"`
+	Message   string              `json:"message"`
+	CreatedAt string              `json:"created_at"`
+	UpdatedAt string              `json:"updated_at"`
+	Instances []OperationInstance `json:"instances"`
+}
+
+type OperationInstance struct {
+	Flavor     string `json:"flavor"`
+	InstanceId string `json:"instance_id"`
+	PodName    string `json:"pod_name"`
+	Action     string `json:"action"`
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+func InsertOperation(id string, zoneId string, status string, request string) error {
+	now := time.Now().Format(timeLayout)
+	_, err := mysql.DB.Exec("INSERT INTO operations (id, zone_id, status, request, result, message, created_at, updated_at) VALUES (?, ?, ?, ?, '', '', ?, ?)", id, zoneId, status, request, now, now)
+	return err
+}
+
+func UpdateOperation(id string, status string, result string, message string) error {
+	_, err := mysql.DB.Exec("UPDATE operations SET status = ?, result = ?, message = ?, updated_at = ? WHERE id = ?", status, result, message, time.Now().Format(timeLayout), id)
+	return err
+}
+
+// UpsertOperationInstance 记录操作中某个实例的最新进度。
+func UpsertOperationInstance(operationId string, instance *OperationInstance) error {
+	_, err := mysql.DB.Exec("INSERT INTO operation_instances (operation_id, flavor, instance_id, pod_name, action, status, message, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE status = VALUES(status), message = VALUES(message), updated_at = VALUES(updated_at)",
+		operationId, instance.Flavor, instance.InstanceId, instance.PodName, instance.Action, instance.Status, instance.Message, time.Now().Format(timeLayout))
+	return err
+}
+
+// GetOperation 查询操作及其中每个实例的进度，操作不存在时返回 nil。
+func GetOperation(id string) (*Operation, error) {
+	operation := &Operation{Instances: []OperationInstance{}}
+	err := mysql.DB.QueryRow("SELECT id, zone_id, status, request, IFNULL(result, ''), IFNULL(message, ''), created_at, updated_at FROM operations WHERE id = ?", id).
+		Scan(&operation.Id, &operation.ZoneId, &operation.Status, &operation.Request, &operation.Result, &operation.Message, &operation.CreatedAt, &operation.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying operation %s: %w", id, err)
+	}
+
+	rows, err := mysql.DB.Query("SELECT flavor, instance_id, pod_name, action, status, IFNULL(message, ''), updated_at FROM operation_instances WHERE operation_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, fmt.Errorf("error querying instances of operation %s: %w", id, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var instance OperationInstance
+		if err := rows.Scan(&instance.Flavor, &instance.InstanceId, &instance.PodName, &instance.Action, &instance.Status, &instance.Message, &instance.UpdatedAt); err != nil {
+			return nil, err
+		}
+		operation.Instances = append(operation.Instances, instance)
+	}
+	return operation, rows.Err()
+}
+
+// FailUnfinishedOperations 将所有 pending 和 running 的操作标记为 failed，返回被标记的操作。
+func FailUnfinishedOperations(message string) ([]*Operation, error) {
+	tx, err := mysql.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, zone_id FROM operations WHERE status IN ('pending', 'running') FOR UPDATE")
+	if err != nil {
+		return nil, fmt.Errorf("error querying unfinished operations: %w", err)
+	}
+	var operations []*Operation
+	for rows.Next() {
+		operation := &Operation{}
+		if err := rows.Scan(&operation.Id, &operation.ZoneId); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(operations) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec("UPDATE operations SET status = 'failed', message = ?, updated_at = ? WHERE status IN ('pending', 'running')",
+		message, time.Now().Format(timeLayout)); err != nil {
+		return nil, fmt.Errorf("error failing unfinished operations: %w", err)
+	}
+	return operations, tx.Commit()
+}
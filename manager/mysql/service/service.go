@@ -1,91 +1,178 @@
 package service
 
 import (
+	"common/instance"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"manager/mysql"
+	"strings"
 )
 
-func InsertInstance(zoneId string, siteId string, serverIp string, instanceId string, podName string, port int32, is_elastic int, status string, device_id string) error {
-	query := fmt.Sprintf("INSERT INTO instance_%s (site_id, server_ip, instance_id, pod_name, port, is_elastic, status, device_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", zoneId)
+// serviceName 是写入实例状态历史时记录的服务名。
+const serviceName = "manager"
+
+func InsertInstance(zoneId string, siteId string, serverIp string, instanceId string, podName string, port int32, is_elastic int, status instance.State, device_id string, flavor string, cluster string) error {
+	query := fmt.Sprintf("INSERT INTO instance_%s (site_id, server_ip, instance_id, pod_name, port, is_elastic, status, device_id, flavor, cluster) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", zoneId)
 	stmt, err := mysql.DB.Prepare(query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(siteId, serverIp, instanceId, podName, port, is_elastic, status, device_id)
+	_, err = stmt.Exec(siteId, serverIp, instanceId, podName, port, is_elastic, status, device_id, flavor, cluster)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetAndDeleteAvailableInstancesInCenter(zoneId string, num int32) ([]string, error) {
-	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT pod_name FROM instance_%s WHERE is_elastic = 1 AND status = 'available' LIMIT %d", zoneId, num))
+// DeleteInstance 删除实例记录，返回记录是否存在。
+func DeleteInstance(zoneId string, instanceId string) (bool, error) {
+	result, err := mysql.DB.Exec(fmt.Sprintf("DELETE FROM instance_%s WHERE instance_id = ?", zoneId), instanceId)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	defer rows.Close()
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
 
-	var podList []string
+// MarkInstancesTerminating 将最多 num 个可用的弹性实例标记为 terminating，
+// 标记后实例不会再被分配给终端，Pod 删除成功后再删除记录。
+// clusterOrder 为优先回收的集群顺序，不在其中的集群最后回收。
+func MarkInstancesTerminating(zoneId string, flavor string, num int32, clusterOrder []string) ([]ElasticInstance, error) {
+	tx, err := mysql.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 
+	// FIELD 对不在列表中的值返回 0，倒序排列后 DESC 使它们排在最后。
+	args := []interface{}{flavor}
+	placeholders := make([]string, 0, len(clusterOrder))
+	for i := len(clusterOrder) - 1; i >= 0; i-- {
+		args = append(args, clusterOrder[i])
+		placeholders = append(placeholders, "?")
+	}
+	orderBy := ""
+	if len(placeholders) > 0 {
+		orderBy = fmt.Sprintf(" ORDER BY FIELD(cluster, %s) DESC", strings.Join(placeholders, ", "))
+	}
+	rows, err := tx.Query(fmt.Sprintf("SELECT instance_id, pod_name, cluster FROM instance_%s WHERE is_elastic = 1 AND status = 'available' AND flavor = ?%s LIMIT %d FOR UPDATE", zoneId, orderBy, num), args...)
+	if err != nil {
+		return nil, err
+	}
+	var instances []ElasticInstance
 	for rows.Next() {
-		var podName string
-		if err = rows.Scan(&podName); err != nil {
+		e := ElasticInstance{Status: string(instance.Terminating)}
+		if err = rows.Scan(&e.InstanceId, &e.PodName, &e.Cluster); err != nil {
+			rows.Close()
 			return nil, err
 		}
-		podList = append(podList, podName)
+		instances = append(instances, e)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 
-		if _, err = mysql.DB.Exec(fmt.Sprintf("DELETE FROM instance_%s WHERE pod_name = ?", zoneId), podName); err != nil {
-			log.Printf("Failed to delete instance %s from database", podName)
+	for _, e := range instances {
+		err = instance.ApplyTx(context.Background(), tx, serviceName, instance.Change{
+			ZoneId:     zoneId,
+			InstanceId: e.InstanceId,
+			From:       instance.Available,
+			To:         instance.Terminating,
+			Reason:     "scale in",
+		})
+		if err != nil {
+			slog.Error("Failed to mark instance as terminating", "zone_id", zoneId, "instance_id", e.InstanceId, "error", err)
 			return nil, err
 		}
 	}
+	return instances, tx.Commit()
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+// CompareAndSetInstanceStatus 只在实例当前状态为 from 时更新为 to 并记录历史，返回是否更新。
+func CompareAndSetInstanceStatus(zoneId string, instanceId string, from instance.State, to instance.State, reason string) (bool, error) {
+	err := instance.Apply(context.Background(), mysql.DB, serviceName, instance.Change{
+		ZoneId:     zoneId,
+		InstanceId: instanceId,
+		From:       from,
+		To:         to,
+		Reason:     reason,
+	})
+	if errors.Is(err, instance.ErrConflict) {
+		return false, nil
 	}
+	return err == nil, err
+}
 
-	return podList, nil
+// MarkInstanceReady 在弹性实例的 Pod 就绪后记录地址和端口，并将状态从 provisioning 改为 available。
+func MarkInstanceReady(zoneId string, instanceId string, serverIp string, port int32) error {
+	return instance.Apply(context.Background(), mysql.DB, serviceName, instance.Change{
+		ZoneId:     zoneId,
+		InstanceId: instanceId,
+		From:       instance.Provisioning,
+		To:         instance.Available,
+		Reason:     "pod ready",
+		Columns:    []instance.Column{{Name: "server_ip", Value: serverIp}, {Name: "port", Value: port}},
+	})
 }
 
-func GetAvailableInstanceInCenter(zoneId string) (int32, error) {
-	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT DISTINCT count(*) AS COUNT FROM instance_%s WHERE is_elastic = 1 AND status = 'available'", zoneId))
+func GetAvailableInstanceInCenter(zoneId string, flavor string) (int32, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT DISTINCT count(*) AS COUNT FROM instance_%s WHERE is_elastic = 1 AND status = 'available' AND flavor = ?", zoneId), flavor)
 	if err != nil {
-		fmt.Printf("%s: query current available instance failed, err: %v\n", zoneId, err)
+		slog.Error("query current available instance failed", "zone_id", zoneId, "error", err)
 		return 0, err
 	}
 	defer func(query *sql.Rows) {
 		if err := query.Close(); err != nil {
-			fmt.Printf("%s: close current available instance failed, err: %v\n", zoneId, err)
+			slog.Error("close current available instance failed", "zone_id", zoneId, "error", err)
 		}
 	}(rows)
 
 	var count int32
 	if rows.Next() {
 		if err := rows.Scan(&count); err != nil {
-			fmt.Printf("%s: scan current available instance failed, err: %v\n", zoneId, err)
+			slog.Error("scan current available instance failed", "zone_id", zoneId, "error", err)
 			return 0, err
 		}
 	}
 	return count, nil
 }
 
-func SynchronizeInstanceStatus(zoneId string, instanceName string, status string) error {
-	statusInDB, err := getInstanceStatus(zoneId, instanceName)
+// SynchronizeInstanceStatus 将实例 /getStatus 返回的状态同步到数据库。
+// 实例只能报告 available 或 using，数据库中的其他状态由 manager 维护，不会被覆盖。
+func SynchronizeInstanceStatus(ctx context.Context, zoneId string, instanceName string, reported string) error {
+	status, err := instance.Parse(reported)
 	if err != nil {
 		return err
 	}
-
-	if statusInDB != status {
-		return updateInstanceStatus(zoneId, instanceName, status)
+	if status != instance.Available && status != instance.Using {
+		return fmt.Errorf("instance %s reported unexpected state %s", instanceName, status)
 	}
 
-	return nil
+	statusInDB, err := getInstanceStatus(zoneId, instanceName)
+	if err != nil {
+		return err
+	}
+	if statusInDB == status || (statusInDB != instance.Available && statusInDB != instance.Using) {
+		return nil
+	}
+	return instance.Apply(ctx, mysql.DB, serviceName, instance.Change{
+		ZoneId:     zoneId,
+		InstanceId: instanceName,
+		From:       statusInDB,
+		To:         status,
+		Reason:     "synchronized from /getStatus",
+	})
 }
 
-func getInstanceStatus(zoneId string, instanceName string) (string, error) {
+func getInstanceStatus(zoneId string, instanceName string) (instance.State, error) {
 	row := mysql.DB.QueryRow(fmt.Sprintf("SELECT status FROM instance_%s WHERE instance_id = ?", zoneId), instanceName)
 	var status string
 	err := row.Scan(&status)
@@ -95,61 +182,110 @@ func getInstanceStatus(zoneId string, instanceName string) (string, error) {
 		}
 		return "", fmt.Errorf("error scanning row: %w", err)
 	}
-	return status, nil
+	return instance.State(status), nil
+}
+
+// PredTrue 是一分钟的实际实例数和部署实例数，predict 还没有写入部署实例数时 Pred 为 nil。
+type PredTrue struct {
+	Date string   `json:"date"`
+	True int32    `json:"true"`
+	Pred *float64 `json:"pred"`
 }
 
-func updateInstanceStatus(zoneId string, instanceName string, status string) error {
-	result, err := mysql.DB.Exec(fmt.Sprintf("UPDATE instance_%s SET status = ? WHERE instance_id = ?", zoneId), status, instanceName)
+// GetBounceRecords 按时间顺序返回 [start, end) 内每分钟的记录。
+func GetBounceRecords(zoneId string, start string, end string) ([]PredTrue, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT `date`, true_instances, pred_instances FROM bounce_%s WHERE date >= ? AND date < ? ORDER BY date", zoneId), start, end)
 	if err != nil {
-		return fmt.Errorf("error executing update: %w", err)
+		return nil, err
 	}
-	rowsAffected, err := result.RowsAffected()
+	defer rows.Close()
+
+	predTrueList := []PredTrue{}
+	for rows.Next() {
+		var (
+			record  PredTrue
+			predIns sql.NullFloat64
+		)
+		if err = rows.Scan(&record.Date, &record.True, &predIns); err != nil {
+			return nil, err
+		}
+		if predIns.Valid {
+			record.Pred = &predIns.Float64
+		}
+		predTrueList = append(predTrueList, record)
+	}
+	return predTrueList, rows.Err()
+}
+
+func GetZoneListInDB() ([]string, error) {
+	rows, err := mysql.DB.Query("SHOW TABLES LIKE 'instance_%'")
 	if err != nil {
-		return fmt.Errorf("error getting rows affected: %w", err)
+		return nil, err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no rows were updated")
+	defer rows.Close()
+
+	var zoneList []string
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			return nil, err
+		}
+		if zoneId, ok := instance.ZoneFromTable(tableName); ok {
+			zoneList = append(zoneList, zoneId)
+		}
 	}
-	return nil
+	return zoneList, rows.Err()
 }
 
-type PredTrue struct {
-	Date string  `json:"date"`
-	True int32   `json:"true"`
-	Pred float64 `json:"pred"`
+type ElasticInstance struct {
+	InstanceId string `json:"instance_id"`
+	PodName    string `json:"pod_name"`
+	Status     string `json:"status"`
+	Cluster    string `json:"cluster"`
 }
 
-func GetBounceRecords(zoneId string, start string, end string) ([]PredTrue, error) {
-	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT `date`, true_instances, pred_instances FROM bounce_%s WHERE date > '%s' and date < '%s'", zoneId, start, end))
+// GetElasticInstances 查询 zone 下所有弹性实例的记录。
+func GetElasticInstances(zoneId string) ([]ElasticInstance, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT instance_id, pod_name, status, cluster FROM instance_%s WHERE is_elastic = 1", zoneId))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var date string
-	var trueIns int32
-	var predIns float64
-
-	var predTrueList []PredTrue
+	var instances []ElasticInstance
 	for rows.Next() {
-		if err = rows.Scan(&date, &trueIns, &predIns); err != nil {
+		var instance ElasticInstance
+		if err := rows.Scan(&instance.InstanceId, &instance.PodName, &instance.Status, &instance.Cluster); err != nil {
 			return nil, err
 		}
-		predTrueList = append(predTrueList, PredTrue{Date: date, True: trueIns, Pred: predIns})
+		instances = append(instances, instance)
 	}
-	return predTrueList, nil
+	return instances, rows.Err()
 }
 
-func IsBounceRecordExist(zoneId string, date string) (bool, error) {
-	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT true_instances, pred_instances FROM bounce_%s WHERE date = '%s'", zoneId, date))
+// InstanceCount 是 zone 中某种规格、来源和状态的实例数量。
+type InstanceCount struct {
+	Flavor    string
+	IsElastic int
+	Status    string
+	Count     int
+}
+
+// CountInstances 按规格、是否弹性实例和状态统计 zone 中的实例数量。
+func CountInstances(zoneId string) ([]InstanceCount, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT flavor, is_elastic, status, COUNT(*) FROM instance_%s GROUP BY flavor, is_elastic, status", zoneId))
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	if rows.Next() {
-		return true, nil
+	var counts []InstanceCount
+	for rows.Next() {
+		var count InstanceCount
+		if err := rows.Scan(&count.Flavor, &count.IsElastic, &count.Status, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
 	}
-
-	return false, nil
+	return counts, rows.Err()
 }
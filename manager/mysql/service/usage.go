@@ -0,0 +1,151 @@
+package service
+
+import (
+	"manager/mysql"
+	"strings"
+	"time"
+)
+
+// FlavorSpend 是一段时间内某个 zone 中一种规格的实例小时数和费用。
+type FlavorSpend struct {
+	ZoneId        string  `json:"zone_id"`
+	Flavor        string  `json:"flavor"`
+	InstanceHours float64 `json:"instance_hours"`
+	Spend         float64 `json:"spend"`
+}
+
+// DailySpend 是某一天某个 zone 中一种规格的实例小时数和费用。
+type DailySpend struct {
+	Date string // 2006-01-02 格式的日期
+	FlavorSpend
+}
+
+// StartInstanceUsage 记录弹性实例 Pod 开始计费，seenAt 为看到 Pod 的时间。
+// 已经记录过的 Pod 只更新最后一次看到的时间。
+func StartInstanceUsage(podName string, zoneId string, flavor string, cluster string, price float64, startedAt time.Time, seenAt time.Time) error {
+	_, err := mysql.DB.Exec("INSERT INTO instance_usage (pod_name, zone_id, flavor, cluster, price, started_at, last_seen_at) VALUES (?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE last_seen_at = IF(ended_at IS NULL, VALUES(last_seen_at), last_seen_at)",
+		podName, zoneId, flavor, cluster, price, startedAt.Format(timeLayout), seenAt.Format(timeLayout))
+	return err
+}
+
+// TouchInstanceUsage 更新仍在计费的 Pod 最后一次看到的时间。
+func TouchInstanceUsage(podNames []string, seenAt time.Time) error {
+	if len(podNames) == 0 {
+		return nil
+	}
+	args := []interface{}{seenAt.Format(timeLayout)}
+	for _, podName := range podNames {
+		args = append(args, podName)
+	}
+	_, err := mysql.DB.Exec("UPDATE instance_usage SET last_seen_at = ? WHERE ended_at IS NULL AND pod_name IN (?"+strings.Repeat(", ?", len(podNames)-1)+")", args...)
+	return err
+}
+
+// EndVanishedInstanceUsage 结束已经不存在的 Pod 的计费，结束时间为最后一次看到 Pod 的时间，没有记录时为开始时间。
+func EndVanishedInstanceUsage(podName string) error {
+	_, err := mysql.DB.Exec("UPDATE instance_usage SET ended_at = IFNULL(last_seen_at, started_at) WHERE pod_name = ? AND ended_at IS NULL", podName)
+	return err
+}
+
+// EndInstanceUsage 记录弹性实例 Pod 停止计费。
+func EndInstanceUsage(podName string, endedAt time.Time) error {
+	_, err := mysql.DB.Exec("UPDATE instance_usage SET ended_at = ? WHERE pod_name = ? AND ended_at IS NULL",
+		endedAt.Format(timeLayout), podName)
+	return err
+}
+
+// GetRunningUsagePods 返回仍在计费的 Pod 名称及其所在集群。
+func GetRunningUsagePods() (map[string]string, error) {
+	rows, err := mysql.DB.Query("SELECT pod_name, cluster FROM instance_usage WHERE ended_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pods := make(map[string]string)
+	for rows.Next() {
+		var podName, cluster string
+		if err := rows.Scan(&podName, &cluster); err != nil {
+			return nil, err
+		}
+		pods[podName] = cluster
+	}
+	return pods, rows.Err()
+}
+
+// GetHourlyBurn 返回 zone 中仍在计费的实例每小时的总费用。
+func GetHourlyBurn(zoneId string) (float64, error) {
+	var burn float64
+	err := mysql.DB.QueryRow("SELECT IFNULL(SUM(price), 0) FROM instance_usage WHERE zone_id = ? AND ended_at IS NULL", zoneId).Scan(&burn)
+	return burn, err
+}
+
+// GetSpend 统计 [from, to) 内各 zone 各规格的实例小时数和费用，仍在计费的实例计算到 now 为止。
+func GetSpend(from time.Time, to time.Time, now time.Time) ([]FlavorSpend, error) {
+	if now.Before(to) {
+		to = now
+	}
+	f, t, n := from.Format(timeLayout), to.Format(timeLayout), now.Format(timeLayout)
+	rows, err := mysql.DB.Query(`SELECT zone_id, flavor,
+		SUM(TIMESTAMPDIFF(SECOND, GREATEST(started_at, ?), LEAST(IFNULL(ended_at, ?), ?))) / 3600,
+		SUM(price * TIMESTAMPDIFF(SECOND, GREATEST(started_at, ?), LEAST(IFNULL(ended_at, ?), ?))) / 3600
+		FROM instance_usage
+		WHERE started_at < ? AND (ended_at IS NULL OR ended_at > ?)
+		GROUP BY zone_id, flavor`,
+		f, n, t, f, n, t, t, f)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spends []FlavorSpend
+	for rows.Next() {
+		var spend FlavorSpend
+		if err := rows.Scan(&spend.ZoneId, &spend.Flavor, &spend.InstanceHours, &spend.Spend); err != nil {
+			return nil, err
+		}
+		spends = append(spends, spend)
+	}
+	return spends, rows.Err()
+}
+
+// GetDailySpend 按天统计 [from, to) 内各 zone 各规格的实例小时数和费用，from 和 to 为某一天的零点，
+// 仍在计费的实例计算到 now 为止，now 之后的天不返回。
+func GetDailySpend(from time.Time, to time.Time, now time.Time) ([]DailySpend, error) {
+	var days []string
+	n := now.Format(timeLayout)
+	args := []interface{}{n, n}
+	for day := from; day.Before(to) && day.Before(now); day = day.AddDate(0, 0, 1) {
+		days = append(days, "SELECT ? AS day, ? AS day_start, ? AS day_end")
+		end := day.AddDate(0, 0, 1)
+		if now.Before(end) {
+			end = now
+		}
+		args = append(args, day.Format("2006-01-02"), day.Format(timeLayout), end.Format(timeLayout))
+	}
+	if len(days) == 0 {
+		return nil, nil
+	}
+
+	rows, err := mysql.DB.Query(`SELECT d.day, u.zone_id, u.flavor,
+		SUM(TIMESTAMPDIFF(SECOND, GREATEST(u.started_at, d.day_start), LEAST(IFNULL(u.ended_at, ?), d.day_end))) / 3600,
+		SUM(u.price * TIMESTAMPDIFF(SECOND, GREATEST(u.started_at, d.day_start), LEAST(IFNULL(u.ended_at, ?), d.day_end))) / 3600
+		FROM (`+strings.Join(days, " UNION ALL ")+`) d
+		JOIN instance_usage u ON u.started_at < d.day_end AND (u.ended_at IS NULL OR u.ended_at > d.day_start)
+		GROUP BY d.day, u.zone_id, u.flavor
+		ORDER BY d.day, u.zone_id, u.flavor`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spends []DailySpend
+	for rows.Next() {
+		var spend DailySpend
+		if err := rows.Scan(&spend.Date, &spend.ZoneId, &spend.Flavor, &spend.InstanceHours, &spend.Spend); err != nil {
+			return nil, err
+		}
+		spends = append(spends, spend)
+	}
+	return spends, rows.Err()
+}
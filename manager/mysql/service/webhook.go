@@ -0,0 +1,205 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"manager/config"
+	"manager/mysql"
+	"strings"
+	"time"
+)
+
+// sealedPrefix 标记加密后的订阅密钥，没有该前缀的是加密之前写入的明文。
+const sealedPrefix = "v1:"
+
+// secretCipher 返回加密订阅密钥的 AES-256-GCM，密钥由 WEBHOOKSECRETKEY 经 SHA-256 得到。
+func secretCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(config.WEBHOOKSECRETKEY))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSecret 加密订阅密钥，结果为 v1: 加上 base64 编码的 nonce 和密文。
+func sealSecret(secret string) (string, error) {
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return sealedPrefix + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// openSecret 解密订阅密钥，加密之前写入的明文原样返回。
+func openSecret(stored string) (string, error) {
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return stored, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil {
+		return "", err
+	}
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("sealed secret is too short")
+	}
+	secret, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting secret, WEBHOOK_SECRET_KEY may have changed: %w", err)
+	}
+	return string(secret), nil
+}
+
+type WebhookSubscription struct {
+	Id        string   `json:"id"`
+	Url       string   `json:"url"`
+	Secret    string   `json:"-"`
+	Events    []string `json:"events"`
+	CreatedAt string   `json:"created_at"`
+}
+
+type WebhookDeadLetter struct {
+	Id             int64  `json:"id"`
+	SubscriptionId string `json:"subscription_id"`
+	Url            string `json:"url"`
+	EventId        string `json:"event_id"`
+	EventType      string `json:"event_type"`
+	Payload        string `json:"payload"`
+	Attempts       int    `json:"attempts"`
+	LastError      string `json:"last_error"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// InsertWebhookSubscription 保存订阅，密钥加密后保存。
+func InsertWebhookSubscription(subscription *WebhookSubscription) error {
+	secret, err := sealSecret(subscription.Secret)
+	if err != nil {
+		return err
+	}
+	subscription.CreatedAt = time.Now().Format(timeLayout)
+	_, err = mysql.DB.Exec("INSERT INTO webhook_subscriptions (id, url, secret, events, created_at) VALUES (?, ?, ?, ?, ?)",
+		subscription.Id, subscription.Url, secret, strings.Join(subscription.Events, ","), subscription.CreatedAt)
+	return err
+}
+
+// SealWebhookSecrets 加密升级之前以明文保存的订阅密钥。
+// 没有设置 WEBHOOKSECRETKEY 时不加密，已经有加密的密钥时返回错误，否则无法再解密这些密钥。
+func SealWebhookSecrets() error {
+	if config.WEBHOOKSECRETKEY == "" {
+		var sealed int
+		if err := mysql.DB.QueryRow("SELECT COUNT(*) FROM webhook_subscriptions WHERE secret LIKE ?", sealedPrefix+"%").Scan(&sealed); err != nil {
+			return err
+		}
+		if sealed > 0 {
+			return fmt.Errorf("%d webhook subscriptions have encrypted secrets but WEBHOOK_SECRET_KEY is not set", sealed)
+		}
+		slog.Warn("WEBHOOK_SECRET_KEY is not set, webhook subscriptions and deliveries are disabled")
+		return nil
+	}
+	rows, err := mysql.DB.Query("SELECT id, secret FROM webhook_subscriptions WHERE secret NOT LIKE ?", sealedPrefix+"%")
+	if err != nil {
+		return err
+	}
+	plain := make(map[string]string)
+	for rows.Next() {
+		var id, secret string
+		if err := rows.Scan(&id, &secret); err != nil {
+			rows.Close()
+			return err
+		}
+		plain[id] = secret
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, secret := range plain {
+		sealed, err := sealSecret(secret)
+		if err != nil {
+			return err
+		}
+		if _, err := mysql.DB.Exec("UPDATE webhook_subscriptions SET secret = ? WHERE id = ? AND secret = ?", sealed, id, secret); err != nil {
+			return fmt.Errorf("error sealing secret of subscription %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// DeleteWebhookSubscription 删除订阅，返回订阅是否存在。
+func DeleteWebhookSubscription(id string) (bool, error) {
+	result, err := mysql.DB.Exec("DELETE FROM webhook_subscriptions WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+func GetWebhookSubscriptions() ([]WebhookSubscription, error) {
+	rows, err := mysql.DB.Query("SELECT id, url, secret, events, created_at FROM webhook_subscriptions ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []WebhookSubscription{}
+	for rows.Next() {
+		var subscription WebhookSubscription
+		var events string
+		var secret string
+		if err := rows.Scan(&subscription.Id, &subscription.Url, &secret, &events, &subscription.CreatedAt); err != nil {
+			return nil, err
+		}
+		if subscription.Secret, err = openSecret(secret); err != nil {
+			return nil, fmt.Errorf("error reading secret of subscription %s: %w", subscription.Id, err)
+		}
+		subscription.Events = []string{}
+		if events != "" {
+			subscription.Events = strings.Split(events, ",")
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func InsertWebhookDeadLetter(deadLetter *WebhookDeadLetter) error {
+	_, err := mysql.DB.Exec("INSERT INTO webhook_dead_letters (subscription_id, url, event_id, event_type, payload, attempts, last_error, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		deadLetter.SubscriptionId, deadLetter.Url, deadLetter.EventId, deadLetter.EventType, deadLetter.Payload, deadLetter.Attempts, deadLetter.LastError, time.Now().Format(timeLayout))
+	return err
+}
+
+// GetWebhookDeadLetters 查询最近的 limit 条死信。
+func GetWebhookDeadLetters(limit int) ([]WebhookDeadLetter, error) {
+	rows, err := mysql.DB.Query("SELECT id, subscription_id, url, event_id, event_type, payload, attempts, IFNULL(last_error, ''), created_at FROM webhook_dead_letters ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deadLetters := []WebhookDeadLetter{}
+	for rows.Next() {
+		var deadLetter WebhookDeadLetter
+		if err := rows.Scan(&deadLetter.Id, &deadLetter.SubscriptionId, &deadLetter.Url, &deadLetter.EventId, &deadLetter.EventType, &deadLetter.Payload, &deadLetter.Attempts, &deadLetter.LastError, &deadLetter.CreatedAt); err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	return deadLetters, rows.Err()
+}
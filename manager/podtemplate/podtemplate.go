@@ -0,0 +1,181 @@
+package podtemplate
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+//go:embed templates/*.yaml
+var defaultTemplates embed.FS
+
+// Values 是渲染模板时可以使用的变量。
+type Values struct {
+	Namespace    string
+	ZoneId       string
+	InstanceId   string
+	PodName      string
+	ServiceName  string
+	Flavor       string                      // 规格名称
+	Image        string                      // 规格镜像
+	Port         int32                       // 规格的第一个容器端口，用于健康检查和 NodePort 暴露
+	Ports        []corev1.ContainerPort      // 规格的全部容器端口
+	Resources    corev1.ResourceRequirements // 规格的资源配置
+	NodeSelector map[string]string           // 规格的节点选择器
+}
+
+// source 表示一个模板来源，path 为空时使用内置模板。
+// 文件被修改后（例如 ConfigMap 更新）会在下一次渲染时重新加载，不需要重启 manager。
+type source struct {
+	name    string
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	tmpl    *template.Template
+}
+
+func (s *source) load() (*template.Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "" {
+		if s.tmpl == nil {
+			data, err := defaultTemplates.ReadFile(fmt.Sprintf("templates/%s.yaml", s.name))
+			if err != nil {
+				return nil, fmt.Errorf("error reading default %s template: %w", s.name, err)
+			}
+			if s.tmpl, err = parse(s.name, data); err != nil {
+				return nil, err
+			}
+		}
+		return s.tmpl, nil
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s template %s: %w", s.name, s.path, err)
+	}
+	if s.tmpl != nil && info.ModTime().Equal(s.modTime) {
+		return s.tmpl, nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s template %s: %w", s.name, s.path, err)
+	}
+	tmpl, err := parse(s.name, data)
+	if err != nil {
+		return nil, err
+	}
+	s.tmpl, s.modTime = tmpl, info.ModTime()
+	return s.tmpl, nil
+}
+
+func (s *source) render(values *Values, obj interface{}) error {
+	tmpl, err := s.load()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return fmt.Errorf("error rendering %s template: %w", s.name, err)
+	}
+	if err := yaml.UnmarshalStrict(buf.Bytes(), obj); err != nil {
+		return fmt.Errorf("error decoding rendered %s template: %w", s.name, err)
+	}
+	return nil
+}
+
+func parse(name string, data []byte) (*template.Template, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"toJson": toJson}).
+		Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// toJson 将值输出为 JSON，JSON 同时也是合法的 YAML，便于在模板中嵌入结构体。
+func toJson(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Renderer 根据 Pod 和 Service 模板生成弹性实例的资源对象。
+type Renderer struct {
+	pod     *source
+	service *source
+}
+
+// NewRenderer 创建渲染器，路径为空时使用内置模板。
+func NewRenderer(podTemplatePath string, serviceTemplatePath string) (*Renderer, error) {
+	r := &Renderer{
+		pod:     &source{name: "pod", path: podTemplatePath},
+		service: &source{name: "service", path: serviceTemplatePath},
+	}
+	// 启动时校验一次模板，避免到扩容时才发现模板有误。
+	if _, err := r.pod.load(); err != nil {
+		return nil, err
+	}
+	if _, err := r.service.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// RenderPod 渲染 Pod，名称、命名空间和 manager 依赖的标签会被强制覆盖。
+func (r *Renderer) RenderPod(values *Values) (*corev1.Pod, error) {
+	pod := &corev1.Pod{}
+	if err := r.pod.render(values, pod); err != nil {
+		return nil, err
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("pod template has no containers")
+	}
+
+	pod.Name = values.PodName
+	pod.Namespace = values.Namespace
+	if pod.Labels == nil {
+		pod.Labels = make(map[string]string)
+	}
+	pod.Labels["instance_id"] = values.InstanceId
+	pod.Labels["zone_id"] = values.ZoneId
+	pod.Labels["is_elastic"] = "1"
+	pod.Labels["flavor"] = values.Flavor
+	return pod, nil
+}
+
+// RenderService 渲染 NodePort Service，名称、命名空间和选择器会被强制覆盖。
+func (r *Renderer) RenderService(values *Values) (*corev1.Service, error) {
+	service := &corev1.Service{}
+	if err := r.service.render(values, service); err != nil {
+		return nil, err
+	}
+	if len(service.Spec.Ports) == 0 {
+		return nil, fmt.Errorf("service template has no ports")
+	}
+
+	service.Name = values.ServiceName
+	service.Namespace = values.Namespace
+	service.Spec.Type = corev1.ServiceTypeNodePort
+	service.Spec.Selector = map[string]string{"instance_id": values.InstanceId}
+	if service.Labels == nil {
+		service.Labels = make(map[string]string)
+	}
+	service.Labels["instance_id"] = values.InstanceId
+	service.Labels["zone_id"] = values.ZoneId
+	service.Labels["is_elastic"] = "1"
+	return service, nil
+}
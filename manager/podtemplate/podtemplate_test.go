@@ -0,0 +1,114 @@
+package podtemplate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func testValues() *Values {
+	return &Values{
+		Namespace:   "cloudgame",
+		ZoneId:      "huadong",
+		InstanceId:  "instance-cloudgame-center-1",
+		PodName:     "cloudgame-center-1",
+		ServiceName: "service-cloudgame-center-1",
+		Flavor:      "default",
+		Image:       "cloudgame:latest",
+		Port:        8080,
+		Ports: []corev1.ContainerPort{
+			{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP},
+		},
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("50m"),
+			},
+		},
+		NodeSelector: map[string]string{"gpu": "true"},
+	}
+}
+
+func Test_DefaultTemplates(t *testing.T) {
+	r, err := NewRenderer("", "")
+	if err != nil {
+		t.Fatalf("failed to create renderer: %v", err)
+	}
+
+	pod, err := r.RenderPod(testValues())
+	if err != nil {
+		t.Fatalf("failed to render pod: %v", err)
+	}
+	if pod.Name != "cloudgame-center-1" || pod.Namespace != "cloudgame" {
+		t.Errorf("unexpected pod name %s/%s", pod.Namespace, pod.Name)
+	}
+	if pod.Labels["instance_id"] != "instance-cloudgame-center-1" || pod.Labels["is_elastic"] != "1" {
+		t.Errorf("unexpected pod labels %v", pod.Labels)
+	}
+	container := pod.Spec.Containers[0]
+	if container.Image != "cloudgame:latest" {
+		t.Errorf("unexpected image %s", container.Image)
+	}
+	if container.ReadinessProbe.HTTPGet.Port.IntValue() != 8080 {
+		t.Errorf("unexpected probe port %v", container.ReadinessProbe.HTTPGet.Port)
+	}
+	if cpu := container.Resources.Limits[corev1.ResourceCPU]; cpu.String() != "50m" {
+		t.Errorf("unexpected cpu limit %s", cpu.String())
+	}
+	if pod.Spec.NodeSelector["gpu"] != "true" {
+		t.Errorf("unexpected node selector %v", pod.Spec.NodeSelector)
+	}
+
+	service, err := r.RenderService(testValues())
+	if err != nil {
+		t.Fatalf("failed to render service: %v", err)
+	}
+	if service.Spec.Type != corev1.ServiceTypeNodePort || service.Spec.Ports[0].TargetPort.IntValue() != 8080 {
+		t.Errorf("unexpected service spec %v", service.Spec)
+	}
+	if service.Spec.Selector["instance_id"] != "instance-cloudgame-center-1" {
+		t.Errorf("unexpected service selector %v", service.Spec.Selector)
+	}
+}
+
+func Test_FileTemplateReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pod.yaml")
+	write := func(image string, modTime time.Time) {
+		content := "metadata:\n  name: ignored\nspec:\n  containers:\n    - name: c\n      image: " + image + "\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	write("{{ .Image }}", now)
+	r, err := NewRenderer(path, "")
+	if err != nil {
+		t.Fatalf("failed to create renderer: %v", err)
+	}
+	pod, err := r.RenderPod(testValues())
+	if err != nil {
+		t.Fatalf("failed to render pod: %v", err)
+	}
+	if pod.Name != "cloudgame-center-1" || pod.Labels["zone_id"] != "huadong" {
+		t.Errorf("name and labels should be overridden, got %s %v", pod.Name, pod.Labels)
+	}
+	if pod.Spec.Containers[0].Image != "cloudgame:latest" {
+		t.Errorf("unexpected image %s", pod.Spec.Containers[0].Image)
+	}
+
+	write("cloudgame:v2", now.Add(time.Minute))
+	pod, err = r.RenderPod(testValues())
+	if err != nil {
+		t.Fatalf("failed to render pod: %v", err)
+	}
+	if pod.Spec.Containers[0].Image != "cloudgame:v2" {
+		t.Errorf("template should be reloaded, got image %s", pod.Spec.Containers[0].Image)
+	}
+}
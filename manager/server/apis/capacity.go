@@ -0,0 +1,183 @@
+package apis
+
+import (
+	"fmt"
+	"log/slog"
+	"manager/config"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// reservation 是已经决定创建但还没有完成的 Pod。
+type reservation struct {
+	zoneId  string
+	flavor  string
+	cluster string
+}
+
+// placement 是一个预留的 Pod 及其所在集群。
+type placement struct {
+	podName string
+	cluster *clusterState
+}
+
+var (
+	reservationsMu sync.Mutex
+	reservations   = make(map[string]reservation) // key 为 Pod 名称
+)
+
+// reserveCapacity 在决定扩容时为将要创建的 Pod 预留容量并选择集群，返回预留的 Pod，
+// 数量受 CENTERCAPACITY、规格上限和各集群容量限制，可能少于 replica。
+// 集群按成本从低到高依次填满，不健康或不服务该 zone 的集群会被跳过。
+// 预留的 Pod 在创建完成或失败后需要调用 releaseReservation 释放。
+func reserveCapacity(zoneId string, flavor *config.Flavor, replica int32) ([]placement, error) {
+	reservationsMu.Lock()
+	defer reservationsMu.Unlock()
+
+	// 已经出现在缓存中的预留 Pod 不重复计算。
+	current, currentFlavor := 0, 0
+	for _, r := range reservations {
+		if r.zoneId == zoneId {
+			current++
+			if r.flavor == flavor.Name {
+				currentFlavor++
+			}
+		}
+	}
+	for _, c := range clusters {
+		pods, err := c.listPods(labels.Set{"zone_id": zoneId, "is_elastic": "1"})
+		if err != nil {
+			return nil, fmt.Errorf("error listing pods in cluster %s: %w", c.Name, err)
+		}
+		for _, pod := range pods {
+			if _, ok := reservations[pod.Name]; ok {
+				continue
+			}
+			current++
+			if pod.Labels["flavor"] == flavor.Name {
+				currentFlavor++
+			}
+		}
+	}
+
+	if current >= config.CENTERCAPACITY {
+		return nil, fmt.Errorf("the number of elastic instance in zone %s is already full", zoneId)
+	}
+	left := int32(config.CENTERCAPACITY - current)
+	// 规格单独设置了上限时，还需要满足规格的上限。
+	if flavor.Capacity > 0 {
+		if currentFlavor >= flavor.Capacity {
+			return nil, fmt.Errorf("the number of %s elastic instance in zone %s is already full", flavor.Name, zoneId)
+		}
+		if flavorLeft := int32(flavor.Capacity - currentFlavor); flavorLeft < left {
+			left = flavorLeft
+		}
+	}
+	if left < replica {
+		replica = left
+		slog.Info("The left space can only deploy part of the pods", "zone_id", zoneId, "flavor", flavor.Name, "replica", replica)
+	}
+
+	var placements []placement
+	for _, c := range placementOrder() {
+		if replica == 0 {
+			break
+		}
+		if !c.Healthy() || !c.Serves(zoneId) {
+			continue
+		}
+		n := replica
+		if c.Capacity > 0 {
+			used, reserved := clusterUsageLocked(c)
+			free := int32(c.Capacity - used - reserved)
+			if free <= 0 {
+				continue
+			}
+			if free < n {
+				n = free
+			}
+		}
+		for i := int32(0); i < n; i++ {
+			podName := fmt.Sprintf("cloudgame-center-%s", uuid.NewUUID())
+			reservations[podName] = reservation{zoneId: zoneId, flavor: flavor.Name, cluster: c.Name}
+			placements = append(placements, placement{podName: podName, cluster: c})
+		}
+		replica -= n
+	}
+	if len(placements) == 0 {
+		return nil, fmt.Errorf("there is no healthy cluster with free capacity for zone %s", zoneId)
+	}
+	if replica > 0 {
+		slog.Info("The clusters can only deploy part of the pods", "zone_id", zoneId, "flavor", flavor.Name, "replica", len(placements))
+	}
+	return placements, nil
+}
+
+// swapReservation 将预留在集群 c 上的 Pod 名称换成重试时使用的新名称。
+// 原集群不健康时换到其他有空闲容量的健康集群，没有可用集群时仍使用原集群。
+func swapReservation(c *clusterState, oldPodName string, newPodName string) *clusterState {
+	reservationsMu.Lock()
+	defer reservationsMu.Unlock()
+	r := reservations[oldPodName]
+	delete(reservations, oldPodName)
+
+	if !c.Healthy() {
+		for _, candidate := range placementOrder() {
+			if candidate == c || !candidate.Healthy() || !candidate.Serves(r.zoneId) {
+				continue
+			}
+			if used, reserved := clusterUsageLocked(candidate); candidate.Capacity == 0 || used+reserved < candidate.Capacity {
+				slog.Warn("Cluster is unhealthy, pod is moved to another cluster", "zone_id", r.zoneId, "pod_name", newPodName, "cluster", c.Name, "target_cluster", candidate.Name)
+				c = candidate
+				break
+			}
+		}
+	}
+	r.cluster = c.Name
+	reservations[newPodName] = r
+	return c
+}
+
+func releaseReservation(podName string) {
+	reservationsMu.Lock()
+	defer reservationsMu.Unlock()
+	delete(reservations, podName)
+}
+
+// reserved 判断 Pod 是否已经预留、正在创建。
+func reserved(podName string) bool {
+	reservationsMu.Lock()
+	defer reservationsMu.Unlock()
+	_, ok := reservations[podName]
+	return ok
+}
+
+// clusterUsage 返回集群中已有的弹性实例数量和正在创建的弹性实例数量。
+func clusterUsage(c *clusterState) (int, int) {
+	reservationsMu.Lock()
+	defer reservationsMu.Unlock()
+	return clusterUsageLocked(c)
+}
+
+func clusterUsageLocked(c *clusterState) (int, int) {
+	reserved := 0
+	for _, r := range reservations {
+		if r.cluster == c.Name {
+			reserved++
+		}
+	}
+	pods, err := c.listPods(labels.Set{"is_elastic": "1"})
+	if err != nil {
+		slog.Error("Failed to list pods", "cluster", c.Name, "error", err)
+		return 0, reserved
+	}
+	used := 0
+	for _, pod := range pods {
+		if _, ok := reservations[pod.Name]; !ok {
+			used++
+		}
+	}
+	return used, reserved
+}
@@ -0,0 +1,152 @@
+package apis
+
+import (
+	"context"
+	"log/slog"
+	"manager/config"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	k8s_client "manager/k8s-client"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const clusterProbeInterval = 15 * time.Second
+
+// clusterState 是一个目标集群的缓存和健康状态。
+type clusterState struct {
+	*k8s_client.Cluster
+	podLister     corelisters.PodLister
+	serviceLister corelisters.ServiceLister
+	synced        func() bool
+
+	mu      sync.Mutex
+	healthy bool
+	message string // 不健康的原因
+}
+
+// clusters 是所有目标集群，顺序与配置一致，第一个为主集群。
+var clusters []*clusterState
+
+func (c *clusterState) Healthy() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.healthy
+}
+
+func (c *clusterState) setHealth(healthy bool, message string) {
+	c.mu.Lock()
+	changed := c.healthy != healthy
+	c.healthy, c.message = healthy, message
+	c.mu.Unlock()
+	if changed && healthy {
+		slog.Info("Cluster is healthy", "cluster", c.Name)
+	} else if changed {
+		slog.Warn("Cluster is unhealthy", "cluster", c.Name, "reason", message)
+	}
+}
+
+// getCluster 根据名称获取集群，集群已经不在配置中时返回 nil。
+func getCluster(name string) *clusterState {
+	for _, c := range clusters {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// listPods 从缓存中获取集群中的 Pod。
+func (c *clusterState) listPods(set labels.Set) ([]*corev1.Pod, error) {
+	return c.podLister.Pods(config.K8SNAMSPACE).List(labels.SelectorFromSet(set))
+}
+
+// startClusterProbe 周期性检查集群 API Server 是否可用，不可用或缓存未同步的集群不再部署新的实例。
+func startClusterProbe(ctx context.Context) {
+	for _, c := range clusters {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			if err := c.Client.Discovery().RESTClient().Get().AbsPath("/readyz").Do(probeCtx).Error(); err != nil {
+				c.setHealth(false, err.Error())
+				return
+			}
+			if !c.synced() {
+				c.setHealth(false, "informer cache is not synced")
+				return
+			}
+			c.setHealth(true, "")
+		}, clusterProbeInterval)
+	}
+}
+
+// placementOrder 返回扩容时集群的使用顺序：成本低的优先，成本相同时 priority 小的优先。
+func placementOrder() []*clusterState {
+	ordered := append([]*clusterState(nil), clusters...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Cost != ordered[j].Cost {
+			return ordered[i].Cost < ordered[j].Cost
+		}
+		return ordered[i].Priority < ordered[j].Priority
+	})
+	return ordered
+}
+
+// drainOrder 返回缩容时回收实例的集群顺序：健康的集群中成本高的优先，不健康的集群放在最后。
+func drainOrder() []string {
+	ordered := placementOrder()
+	names := make([]string, 0, len(ordered))
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if ordered[i].Healthy() {
+			names = append(names, ordered[i].Name)
+		}
+	}
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if !ordered[i].Healthy() {
+			names = append(names, ordered[i].Name)
+		}
+	}
+	return names
+}
+
+type ClusterStatus struct {
+	Name     string   `json:"name"`
+	Zones    []string `json:"zones"`
+	Capacity int      `json:"capacity"`
+	Priority int      `json:"priority"`
+	Cost     float64  `json:"cost"`
+	Healthy  bool     `json:"healthy"`
+	Message  string   `json:"message,omitempty"`
+	Used     int      `json:"used"`     // 缓存中的弹性实例数量
+	Reserved int      `json:"reserved"` // 正在创建的弹性实例数量
+}
+
+// ListClusters 查询所有目标集群的容量和健康状态。
+func ListClusters(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]ClusterStatus, 0, len(clusters))
+	for _, c := range clusters {
+		c.mu.Lock()
+		status := ClusterStatus{
+			Name:     c.Name,
+			Zones:    c.Zones,
+			Capacity: c.Capacity,
+			Priority: c.Priority,
+			Cost:     c.Cost,
+			Healthy:  c.healthy,
+			Message:  c.message,
+		}
+		c.mu.Unlock()
+		if status.Zones == nil {
+			status.Zones = []string{}
+		}
+		status.Used, status.Reserved = clusterUsage(c)
+		statuses = append(statuses, status)
+	}
+	sendOK(w, statuses)
+}
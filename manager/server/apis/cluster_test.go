@@ -0,0 +1,73 @@
+package apis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetClusterReturnsNilForUnknownName(t *testing.T) {
+	useClusters(t, newTestCluster("default"), newTestCluster("backup"))
+	if c := getCluster("backup"); c == nil || c.Name != "backup" {
+		t.Errorf("expected cluster backup, got %v", c)
+	}
+	if c := getCluster("removed"); c != nil {
+		t.Errorf("expected nil for an unknown cluster, got %s", c.Name)
+	}
+}
+
+func TestListClusters(t *testing.T) {
+	primary := newTestCluster("default", testPod("pod-1", "huadong", time.Now()), testPod("pod-2", "huadong", time.Now()))
+	primary.Capacity, primary.Cost = 10, 1
+	backup := newTestCluster("backup")
+	backup.Zones = []string{"huabei"}
+	backup.setHealth(false, "informer cache is not synced")
+	useClusters(t, primary, backup)
+
+	// 正在创建的 Pod 只计入预留数量。
+	reservationsMu.Lock()
+	reservations["pod-2"] = reservation{zoneId: "huadong", flavor: "default", cluster: "default"}
+	reservations["pod-3"] = reservation{zoneId: "huabei", flavor: "default", cluster: "backup"}
+	reservationsMu.Unlock()
+	t.Cleanup(func() {
+		releaseReservation("pod-2")
+		releaseReservation("pod-3")
+	})
+
+	var statuses []ClusterStatus
+	w, code := serve(t, ListClusters, httptest.NewRequest(http.MethodGet, "/clusters", nil), nil, &statuses)
+	if w.Code != http.StatusOK || code != 200 || len(statuses) != 2 {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+	if s := statuses[0]; s.Name != "default" || !s.Healthy || s.Capacity != 10 || s.Used != 1 || s.Reserved != 1 || len(s.Zones) != 0 {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if s := statuses[1]; s.Name != "backup" || s.Healthy || s.Message == "" || s.Used != 0 || s.Reserved != 1 || s.Zones[0] != "huabei" {
+		t.Errorf("unexpected status %+v", s)
+	}
+}
+
+func TestSwapReservationMovesToHealthyCluster(t *testing.T) {
+	unhealthy := newTestCluster("default")
+	unhealthy.setHealth(false, "connection refused")
+	other := newTestCluster("other")
+	other.Zones = []string{"huabei"}
+	backup := newTestCluster("backup")
+	useClusters(t, unhealthy, other, backup)
+
+	reservationsMu.Lock()
+	reservations["pod-old"] = reservation{zoneId: "huadong", flavor: "default", cluster: "default"}
+	reservationsMu.Unlock()
+	t.Cleanup(func() { releaseReservation("pod-new") })
+
+	// other 不服务 huadong，只能换到 backup。
+	if c := swapReservation(unhealthy, "pod-old", "pod-new"); c != backup {
+		t.Errorf("expected cluster backup, got %s", c.Name)
+	}
+	reservationsMu.Lock()
+	defer reservationsMu.Unlock()
+	if _, ok := reservations["pod-old"]; ok || reservations["pod-new"].cluster != "backup" {
+		t.Errorf("unexpected reservations %+v", reservations)
+	}
+}
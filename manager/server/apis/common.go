@@ -1,106 +1,158 @@
 package apis
 
 import (
+	"encoding/csv"
 	"fmt"
+	"log/slog"
+	"manager/analytics"
 	mysqlservice "manager/mysql/service"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 )
 
 func Healthz(w http.ResponseWriter, r *http.Request) {
-	SendHttpResponse(w, &Response{
-		StatusCode: 200,
-		Message:    "OK",
-		Data:       "Alive",
-	}, http.StatusOK)
+	sendOK(w, "Alive")
 }
 
+const bounceRateMaxRange = 366 * 24 * time.Hour
+
+// BounceRateResponse 中 Date、TrueIns 和 BounceIns 为每个区间的开始时间、实际实例数平均值和部署实例数平均值，
+// 与页面使用的格式保持一致；部署实例数缺失的区间 BounceIns 为 0。
 type BounceRateResponse struct {
-	Date      []string  `json:"date"`
-	TrueIns   []float64 `json:"true_ins"`
-	BounceIns []float64 `json:"bounce_ins"`
+	ZoneId     string            `json:"zone_id"`
+	Resolution string            `json:"resolution"`
+	Date       []string          `json:"date"`
+	TrueIns    []float64         `json:"true_ins"`
+	BounceIns  []float64         `json:"bounce_ins"`
+	Buckets    []BounceBucket    `json:"buckets"`
+	Summary    analytics.Summary `json:"summary"`
+}
+
+type BounceBucket struct {
+	Start   string           `json:"start"`
+	Samples int              `json:"samples"`
+	True    analytics.Stats  `json:"true"`
+	Pred    *analytics.Stats `json:"pred"`
 }
 
+// BounceRate 返回 zone 的实际实例数与部署实例数的对比。
+// 参数：
+//   - zone：未指定且只有一个 zone 时使用该 zone。
+//   - start、end（或 from、to）：2006-01-02 15:04:05 或 2006-01-02 格式，统计 [start, end)，默认为最近 24 小时，不需要与记录的时间对齐。
+//   - resolution：1m（默认）、5m、1h 或 1d，按区间统计最小值、平均值和最大值。
+//   - format：json（默认）或 csv，csv 以附件形式返回每个区间的统计。
 func BounceRate(w http.ResponseWriter, r *http.Request) {
-	// 通过 Query 的形式传递参数。
 	query := r.URL.Query()
-	layout := "2006-01-02 15:04:00"
-	// 参数格式："2006-01-02 15:04:00"，必须要保证秒数是 0。
-	start := query.Get("start")
-	end := query.Get("end")
-
-	tStart, err := time.Parse(layout, start)
+	// 页面使用 start 和 end 参数。
+	if query.Get("from") == "" {
+		query.Set("from", query.Get("start"))
+	}
+	if query.Get("to") == "" {
+		query.Set("to", query.Get("end"))
+	}
+	from, to, err := parseQueryTimeRange(query, 24*time.Hour)
 	if err != nil {
-		SendHttpResponse(w, &Response{
-			StatusCode: 400,
-			Message:    "Invalid start time",
-			Data:       nil,
-		}, http.StatusBadRequest)
+		sendBadRequest(w, err.Error())
 		return
 	}
-	tEnd, err := time.Parse(layout, end)
+	if to.Sub(from) > bounceRateMaxRange {
+		sendBadRequest(w, "The range cannot be longer than 366 days")
+		return
+	}
+	resolutionName := query.Get("resolution")
+	if resolutionName == "" {
+		resolutionName = "1m"
+	}
+	resolution, err := analytics.ParseResolution(resolutionName)
 	if err != nil {
-		SendHttpResponse(w, &Response{
-			StatusCode: 400,
-			Message:    "Invalid end time",
-			Data:       nil,
-		}, http.StatusBadRequest)
+		sendBadRequest(w, err.Error())
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		sendBadRequest(w, "format must be json or csv")
 		return
 	}
 
-	isStartExist, err := mysqlservice.IsBounceRecordExist("huadong", tStart.Format(layout))
+	zones, err := mysqlservice.GetZoneListInDB()
 	if err != nil {
-		SendHttpResponse(w, &Response{
-			StatusCode: 500,
-			Message:    fmt.Sprintf("check bounce record exist failed, err: %v", err),
-			Data:       nil,
-		}, http.StatusInternalServerError)
+		sendInternalError(w, err)
 		return
 	}
-	isEndExist, err := mysqlservice.IsBounceRecordExist("huadong", tEnd.Format(layout))
-	if err != nil {
-		SendHttpResponse(w, &Response{
-			StatusCode: 500,
-			Message:    fmt.Sprintf("check bounce record exist failed, err: %v", err),
-			Data:       nil,
-		}, http.StatusInternalServerError)
+	zoneId := query.Get("zone")
+	if zoneId == "" && len(zones) == 1 {
+		zoneId = zones[0]
+	}
+	if zoneId == "" {
+		sendBadRequest(w, "zone is required")
 		return
 	}
-
-	if !isStartExist || !isEndExist {
-		SendHttpResponse(w, &Response{
-			StatusCode: 400,
-			Message:    fmt.Sprintf("Invalid start or end time, %v or %v do not exist", tStart.Format(layout), tEnd.Format(layout)),
-			Data:       nil,
-		}, http.StatusBadRequest)
+	if !slices.Contains(zones, zoneId) {
+		sendNotFound(w, "Zone "+zoneId+" not found")
 		return
 	}
 
-	predTrueList, err := mysqlservice.GetBounceRecords("huadong", tStart.Format(layout), tEnd.Format(layout))
+	records, err := mysqlservice.GetBounceRecords(zoneId, from.Format(queryTimeLayout), to.Format(queryTimeLayout))
 	if err != nil {
-		SendHttpResponse(w, &Response{
-			StatusCode: 500,
-			Message:    fmt.Sprintf("Get bounce record failed, err: %v", err),
-			Data:       nil,
-		}, http.StatusInternalServerError)
+		sendInternalError(w, fmt.Errorf("get bounce records failed: %w", err))
 		return
 	}
+	samples := make([]analytics.Sample, 0, len(records))
+	for _, record := range records {
+		t, err := time.ParseInLocation(queryTimeLayout, record.Date, time.Local)
+		if err != nil {
+			sendInternalError(w, fmt.Errorf("invalid bounce record date %q: %w", record.Date, err))
+			return
+		}
+		samples = append(samples, analytics.Sample{Time: t, True: float64(record.True), Pred: record.Pred})
+	}
 
-	var TrueIns, BounceIns []float64
-	var Date []string
-	for _, pt := range predTrueList {
-		Date = append(Date, pt.Date)
-		TrueIns = append(TrueIns, float64(pt.True))
-		BounceIns = append(BounceIns, pt.Pred)
+	response := &BounceRateResponse{
+		ZoneId:     zoneId,
+		Resolution: resolutionName,
+		Date:       []string{},
+		TrueIns:    []float64{},
+		BounceIns:  []float64{},
+		Buckets:    []BounceBucket{},
+		Summary:    analytics.Summarize(samples),
+	}
+	for _, b := range analytics.Downsample(samples, resolution) {
+		bucket := BounceBucket{Start: b.Start.Format(queryTimeLayout), Samples: b.Samples, True: b.True, Pred: b.Pred}
+		response.Buckets = append(response.Buckets, bucket)
+		response.Date = append(response.Date, bucket.Start)
+		response.TrueIns = append(response.TrueIns, b.True.Avg)
+		if b.Pred != nil {
+			response.BounceIns = append(response.BounceIns, b.Pred.Avg)
+		} else {
+			response.BounceIns = append(response.BounceIns, 0)
+		}
 	}
 
-	SendHttpResponse(w, &Response{
-		StatusCode: 0,
-		Message:    "OK",
-		Data: BounceRateResponse{
-			TrueIns:   TrueIns,
-			BounceIns: BounceIns,
-			Date:      Date,
-		},
-	}, http.StatusOK)
+	if format == "csv" {
+		writeBounceCSV(w, response)
+		return
+	}
+	sendOK(w, response)
+}
+
+// writeBounceCSV 以 CSV 附件返回每个区间的统计，部署实例数缺失时对应的列为空。
+func writeBounceCSV(w http.ResponseWriter, response *BounceRateResponse) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=bounce_%s_%s.csv", response.ZoneId, response.Resolution))
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"start", "samples", "true_min", "true_avg", "true_max", "pred_min", "pred_avg", "pred_max"})
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, b := range response.Buckets {
+		row := []string{b.Start, strconv.Itoa(b.Samples), format(b.True.Min), format(b.True.Avg), format(b.True.Max), "", "", ""}
+		if b.Pred != nil {
+			row[5], row[6], row[7] = format(b.Pred.Min), format(b.Pred.Avg), format(b.Pred.Max)
+		}
+		_ = writer.Write(row)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		slog.Warn("Failed to write bounce csv", "zone_id", response.ZoneId, "error", err)
+	}
 }
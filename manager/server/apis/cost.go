@@ -0,0 +1,336 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"manager/config"
+	mysql_service "manager/mysql/service"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	usageSyncInterval = 5 * time.Minute
+	costDateLayout    = "2006-01-02"
+	costReportMaxDays = 92
+)
+
+// usageQueue 在后台按事件顺序写入计费记录，informer 的事件处理不等待数据库。
+var usageQueue = &jobQueue{}
+
+// recordUsageStart 在弹性实例 Pod 出现时开始计费，热备实例同样计费，价格按 Pod 创建时的配置记录。
+func recordUsageStart(c *clusterState, pod *corev1.Pod) {
+	zoneId, flavor := pod.Labels["zone_id"], pod.Labels["flavor"]
+	if pod.Labels["is_elastic"] != "1" || zoneId == "" {
+		return
+	}
+	if flavor == "" {
+		flavor = config.DefaultFlavor
+	}
+	podName, price, seenAt := pod.Name, config.COST.Price(zoneId, flavor), time.Now()
+	startedAt := pod.CreationTimestamp.Time
+	if startedAt.IsZero() {
+		startedAt = seenAt
+	}
+	usageQueue.enqueue(func() {
+		if err := mysql_service.StartInstanceUsage(podName, zoneId, flavor, c.Name, price, startedAt, seenAt); err != nil {
+			slog.Error("Failed to record usage", "zone_id", zoneId, "pod_name", podName, "error", err)
+		}
+	})
+}
+
+// recordUsageEnd 在弹性实例 Pod 被删除时停止计费。
+func recordUsageEnd(pod *corev1.Pod) {
+	if pod.Labels["is_elastic"] != "1" {
+		return
+	}
+	zoneId, podName, endedAt := pod.Labels["zone_id"], pod.Name, time.Now()
+	usageQueue.enqueue(func() {
+		if err := mysql_service.EndInstanceUsage(podName, endedAt); err != nil {
+			slog.Error("Failed to record usage end", "zone_id", zoneId, "pod_name", podName, "error", err)
+		}
+	})
+}
+
+// StartUsageSync 周期性更新仍在计费的 Pod 最后一次看到的时间，并结束 Pod 已经不存在但仍在计费的记录，
+// 例如 manager 停止期间被删除的 Pod，结束时间为最后一次看到 Pod 的时间。
+// 同步在计费队列中执行，排在已经收到的 Pod 事件之后；只处理健康集群中的记录，避免缓存不完整时误结束计费。
+func StartUsageSync(ctx context.Context) {
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		done := make(chan struct{})
+		usageQueue.enqueue(func() {
+			defer close(done)
+			syncUsage(time.Now())
+		})
+		<-done
+	}, usageSyncInterval)
+}
+
+func syncUsage(now time.Time) {
+	pods, err := mysql_service.GetRunningUsagePods()
+	if err != nil {
+		slog.Error("Failed to get running usage", "error", err)
+		return
+	}
+	var seen []string
+	for podName, clusterName := range pods {
+		c := getCluster(clusterName)
+		if c == nil || !c.Healthy() {
+			continue
+		}
+		if _, err := c.podLister.Pods(config.K8SNAMSPACE).Get(podName); err == nil {
+			seen = append(seen, podName)
+			continue
+		}
+		if err := mysql_service.EndVanishedInstanceUsage(podName); err != nil {
+			slog.Error("Failed to end usage", "pod_name", podName, "error", err)
+		} else {
+			slog.Info("Usage ended because its pod no longer exists", "pod_name", podName)
+		}
+	}
+	sort.Strings(seen)
+	if err := mysql_service.TouchInstanceUsage(seen, now); err != nil {
+		slog.Error("Failed to update usage last seen time", "error", err)
+	}
+}
+
+// budgetLimit 返回在 zone 的日预算和月预算内还能新建的该规格实例数量，最多为 replica。
+// 假设已有实例和新建的实例都运行到当前周期结束，没有剩余预算时返回错误。
+func budgetLimit(zoneId string, flavor *config.Flavor, replica int32) (int32, error) {
+	price := config.COST.Price(zoneId, flavor.Name)
+	dailyBudget, monthlyBudget := config.COST.Budget(zoneId)
+	if price == 0 || (dailyBudget == 0 && monthlyBudget == 0) {
+		return replica, nil
+	}
+
+	burn, err := mysql_service.GetHourlyBurn(zoneId)
+	if err != nil {
+		return 0, fmt.Errorf("error getting hourly burn: %w", err)
+	}
+	burn += reservedBurn(zoneId)
+
+	now := time.Now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	periods := []struct {
+		name   string
+		budget float64
+		start  time.Time
+		end    time.Time
+	}{
+		{"daily", dailyBudget, dayStart, dayStart.AddDate(0, 0, 1)},
+		{"monthly", monthlyBudget, monthStart, monthStart.AddDate(0, 1, 0)},
+	}
+
+	allowed := replica
+	for _, p := range periods {
+		if p.budget == 0 {
+			continue
+		}
+		spent, err := zoneSpend(zoneId, p.start, p.end, now)
+		if err != nil {
+			return 0, fmt.Errorf("error getting spend: %w", err)
+		}
+		hours := p.end.Sub(now).Hours()
+		left := p.budget - spent - burn*hours
+		n := int32(math.Max(0, math.Floor(left/(price*hours))))
+		if n < allowed {
+			slog.Warn("Budget limits new instances", "zone_id", zoneId, "flavor", flavor.Name, "period", p.name, "budget", p.budget, "spent", spent, "allowed", n)
+			allowed = n
+		}
+	}
+	if allowed == 0 {
+		return 0, fmt.Errorf("the budget of zone %s is exhausted", zoneId)
+	}
+	return allowed, nil
+}
+
+// reservedBurn 返回 zone 中已经预留但还没有开始计费的 Pod 每小时的费用。
+func reservedBurn(zoneId string) float64 {
+	reservationsMu.Lock()
+	defer reservationsMu.Unlock()
+	burn := 0.0
+	for podName, r := range reservations {
+		if r.zoneId != zoneId {
+			continue
+		}
+		if c := getCluster(r.cluster); c != nil {
+			if _, err := c.podLister.Pods(config.K8SNAMSPACE).Get(podName); err == nil {
+				continue
+			}
+		}
+		burn += config.COST.Price(zoneId, r.flavor)
+	}
+	return burn
+}
+
+func zoneSpend(zoneId string, from time.Time, to time.Time, now time.Time) (float64, error) {
+	spends, err := mysql_service.GetSpend(from, to, now)
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for _, spend := range spends {
+		if spend.ZoneId == zoneId {
+			total += spend.Spend
+		}
+	}
+	return total, nil
+}
+
+type CostReport struct {
+	Currency string           `json:"currency"`
+	From     string           `json:"from"`
+	To       string           `json:"to"`
+	Zones    []ZoneCostReport `json:"zones"`
+}
+
+type ZoneCostReport struct {
+	ZoneId        string    `json:"zone_id"`
+	DailyBudget   float64   `json:"daily_budget"`   // 为 0 时不限制
+	MonthlyBudget float64   `json:"monthly_budget"` // 为 0 时不限制
+	MonthSpend    float64   `json:"month_spend"`    // 当月至今的费用
+	HourlyBurn    float64   `json:"hourly_burn"`    // 仍在运行的实例每小时的费用
+	InstanceHours float64   `json:"instance_hours"`
+	Spend         float64   `json:"spend"`
+	Days          []DayCost `json:"days"`
+}
+
+type DayCost struct {
+	Date          string                      `json:"date"`
+	InstanceHours float64                     `json:"instance_hours"`
+	Spend         float64                     `json:"spend"`
+	OverBudget    bool                        `json:"over_budget"`
+	Flavors       []mysql_service.FlavorSpend `json:"flavors"`
+}
+
+// GetCostReport 按 zone 和天统计弹性实例的实例小时数和费用，并与预算对比。
+// 参数 from 和 to 为 2006-01-02 格式的日期（包含两端），默认为当月一日到今天；zone_id 为空时返回所有 zone。
+func GetCostReport(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from, to := today.AddDate(0, 0, 1-today.Day()), today
+
+	var err error
+	if s := r.URL.Query().Get("from"); s != "" {
+		if from, err = time.ParseInLocation(costDateLayout, s, now.Location()); err != nil {
+			sendBadRequest(w, "Invalid from: "+err.Error())
+			return
+		}
+	}
+	if s := r.URL.Query().Get("to"); s != "" {
+		if to, err = time.ParseInLocation(costDateLayout, s, now.Location()); err != nil {
+			sendBadRequest(w, "Invalid to: "+err.Error())
+			return
+		}
+	}
+	if to.Before(from) {
+		sendBadRequest(w, "to must not be earlier than from")
+		return
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > costReportMaxDays {
+		sendBadRequest(w, fmt.Sprintf("The report cannot cover more than %d days", costReportMaxDays))
+		return
+	}
+
+	report, err := buildCostReport(r.URL.Query().Get("zone_id"), from, to, now)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, report)
+}
+
+func buildCostReport(zoneFilter string, from time.Time, to time.Time, now time.Time) (*CostReport, error) {
+	zones := map[string]*ZoneCostReport{}
+	zoneReport := func(zoneId string) *ZoneCostReport {
+		if z, ok := zones[zoneId]; ok {
+			return z
+		}
+		z := &ZoneCostReport{ZoneId: zoneId, Days: []DayCost{}}
+		z.DailyBudget, z.MonthlyBudget = config.COST.Budget(zoneId)
+		zones[zoneId] = z
+		return z
+	}
+
+	if zoneFilter != "" {
+		zoneReport(zoneFilter)
+	} else {
+		zoneIds, err := mysql_service.GetZoneListInDB()
+		if err != nil {
+			return nil, err
+		}
+		for _, zoneId := range zoneIds {
+			zoneReport(zoneId)
+		}
+	}
+
+	spends, err := mysql_service.GetDailySpend(from, to.AddDate(0, 0, 1), now)
+	if err != nil {
+		return nil, err
+	}
+	// key 为日期和 zone。
+	days := map[[2]string]*DayCost{}
+	for _, spend := range spends {
+		if zoneFilter != "" && spend.ZoneId != zoneFilter {
+			continue
+		}
+		// 已经没有实例记录的 zone 也可能在这段时间内产生过费用。
+		zoneReport(spend.ZoneId)
+		key := [2]string{spend.Date, spend.ZoneId}
+		d, ok := days[key]
+		if !ok {
+			d = &DayCost{Date: spend.Date, Flavors: []mysql_service.FlavorSpend{}}
+			days[key] = d
+		}
+		d.InstanceHours += spend.InstanceHours
+		d.Spend += spend.Spend
+		d.Flavors = append(d.Flavors, spend.FlavorSpend)
+	}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(costDateLayout)
+		for zoneId, z := range zones {
+			d, ok := days[[2]string{date, zoneId}]
+			if !ok {
+				d = &DayCost{Date: date, Flavors: []mysql_service.FlavorSpend{}}
+			}
+			d.OverBudget = z.DailyBudget > 0 && d.Spend > z.DailyBudget
+			z.InstanceHours += d.InstanceHours
+			z.Spend += d.Spend
+			z.Days = append(z.Days, *d)
+		}
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	monthSpends, err := mysql_service.GetSpend(monthStart, monthStart.AddDate(0, 1, 0), now)
+	if err != nil {
+		return nil, err
+	}
+	for _, spend := range monthSpends {
+		if z, ok := zones[spend.ZoneId]; ok {
+			z.MonthSpend += spend.Spend
+		}
+	}
+
+	report := &CostReport{
+		Currency: config.COST.Currency,
+		From:     from.Format(costDateLayout),
+		To:       to.Format(costDateLayout),
+		Zones:    make([]ZoneCostReport, 0, len(zones)),
+	}
+	for zoneId, z := range zones {
+		if z.HourlyBurn, err = mysql_service.GetHourlyBurn(zoneId); err != nil {
+			return nil, err
+		}
+		report.Zones = append(report.Zones, *z)
+	}
+	sort.Slice(report.Zones, func(i, j int) bool { return report.Zones[i].ZoneId < report.Zones[j].ZoneId })
+	return report, nil
+}
@@ -0,0 +1,153 @@
+package apis
+
+import (
+	"manager/config"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// useCost 在测试期间替换价格和预算配置。
+func useCost(t *testing.T, cost *config.CostConfig) {
+	old := config.COST
+	config.COST = cost
+	t.Cleanup(func() { config.COST = old })
+}
+
+// reserve 在测试期间预留 Pod。
+func reserve(t *testing.T, podName string, r reservation) {
+	reservationsMu.Lock()
+	reservations[podName] = r
+	reservationsMu.Unlock()
+	t.Cleanup(func() { releaseReservation(podName) })
+}
+
+func TestReservedBurn(t *testing.T) {
+	useCost(t, &config.CostConfig{
+		Prices: map[string]float64{"default": 1, "gpu": 4},
+		Zones:  map[string]*config.ZoneCost{"huadong": {Prices: map[string]float64{"gpu": 3}}},
+	})
+	useClusters(t, newTestCluster("default", testPod("started", "huadong", time.Now())))
+
+	// 已经出现在缓存中的 Pod 已经开始计费，不再计入预留。
+	reserve(t, "started", reservation{zoneId: "huadong", flavor: "gpu", cluster: "default"})
+	reserve(t, "creating", reservation{zoneId: "huadong", flavor: "gpu", cluster: "default"})
+	reserve(t, "creating-default", reservation{zoneId: "huadong", flavor: "default", cluster: "default"})
+	reserve(t, "removed-cluster", reservation{zoneId: "huadong", flavor: "default", cluster: "removed"})
+	reserve(t, "other-zone", reservation{zoneId: "huabei", flavor: "gpu", cluster: "default"})
+
+	if burn := reservedBurn("huadong"); burn != 5 {
+		t.Errorf("expected reserved burn 5, got %v", burn)
+	}
+	if burn := reservedBurn("huabei"); burn != 4 {
+		t.Errorf("expected reserved burn 4, got %v", burn)
+	}
+}
+
+// expectBurnAndSpend 模拟 zone 中仍在计费的实例每小时的费用和当前周期已经产生的费用。
+func expectBurnAndSpend(mock sqlmock.Sqlmock, burn float64, spend float64) {
+	mock.ExpectQuery(`SELECT IFNULL\(SUM\(price\), 0\) FROM instance_usage WHERE zone_id = \?`).WithArgs("huadong").
+		WillReturnRows(sqlmock.NewRows([]string{"burn"}).AddRow(burn))
+	mock.ExpectQuery("FROM instance_usage\\s+WHERE started_at < \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"zone_id", "flavor", "hours", "spend"}).
+			AddRow("huadong", "default", spend, spend).
+			AddRow("huabei", "default", 1000, 1000))
+}
+
+func TestBudgetLimit(t *testing.T) {
+	now := time.Now()
+	dayEnd := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	hours := dayEnd.Sub(now).Hours()
+	if hours < 0.1 {
+		t.Skip("too close to the end of the day")
+	}
+	useCost(t, &config.CostConfig{
+		Prices: map[string]float64{"default": 1},
+		Zones:  map[string]*config.ZoneCost{"huadong": {DailyBudget: 100 * hours}},
+	})
+	flavor, _ := config.GetFlavor("")
+
+	// 没有价格的 zone 不受预算限制。
+	if n, err := budgetLimit("huabei", flavor, 5); err != nil || n != 5 {
+		t.Errorf("expected 5 instances without a price, got %d, %v", n, err)
+	}
+
+	// 已有 90 个实例运行到当天结束，预留 1 个，已经花掉相当于 6.5 个实例的费用，还能新建 2 个。
+	useClusters(t, newTestCluster("default"))
+	reserve(t, "creating", reservation{zoneId: "huadong", flavor: "default", cluster: "default"})
+	mock := newTestDB(t)
+	expectBurnAndSpend(mock, 90, 6.5*hours)
+	if n, err := budgetLimit("huadong", flavor, 5); err != nil || n != 2 {
+		t.Errorf("expected 2 instances within the budget, got %d, %v", n, err)
+	}
+
+	expectBurnAndSpend(mock, 90, 9.5*hours)
+	if n, err := budgetLimit("huadong", flavor, 5); err == nil {
+		t.Errorf("expected the budget to be exhausted, got %d", n)
+	}
+}
+
+func TestSyncUsage(t *testing.T) {
+	now := time.Now()
+	unhealthy := newTestCluster("backup")
+	unhealthy.healthy = false
+	useClusters(t, newTestCluster("default", testPod("running", "huadong", now)), unhealthy)
+
+	mock := newTestDB(t)
+	mock.ExpectQuery("SELECT pod_name, cluster FROM instance_usage WHERE ended_at IS NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"pod_name", "cluster"}).
+			AddRow("running", "default").
+			AddRow("vanished", "default").
+			AddRow("unknown", "backup"))
+	// 不存在的 Pod 以最后一次看到的时间结束计费，不健康集群中的记录不处理。
+	mock.ExpectExec(`UPDATE instance_usage SET ended_at = IFNULL\(last_seen_at, started_at\) WHERE pod_name = \?`).WithArgs("vanished").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE instance_usage SET last_seen_at = \? WHERE ended_at IS NULL AND pod_name IN \(\?\)`).
+		WithArgs(now.Format("2006-01-02 15:04:05"), "running").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	syncUsage(now)
+}
+
+func TestBuildCostReportGroupsDays(t *testing.T) {
+	useCost(t, &config.CostConfig{Zones: map[string]*config.ZoneCost{"huadong": {DailyBudget: 10}}})
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from := today.AddDate(0, 0, -2)
+	day := func(d time.Time) string { return d.Format(costDateLayout) }
+
+	mock := newTestDB(t)
+	// 所有天的费用在一次查询中按天、zone 和规格汇总。
+	mock.ExpectQuery(`FROM \(SELECT \? AS day, \? AS day_start, \? AS day_end UNION ALL SELECT .* UNION ALL SELECT .*\) d\s+JOIN instance_usage u`).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "zone_id", "flavor", "hours", "spend"}).
+			AddRow(day(from), "huadong", "default", 10, 4).
+			AddRow(day(from), "huadong", "gpu", 5, 8).
+			AddRow(day(today), "huadong", "default", 2, 1).
+			AddRow(day(today), "huabei", "default", 2, 1))
+	mock.ExpectQuery("FROM instance_usage\\s+WHERE started_at < \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"zone_id", "flavor", "hours", "spend"}).AddRow("huadong", "default", 20, 20))
+	mock.ExpectQuery(`SELECT IFNULL\(SUM\(price\), 0\) FROM instance_usage`).WithArgs("huadong").
+		WillReturnRows(sqlmock.NewRows([]string{"burn"}).AddRow(0.5))
+
+	report, err := buildCostReport("huadong", from, today, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Zones) != 1 {
+		t.Fatalf("unexpected zones %+v", report.Zones)
+	}
+	z := report.Zones[0]
+	if len(z.Days) != 3 || z.MonthSpend != 20 || z.HourlyBurn != 0.5 || z.Spend != 13 || math.Abs(z.InstanceHours-17) > 1e-9 {
+		t.Fatalf("unexpected report %+v", z)
+	}
+	if d := z.Days[0]; d.Date != day(from) || d.Spend != 12 || !d.OverBudget || len(d.Flavors) != 2 {
+		t.Errorf("unexpected first day %+v", d)
+	}
+	if d := z.Days[1]; d.Spend != 0 || d.OverBudget || len(d.Flavors) != 0 {
+		t.Errorf("unexpected second day %+v", d)
+	}
+	if d := z.Days[2]; d.Date != day(today) || d.Spend != 1 {
+		t.Errorf("unexpected last day %+v", d)
+	}
+}
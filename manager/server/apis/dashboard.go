@@ -0,0 +1,307 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	mysql_service "manager/mysql/service"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	dashboardStreamInterval = 5 * time.Second
+	dashboardDecisionLimit  = 50
+	dashboardEventBuffer    = 64
+)
+
+type DashboardZone struct {
+	ZoneId string   `json:"zone_id"`
+	Sites  []string `json:"sites"`
+}
+
+// InstanceSnapshot 是 zone 中实例数量的快照，各 map 的值均为 状态 -> 数量。
+// 接入终端的弹性实例同时计入所在站点和 Center。
+type InstanceSnapshot struct {
+	ZoneId  string                            `json:"zone_id"`
+	Time    string                            `json:"time"`
+	Total   map[string]int                    `json:"total"`
+	Center  map[string]int                    `json:"center"`
+	Sites   map[string]map[string]int         `json:"sites"`
+	Flavors map[string]map[string]int         `json:"flavors"`
+	Counts  []mysql_service.SiteInstanceCount `json:"counts"`
+}
+
+// pathZone 返回路径中的 zone，zone 不存在时返回 404。
+func pathZone(w http.ResponseWriter, r *http.Request) (string, bool) {
+	zoneId := mux.Vars(r)["zone"]
+	zones, err := mysql_service.GetZoneListInDB()
+	if err != nil {
+		sendInternalError(w, err)
+		return "", false
+	}
+	if !slices.Contains(zones, zoneId) {
+		sendNotFound(w, "Zone "+zoneId+" not found")
+		return "", false
+	}
+	return zoneId, true
+}
+
+// DashboardZones 返回所有 zone 及其边缘站点。
+func DashboardZones(w http.ResponseWriter, r *http.Request) {
+	zoneIds, err := mysql_service.GetZoneListInDB()
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	slices.Sort(zoneIds)
+	zones := make([]DashboardZone, 0, len(zoneIds))
+	for _, zoneId := range zoneIds {
+		sites, err := mysql_service.GetSiteList(zoneId)
+		if err != nil {
+			sendInternalError(w, err)
+			return
+		}
+		zones = append(zones, DashboardZone{ZoneId: zoneId, Sites: sites})
+	}
+	sendOK(w, zones)
+}
+
+func instanceSnapshot(zoneId string) (*InstanceSnapshot, error) {
+	counts, err := mysql_service.CountInstancesBySite(zoneId)
+	if err != nil {
+		return nil, err
+	}
+	s := &InstanceSnapshot{
+		ZoneId:  zoneId,
+		Time:    time.Now().Format(queryTimeLayout),
+		Total:   map[string]int{},
+		Center:  map[string]int{},
+		Sites:   map[string]map[string]int{},
+		Flavors: map[string]map[string]int{},
+		Counts:  counts,
+	}
+	for _, c := range counts {
+		s.Total[c.Status] += c.Count
+		if c.IsElastic == 1 {
+			s.Center[c.Status] += c.Count
+		}
+		if c.SiteId != "null" {
+			if s.Sites[c.SiteId] == nil {
+				s.Sites[c.SiteId] = map[string]int{}
+			}
+			s.Sites[c.SiteId][c.Status] += c.Count
+		}
+		if s.Flavors[c.Flavor] == nil {
+			s.Flavors[c.Flavor] = map[string]int{}
+		}
+		s.Flavors[c.Flavor][c.Status] += c.Count
+	}
+	return s, nil
+}
+
+// DashboardInstances 返回 zone 中按状态、站点和规格统计的实例数量。
+func DashboardInstances(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	snapshot, err := instanceSnapshot(zoneId)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, snapshot)
+}
+
+// DashboardDecisions 返回 zone 最近的决策记录，limit 默认为 50。
+func DashboardDecisions(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	limit := dashboardDecisionLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > decisionMaxLimit {
+			sendBadRequest(w, fmt.Sprintf("limit must be between 1 and %d", decisionMaxLimit))
+			return
+		}
+	}
+	decisions, err := mysql_service.ListRecentDecisions(zoneId, limit)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, decisions)
+}
+
+// DashboardForecasts 返回 zone 每分钟的预测实例数和实际实例数，from 和 to 默认为最近 6 小时。
+func DashboardForecasts(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := parseQueryTimeRange(r.URL.Query(), 6*time.Hour)
+	if err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+	records, err := mysql_service.GetBounceRecords(zoneId, from.Format(queryTimeLayout), to.Format(queryTimeLayout))
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, records)
+}
+
+// DashboardLoginFailures 返回 zone 各站点的登录失败率，from 和 to 默认为最近 1 小时。
+func DashboardLoginFailures(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := parseQueryTimeRange(r.URL.Query(), time.Hour)
+	if err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+	sites, err := mysql_service.GetLoginFailures(zoneId, from, to)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, sites)
+}
+
+// eventHub 将 webhook 事件广播给仪表盘的事件流，订阅者处理不及时时丢弃事件。
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan *WebhookEvent]struct{}
+}
+
+var dashboardEvents = &eventHub{subscribers: make(map[chan *WebhookEvent]struct{})}
+
+func (h *eventHub) subscribe() (<-chan *WebhookEvent, func()) {
+	ch := make(chan *WebhookEvent, dashboardEventBuffer)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+	}
+}
+
+func (h *eventHub) publish(event *WebhookEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// eventZone 返回事件所属的 zone。
+func eventZone(event *WebhookEvent) string {
+	switch data := event.Data.(type) {
+	case *InstanceEventData:
+		return data.ZoneId
+	case *OperationEventData:
+		return data.ZoneId
+	case *MaintenanceEventData:
+		return data.ZoneId
+	}
+	return ""
+}
+
+// DashboardStream 以 Server-Sent Events 推送 zone 的实时数据：
+// 连接建立时以及之后每 5 秒发送 snapshot 事件（实例数量没有变化时不发送），
+// webhook 事件发生时立即转发。
+func DashboardStream(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendInternalError(w, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	events, unsubscribe := dashboardEvents.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var last []byte
+	sendSnapshot := func() error {
+		snapshot, err := instanceSnapshot(zoneId)
+		if err != nil {
+			return err
+		}
+		// 只比较数量，不比较时间。
+		counts, _ := json.Marshal(snapshot.Counts)
+		if bytes.Equal(counts, last) {
+			return nil
+		}
+		last = counts
+		return writeStreamEvent(w, flusher, "snapshot", "", snapshot)
+	}
+
+	logger := slog.With("zone_id", zoneId)
+	if err := sendSnapshot(); err != nil {
+		logger.Warn("Failed to send dashboard snapshot", "error", err)
+		return
+	}
+	ticker := time.NewTicker(dashboardStreamInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if err := sendSnapshot(); err != nil {
+				logger.Warn("Failed to send dashboard snapshot", "error", err)
+				return
+			}
+		case event := <-events:
+			if eventZone(event) != zoneId {
+				continue
+			}
+			if err := writeStreamEvent(w, flusher, event.Type, event.Id, event); err != nil {
+				logger.Warn("Failed to send dashboard event", "event_id", event.Id, "error", err)
+				return
+			}
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, flusher http.Flusher, name string, id string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
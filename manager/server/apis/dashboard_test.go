@@ -0,0 +1,189 @@
+package apis
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+// expectZones 模拟数据库中的实例表，instance_usage 不是 zone。
+func expectZones(mock sqlmock.Sqlmock, zones ...string) {
+	rows := sqlmock.NewRows([]string{"table"}).AddRow("instance_usage")
+	for _, zoneId := range zones {
+		rows.AddRow("instance_" + zoneId)
+	}
+	mock.ExpectQuery("SHOW TABLES LIKE 'instance_%'").WillReturnRows(rows)
+}
+
+// expectInstanceCounts 模拟 huadong 中一个站点的固定实例和中心的弹性实例。
+func expectInstanceCounts(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT site_id, flavor, is_elastic, status, COUNT\\(\\*\\) FROM instance_huadong").
+		WillReturnRows(sqlmock.NewRows([]string{"site_id", "flavor", "is_elastic", "status", "count"}).
+			AddRow("null", "default", 1, "available", 2).
+			AddRow("site-1", "default", 0, "available", 3).
+			AddRow("site-1", "default", 1, "using", 1).
+			AddRow("site-1", "gpu", 0, "using", 4))
+}
+
+func TestDashboardZones(t *testing.T) {
+	mock := newTestDB(t)
+	expectZones(mock, "huadong")
+	mock.ExpectQuery("SELECT DISTINCT site_id FROM instance_huadong WHERE is_elastic = 0").
+		WillReturnRows(sqlmock.NewRows([]string{"site_id"}).AddRow("site-1").AddRow("site-2"))
+
+	var zones []DashboardZone
+	w, code := serve(t, DashboardZones, httptest.NewRequest(http.MethodGet, "/dashboard/zones", nil), nil, &zones)
+	if w.Code != http.StatusOK || code != 200 {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+	if len(zones) != 1 || zones[0].ZoneId != "huadong" || len(zones[0].Sites) != 2 {
+		t.Errorf("unexpected zones %+v", zones)
+	}
+}
+
+func TestDashboardInstances(t *testing.T) {
+	mock := newTestDB(t)
+	expectZones(mock, "huadong")
+	expectInstanceCounts(mock)
+
+	var snapshot InstanceSnapshot
+	r := httptest.NewRequest(http.MethodGet, "/dashboard/zones/huadong/instances", nil)
+	w, code := serve(t, DashboardInstances, r, map[string]string{"zone": "huadong"}, &snapshot)
+	if w.Code != http.StatusOK || code != 200 {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+	// 接入终端的弹性实例同时计入站点和 Center。
+	if snapshot.Total["available"] != 5 || snapshot.Total["using"] != 5 {
+		t.Errorf("unexpected total %v", snapshot.Total)
+	}
+	if snapshot.Center["available"] != 2 || snapshot.Center["using"] != 1 {
+		t.Errorf("unexpected center %v", snapshot.Center)
+	}
+	if site := snapshot.Sites["site-1"]; site["available"] != 3 || site["using"] != 5 || len(snapshot.Sites) != 1 {
+		t.Errorf("unexpected sites %v", snapshot.Sites)
+	}
+	if snapshot.Flavors["gpu"]["using"] != 4 || snapshot.Flavors["default"]["available"] != 5 {
+		t.Errorf("unexpected flavors %v", snapshot.Flavors)
+	}
+}
+
+func TestDashboardUnknownZone(t *testing.T) {
+	mock := newTestDB(t)
+	expectZones(mock, "huadong")
+
+	var detail string
+	r := httptest.NewRequest(http.MethodGet, "/dashboard/zones/usage/instances", nil)
+	w, code := serve(t, DashboardInstances, r, map[string]string{"zone": "usage"}, &detail)
+	if w.Code != http.StatusNotFound || code != 404 || !strings.Contains(detail, "usage") {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+}
+
+func TestDashboardDecisionsLimit(t *testing.T) {
+	for _, limit := range []string{"0", "abc", "10001"} {
+		mock := newTestDB(t)
+		expectZones(mock, "huadong")
+		var detail string
+		r := httptest.NewRequest(http.MethodGet, "/dashboard/zones/huadong/decisions?limit="+limit, nil)
+		w, code := serve(t, DashboardDecisions, r, map[string]string{"zone": "huadong"}, &detail)
+		if w.Code != http.StatusBadRequest || code != 400 {
+			t.Errorf("expected 400 for limit %s, got %d %s", limit, w.Code, w.Body)
+		}
+	}
+
+	mock := newTestDB(t)
+	expectZones(mock, "huadong")
+	mock.ExpectQuery("FROM decisions WHERE zone_id = \\? ORDER BY created_at DESC").WithArgs("huadong", 2).
+		WillReturnRows(sqlmock.NewRows(nil))
+	r := httptest.NewRequest(http.MethodGet, "/dashboard/zones/huadong/decisions?limit=2", nil)
+	w, code := serve(t, DashboardDecisions, r, map[string]string{"zone": "huadong"}, new(interface{}))
+	if w.Code != http.StatusOK || code != 200 {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+}
+
+// streamEvent 是事件流中的一个事件。
+type streamEvent struct {
+	name string
+	id   string
+	data string
+}
+
+// readStreamEvent 从事件流中读取下一个事件。
+func readStreamEvent(reader *bufio.Reader) (streamEvent, error) {
+	var e streamEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return e, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return e, nil
+		case strings.HasPrefix(line, "event: "):
+			e.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestDashboardStream(t *testing.T) {
+	mock := newTestDB(t)
+	expectZones(mock, "huadong")
+	expectInstanceCounts(mock)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		DashboardStream(w, mux.SetURLVars(r, map[string]string{"zone": "huadong"}))
+	}))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// 连接建立时先发送一次快照。
+	reader := bufio.NewReader(resp.Body)
+	e, err := readStreamEvent(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot InstanceSnapshot
+	if err := json.Unmarshal([]byte(e.data), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if e.name != "snapshot" || snapshot.ZoneId != "huadong" || snapshot.Total["using"] != 5 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	// 其他 zone 的事件不转发。
+	dashboardEvents.publish(&WebhookEvent{Id: "event-1", Type: EventInstanceReady, Data: &InstanceEventData{ZoneId: "huabei"}})
+	dashboardEvents.publish(&WebhookEvent{Id: "event-2", Type: EventInstanceReady, Data: &InstanceEventData{ZoneId: "huadong", InstanceId: "instance-1"}})
+	done := make(chan streamEvent, 1)
+	go func() {
+		e, _ := readStreamEvent(reader)
+		done <- e
+	}()
+	select {
+	case e := <-done:
+		if e.name != EventInstanceReady || e.id != "event-2" || !strings.Contains(e.data, "instance-1") {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(dashboardStreamInterval / 2):
+		t.Fatal("event was not forwarded")
+	}
+}
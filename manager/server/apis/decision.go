@@ -0,0 +1,196 @@
+package apis
+
+import (
+	"common/decision"
+	"encoding/json"
+	"fmt"
+	mysql_service "manager/mysql/service"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	queryTimeLayout      = "2006-01-02 15:04:05"
+	queryDateLayout      = "2006-01-02"
+	decisionDefaultLimit = 1000
+	decisionMaxLimit     = 10000
+)
+
+// DecisionAction 是 manager 针对一轮预测执行的扩缩容操作，Flavors 为各规格的结果。
+type DecisionAction struct {
+	OperationId string                  `json:"operation_id"`
+	Status      string                  `json:"status"`
+	Message     string                  `json:"message"`
+	Flavors     map[string]*ScaleResult `json:"flavors"`
+}
+
+type DecisionExplanation struct {
+	Decision *mysql_service.Decision   `json:"decision"`
+	Inputs   map[string]interface{}    `json:"inputs"`
+	Steps    []decision.Step           `json:"steps"`
+	Zone     *mysql_service.Decision   `json:"zone,omitempty"`  // 站点记录所在轮次的 zone 记录
+	Sites    []*mysql_service.Decision `json:"sites,omitempty"` // zone 记录所在轮次的站点记录
+	Action   *DecisionAction           `json:"action,omitempty"`
+	// Explanation 是按顺序排列的可读说明，从预测值一直到 manager 的扩缩容结果。
+	Explanation []string `json:"explanation"`
+}
+
+// parseQueryTime 解析 2006-01-02 15:04:05 或 2006-01-02 格式的时间，只有日期时 end 为 true 表示取当天结束。
+func parseQueryTime(s string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(queryTimeLayout, s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(queryDateLayout, s, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("%q is neither %s nor %s", s, queryTimeLayout, queryDateLayout)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parseQueryTimeRange 解析查询参数 from 和 to，默认为截至当前的 window。
+func parseQueryTimeRange(query url.Values, window time.Duration) (time.Time, time.Time, error) {
+	to := time.Now()
+	from := to.Add(-window)
+
+	var err error
+	if s := query.Get("from"); s != "" {
+		if from, err = parseQueryTime(s, false); err != nil {
+			return from, to, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if s := query.Get("to"); s != "" {
+		if to, err = parseQueryTime(s, true); err != nil {
+			return from, to, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be earlier than to")
+	}
+	return from, to, nil
+}
+
+// ListDecisions 查询决策记录。
+// 参数 zone 为空时返回所有 zone；from 和 to 为 2006-01-02 15:04:05 或 2006-01-02 格式，默认为最近 24 小时；
+// limit 默认为 1000，最大为 10000。
+func ListDecisions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parseQueryTimeRange(query, 24*time.Hour)
+	if err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+	limit := decisionDefaultLimit
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > decisionMaxLimit {
+			sendBadRequest(w, fmt.Sprintf("limit must be between 1 and %d", decisionMaxLimit))
+			return
+		}
+	}
+
+	decisions, err := mysql_service.ListDecisions(query.Get("zone"), from, to, limit)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, decisions)
+}
+
+// ExplainDecision 说明一条决策记录是怎么得出的，以及 manager 最终执行了什么操作。
+func ExplainDecision(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	decision, err := mysql_service.GetDecision(id)
+	if err == nil && decision == nil {
+		sendNotFound(w, "Decision "+id+" not found")
+		return
+	}
+	var explanation *DecisionExplanation
+	if err == nil {
+		explanation, err = explainDecision(decision)
+	}
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, explanation)
+}
+
+func explainDecision(record *mysql_service.Decision) (*DecisionExplanation, error) {
+	var detail decision.Detail
+	if err := json.Unmarshal([]byte(record.Detail), &detail); err != nil {
+		return nil, fmt.Errorf("error decoding detail of decision %s: %w", record.Id, err)
+	}
+	e := &DecisionExplanation{Decision: record, Inputs: detail.Inputs, Steps: detail.Steps}
+
+	cycle, err := mysql_service.ListCycleDecisions(record.ZoneId, record.CorrelationId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying decisions of cycle %s: %w", record.CorrelationId, err)
+	}
+	for _, d := range cycle {
+		if d.Kind == mysql_service.DecisionKindZone {
+			if record.Kind != mysql_service.DecisionKindZone {
+				e.Zone = d
+			}
+		} else if record.Kind == mysql_service.DecisionKindZone {
+			e.Sites = append(e.Sites, d)
+		}
+	}
+
+	if record.Kind == mysql_service.DecisionKindZone {
+		e.Explanation = append(e.Explanation, fmt.Sprintf("Zone %s requested %d missing instances from %d site records", record.ZoneId, record.Missing, len(e.Sites)))
+	} else {
+		e.Explanation = append(e.Explanation, fmt.Sprintf("Site %s flavor %s in zone %s", record.SiteId, record.Flavor, record.ZoneId))
+	}
+	for _, step := range detail.Steps {
+		e.Explanation = append(e.Explanation, fmt.Sprintf("%s => %g", step.Description, step.Value))
+	}
+
+	if record.OperationId == "" {
+		e.Explanation = append(e.Explanation, "No operation was accepted by the manager for this cycle")
+		return e, nil
+	}
+	op, err := mysql_service.GetOperation(record.OperationId)
+	if err != nil {
+		return nil, err
+	}
+	if op == nil {
+		e.Explanation = append(e.Explanation, fmt.Sprintf("Operation %s no longer exists", record.OperationId))
+		return e, nil
+	}
+	e.Action = &DecisionAction{OperationId: op.Id, Status: op.Status, Message: op.Message, Flavors: map[string]*ScaleResult{}}
+	if op.Result != "" {
+		if err := json.Unmarshal([]byte(op.Result), &e.Action.Flavors); err != nil {
+			return nil, fmt.Errorf("error decoding result of operation %s: %w", op.Id, err)
+		}
+	}
+
+	flavors := make([]string, 0, len(e.Action.Flavors))
+	for flavor := range e.Action.Flavors {
+		// 站点记录只关心自己的规格。
+		if record.Kind == mysql_service.DecisionKindZone || flavor == record.Flavor {
+			flavors = append(flavors, flavor)
+		}
+	}
+	sort.Strings(flavors)
+	e.Explanation = append(e.Explanation, fmt.Sprintf("Operation %s %s", op.Id, op.Status))
+	for _, flavor := range flavors {
+		e.Explanation = append(e.Explanation, explainScaleResult(flavor, e.Action.Flavors[flavor]))
+	}
+	return e, nil
+}
+
+// explainScaleResult 说明 manager 对一个规格的处理：缺少的实例数减去中心可用的弹性实例数即为申请（正数）或回收（负数）的数量。
+func explainScaleResult(flavor string, r *ScaleResult) string {
+	if r.Action == "" {
+		return fmt.Sprintf("%s: %d available in center, %s", flavor, r.Available, r.Message)
+	}
+	return fmt.Sprintf("%s: %d available in center, %s %d requested, %d succeeded (%d promoted from standby), %d failed: %s",
+		flavor, r.Available, r.Action, r.Requested, r.Succeeded, r.Promoted, r.Failed, r.Message)
+}
@@ -1,223 +1,544 @@
 package apis
 
 import (
+	instancestate "common/instance"
+	"common/logging"
+	"common/tracing"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
 	"manager/config"
+	"manager/metrics"
 	"net/http"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/util/uuid"
 
 	mysql_service "manager/mysql/service"
 )
 
+var tracer = tracing.Tracer("manager")
+
 type InstanceManageRequest struct {
-	ZoneId  string `json:"zone_id"`
-	Missing *int32 `json:"missing"`
+	ZoneId  string           `json:"zone_id"`
+	Missing *int32           `json:"missing"` // 默认规格缺少的实例数
+	Flavors map[string]int32 `json:"flavors"` // 各规格缺少的实例数，key 为规格名称
+
+	// 幂等键，例如 zone 加上预测周期的时间戳，也可以通过 Idempotency-Key 请求头传入。
+	// 相同的键在 IDEMPOTENCYKEYTTL 内只会触发一次扩缩容，重复请求返回第一次创建的操作。
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
+// getRequestData 解析 /instance/manage 的请求，zone_id 和缺少的实例数已经由路由中间件按 OpenAPI 文档校验。
+// 配置中没有的规格在执行操作时跳过。
 func getRequestData(w http.ResponseWriter, r *http.Request) (InstanceManageRequest, error) {
 	reqBody := InstanceManageRequest{}
 	err := json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
 
-		SendErrorResponse(w, &ErrorCodeWithMessage{
-			HttpStatus: http.StatusBadRequest,
-			ErrorCode:  400,
-			Message:    "Bad request",
-		}, err.Error())
+		sendBadRequest(w, err.Error())
 		return reqBody, fmt.Errorf("failed to decode request: %v", err)
 	}
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		reqBody.IdempotencyKey = key
+	}
 
-	if reqBody.Missing == nil || reqBody.ZoneId == "" {
-		fmt.Println("Number or zone_id is not specificed")
-		SendErrorResponse(w, &ErrorCodeWithMessage{
-			HttpStatus: http.StatusBadRequest,
-			ErrorCode:  400,
-			Message:    "Bad request",
-		}, "Number or zone_id is not specificed")
-		return reqBody, fmt.Errorf("zone_id or missing is not specificed")
+	// missing 等价于默认规格的缺少数量。
+	if reqBody.Flavors == nil {
+		reqBody.Flavors = make(map[string]int32)
+	}
+	if reqBody.Missing != nil {
+		if _, ok := reqBody.Flavors[config.DefaultFlavor]; !ok {
+			reqBody.Flavors[config.DefaultFlavor] = *reqBody.Missing
+		}
 	}
 	return reqBody, nil
 }
 
+type InstanceManageResponse struct {
+	OperationId string `json:"operation_id"`
+	Replayed    bool   `json:"replayed"` // 是否为重复请求，重复请求不会再次扩缩容
+}
+
+// InstanceManage 创建一次扩缩容操作后立即返回 202 和操作 ID，扩缩容在后台按 zone 排队执行，
+// 进度通过 GET /operations/{id} 查询。
 func InstanceManage(w http.ResponseWriter, r *http.Request) {
 	reqBody, err := getRequestData(w, r)
 	if err != nil {
-		log.Printf("Failed to get request data: %v", err)
+		logging.FromContext(r.Context()).Warn("Failed to get request data", "error", err)
 		return
 	}
 
-	// 获取中心站点可用弹性实例之前刷新一遍实例状态
-	log.Println("Check started")
-	if err := ensureK8sDBConsistency(reqBody.ZoneId); err != nil {
-		log.Printf("Failed to synchronize instance status: %v", err)
-		SendErrorResponse(w, &ErrorCodeWithMessage{
-			HttpStatus: http.StatusInternalServerError,
-			ErrorCode:  500,
-			Message:    "Internal server error",
-		}, err.Error())
+	request, err := json.Marshal(reqBody)
+	if err != nil {
+		sendInternalError(w, err)
 		return
 	}
-	log.Println("Check ended")
-
-	availableInstances, err := mysql_service.GetAvailableInstanceInCenter(reqBody.ZoneId)
+	op := newOperation(r)
+	logger := op.logger(reqBody.ZoneId)
+	// 入库之前就登记为执行中，相同幂等键的并发请求读到这个操作时可以重放。
+	liveOperations.Store(op.id, struct{}{})
+	enqueued := false
+	defer func() {
+		if !enqueued {
+			liveOperations.Delete(op.id)
+		}
+	}()
+	if reqBody.IdempotencyKey == "" {
+		err = mysql_service.InsertOperation(op.id, reqBody.ZoneId, OperationPending, string(request))
+	} else {
+		var existing *mysql_service.IdempotentOperation
+		hash := requestHash(reqBody)
+		existing, err = mysql_service.InsertOperationWithKey(reqBody.IdempotencyKey, config.IDEMPOTENCYKEYTTL, hash, op.id, reqBody.ZoneId, OperationPending, string(request),
+			func(existing *mysql_service.IdempotentOperation) bool {
+				if replayable(existing) {
+					return true
+				}
+				logger.Info("Taking over idempotency key", "idempotency_key", reqBody.IdempotencyKey, "existing_operation_id", existing.OperationId, "existing_status", existing.Status)
+				return false
+			})
+		if err == nil && existing != nil {
+			if existing.RequestHash != hash {
+				sendConflict(w, fmt.Sprintf("Idempotency key %s is already used by a different request", reqBody.IdempotencyKey))
+				return
+			}
+			logger.Info("Duplicate request", "idempotency_key", reqBody.IdempotencyKey, "existing_operation_id", existing.OperationId)
+			w.Header().Set("Location", fmt.Sprintf("/operations/%s", existing.OperationId))
+			sendAccepted(w, &InstanceManageResponse{OperationId: existing.OperationId, Replayed: true})
+			return
+		}
+	}
 	if err != nil {
-		log.Printf("Failed to get available instances and delete them: %v", err)
-		SendErrorResponse(w, &ErrorCodeWithMessage{
-			HttpStatus: http.StatusInternalServerError,
-			ErrorCode:  500,
-			Message:    "Internal server error",
-		}, err.Error())
+		logger.Error("Failed to create operation", "error", err)
+		sendInternalError(w, err)
 		return
 	}
 
-	replica := *reqBody.Missing - availableInstances
+	// 同一个 zone 的操作排队执行，排队期间操作保持 pending 状态。
+	enqueued = true
+	if ahead := enqueueZone(reqBody.ZoneId, func() { runInstanceManage(op, reqBody) }); ahead > 0 {
+		logger.Info("Operation queued", "ahead", ahead)
+	}
 
-	log.Println("Manage started")
-	defer log.Println("Manage ended")
-	if replica == 0 {
-		SendHttpResponse(w, &Response{
-			StatusCode: 200,
-			Message:    "OK",
-			Data:       "Replica is 0, there is no need to apply or release instances",
-		}, http.StatusOK)
-		log.Printf("%s: Replica is 0, there is no need to apply or release instances", reqBody.ZoneId)
-	} else if replica > 0 {
-		if err := apply(reqBody.ZoneId, replica); err != nil {
-			log.Printf("Failed to apply instances: %v", err)
-			SendErrorResponse(w, &ErrorCodeWithMessage{
-				HttpStatus: http.StatusInternalServerError,
-				ErrorCode:  500,
-				Message:    "Internal server error",
-			}, err.Error())
-			return
+	w.Header().Set("Location", fmt.Sprintf("/operations/%s", op.id))
+	sendAccepted(w, &InstanceManageResponse{OperationId: op.id})
+}
+
+// replayable 判断幂等键对应的操作能否重放：已经成功的操作，以及仍在本进程中排队或执行的操作。
+// 失败的操作和上一个主副本遗留的操作不能重放，由新的请求接管该键重新扩缩容。
+func replayable(existing *mysql_service.IdempotentOperation) bool {
+	switch existing.Status {
+	case OperationSucceeded:
+		return true
+	case OperationPending, OperationRunning:
+		_, ok := liveOperations.Load(existing.OperationId)
+		return ok
+	}
+	return false
+}
+
+// requestHash 计算请求内容的摘要，用于判断相同幂等键的请求内容是否一致。
+func requestHash(reqBody InstanceManageRequest) string {
+	// json.Marshal 会对 map 的 key 排序，摘要与规格顺序无关。
+	flavors, _ := json.Marshal(reqBody.Flavors)
+	sum := sha256.Sum256([]byte(reqBody.ZoneId + "/" + string(flavors)))
+	return hex.EncodeToString(sum[:])
+}
+
+func runInstanceManage(op *operation, reqBody InstanceManageRequest) {
+	ctx, span := tracer.Start(op.ctx, "manager.operation", trace.WithAttributes(
+		attribute.String("zone_id", reqBody.ZoneId),
+		attribute.String("operation_id", op.id),
+	))
+	logger := op.logger(reqBody.ZoneId)
+	if err := mysql_service.UpdateOperation(op.id, OperationRunning, "", ""); err != nil {
+		logger.Error("Failed to update operation", "error", err)
+	}
+
+	status, results, message := OperationSucceeded, make(map[string]*ScaleResult), ""
+	defer func() {
+		// 扩缩容过程中 panic 时操作失败，不能按成功记录，zone 队列继续执行后面的操作。
+		if r := recover(); r != nil {
+			logger.Error("Operation panicked", "panic", r, "stack", string(debug.Stack()))
+			status, message = OperationFailed, fmt.Sprintf("panic: %v", r)
+		}
+		result, _ := json.Marshal(results)
+		if err := mysql_service.UpdateOperation(op.id, status, string(result), message); err != nil {
+			logger.Error("Failed to update operation", "error", err)
+		}
+		// 先记录最终状态再移出，并发的重复请求不会把刚结束的操作当作遗留操作接管。
+		liveOperations.Delete(op.id)
+		logger.Info("Operation completed", "status", status, "message", message)
+		if status == OperationFailed {
+			span.SetStatus(codes.Error, message)
+		}
+		span.End()
+		emitEvent(EventOperationCompleted, &OperationEventData{
+			OperationId: op.id,
+			ZoneId:      reqBody.ZoneId,
+			Status:      status,
+			Result:      results,
+			Message:     message,
+		})
+	}()
+
+	// 获取中心站点可用弹性实例之前刷新一遍实例状态
+	logger.Debug("Check started")
+	if err := ensureK8sDBConsistency(ctx, reqBody.ZoneId); err != nil {
+		logger.Error("Failed to synchronize instance status", "error", err)
+		status, message = OperationFailed, err.Error()
+		return
+	}
+	logger.Debug("Check ended")
+
+	// 按规格名称排序，保证每次处理的顺序一致。
+	flavors := make([]string, 0, len(reqBody.Flavors))
+	for flavor := range reqBody.Flavors {
+		flavors = append(flavors, flavor)
+	}
+	sort.Strings(flavors)
+
+	// 某个规格失败不影响其他规格。
+	var errs []string
+	for _, flavorName := range flavors {
+		// 数据库中可能还有已经从配置中移除的规格，跳过这些规格，不影响整个 zone 的扩缩容。
+		flavor, ok := config.GetFlavor(flavorName)
+		if !ok {
+			logger.Warn("Skipping unknown flavor", "flavor", flavorName, "missing", reqBody.Flavors[flavorName])
+			results[flavorName] = &ScaleResult{Message: fmt.Sprintf("Unknown flavor %s, skipped", flavorName)}
+			continue
 		}
-		SendHttpResponse(w, &Response{
-			StatusCode: 200,
-			Message:    "OK",
-			Data:       "All instances applied successfully",
-		}, http.StatusOK)
-		log.Printf("%s: All instances applied successfully", reqBody.ZoneId)
+		result, err := manageFlavor(ctx, reqBody.ZoneId, flavor, reqBody.Flavors[flavorName], op)
+		results[flavorName] = result
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", flavorName, err))
+		}
+	}
+	if len(errs) > 0 {
+		status, message = OperationFailed, strings.Join(errs, "; ")
+	}
+}
+
+// InstanceResult 是一个实例的扩缩容结果。
+type InstanceResult struct {
+	InstanceId string `json:"instance_id"`
+	PodName    string `json:"pod_name"`
+	Cluster    string `json:"cluster"`
+	Status     string `json:"status"`   // ready、released 或 failed
+	Attempts   int    `json:"attempts"` // 创建或删除的尝试次数
+	Error      string `json:"error,omitempty"`
+}
 
+// ScaleResult 是一个规格的扩缩容结果，部分实例失败时成功的实例仍然保留。
+type ScaleResult struct {
+	Action    string           `json:"action"`    // apply、release，不需要扩缩容时为空
+	Available int32            `json:"available"` // 扩缩容前中心可用的弹性实例数
+	Requested int32            `json:"requested"`
+	Succeeded int32            `json:"succeeded"`
+	Promoted  int32            `json:"promoted"` // 由热备实例提升的数量，包含在 succeeded 中
+	Failed    int32            `json:"failed"`
+	Message   string           `json:"message"`
+	Instances []InstanceResult `json:"instances"`
+}
+
+func (r *ScaleResult) add(instance InstanceResult) {
+	r.Instances = append(r.Instances, instance)
+	if instance.Status == InstanceFailed {
+		r.Failed++
 	} else {
-		if err := release(reqBody.ZoneId, -replica); err != nil {
-			log.Printf("Failed to release instances: %v", err)
-			SendErrorResponse(w, &ErrorCodeWithMessage{
-				HttpStatus: http.StatusInternalServerError,
-				ErrorCode:  500,
-				Message:    "Internal server error",
-			}, err.Error())
-			return
+		r.Succeeded++
+	}
+}
+
+// err 在有实例失败时返回错误。
+func (r *ScaleResult) err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d instances failed to %s", r.Failed, r.Requested, r.Action)
+}
+
+// retry 执行 fn 直到成功或达到 SCALEMAXATTEMPTS 次，每次失败后按指数退避等待，返回尝试次数。
+func retry(fn func(attempt int) error) (int, error) {
+	backoff := config.SCALERETRYBACKOFF
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil || attempt >= config.SCALEMAXATTEMPTS {
+			return attempt, err
 		}
-		SendHttpResponse(w, &Response{
-			StatusCode: 200,
-			Message:    "OK",
-			Data:       "All instances release successfully",
-		}, http.StatusOK)
-		log.Printf("%s: %d instances released successfully", reqBody.ZoneId, -replica)
+		time.Sleep(backoff)
+		backoff *= 2
 	}
 }
 
-func apply(zoneId string, replica int32) error {
-	log.Printf("Trying to deploy %d pods in %s", replica, zoneId)
-	currentInstancesNumber, err := queryCurrentInstanesInCenter(zoneId)
+// manageFlavor 根据某个规格缺少的实例数申请或回收该规格的弹性实例。
+func manageFlavor(ctx context.Context, zoneId string, flavor *config.Flavor, missing int32, op *operation) (_ *ScaleResult, err error) {
+	ctx, span := tracer.Start(ctx, "manager.manageFlavor", trace.WithAttributes(
+		attribute.String("flavor", flavor.Name),
+		attribute.Int("missing", int(missing)),
+	))
+	defer func() { tracing.End(span, err) }()
+	logger := op.logger(zoneId).With("flavor", flavor.Name)
+	availableInstances, err := mysql_service.GetAvailableInstanceInCenter(zoneId, flavor.Name)
 	if err != nil {
-		return fmt.Errorf("error quering current instances in zone %s: %w", zoneId, err)
+		logger.Error("Failed to get available instances", "error", err)
+		return &ScaleResult{Message: err.Error()}, err
 	}
-	if currentInstancesNumber >= config.CENTERCAPACITY {
-		return fmt.Errorf("the number of elastic instance in zone %s is already full", zoneId)
+
+	replica := missing - availableInstances
+
+	if config.POOLCONTROLLERENABLED {
+		message, err := setDesiredReplicas(zoneId, flavor, replica)
+		if err != nil {
+			return &ScaleResult{Available: availableInstances, Message: err.Error()}, err
+		}
+		return &ScaleResult{Available: availableInstances, Message: message}, nil
+	}
+
+	if replica == 0 {
+		logger.Info("Replica is 0, there is no need to apply or release instances")
+		return &ScaleResult{Available: availableInstances, Message: "Replica is 0, there is no need to apply or release instances"}, nil
+	}
+
+	var result *ScaleResult
+	start := time.Now()
+	if replica > 0 {
+		result, err = apply(ctx, zoneId, flavor, replica, op)
+	} else {
+		result, err = release(ctx, zoneId, flavor, -replica, op)
+	}
+	result.Available = availableInstances
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	metrics.ScaleDuration.WithLabelValues(result.Action, zoneId, flavor.Name, outcome).Observe(time.Since(start).Seconds())
+	if err != nil {
+		logger.Error("Failed to scale instances", "action", result.Action, "error", err)
+		result.Message = err.Error()
+		return result, err
+	}
+	result.Message = fmt.Sprintf("%d instances %s successfully", result.Succeeded, result.Action)
+	logger.Info("Scale finished", "action", result.Action, "succeeded", result.Succeeded, "promoted", result.Promoted)
+	return result, nil
+}
+
+// apply 申请 replica 个弹性实例，单个实例失败时换一个 Pod 名称重试，
+// 最终失败的实例会删除已经创建的 Pod 和 Service。
+func apply(ctx context.Context, zoneId string, flavor *config.Flavor, replica int32, op *operation) (*ScaleResult, error) {
+	ctx, span := tracer.Start(ctx, "manager.apply", trace.WithAttributes(
+		attribute.String("zone_id", zoneId),
+		attribute.String("flavor", flavor.Name),
+		attribute.Int("replica", int(replica)),
+	))
+	defer span.End()
+	logger := op.logger(zoneId).With("flavor", flavor.Name)
+	logger.Info("Trying to deploy pods", "replica", replica)
+	result := &ScaleResult{Action: InstanceActionApply, Requested: replica, Instances: []InstanceResult{}}
+
+	// 优先提升热备实例，不足的部分再创建新的 Pod。
+	for _, instance := range promoteStandby(ctx, zoneId, flavor, replica, op) {
+		result.add(instance)
+		result.Promoted++
 	}
-	leftNumber := int32(config.CENTERCAPACITY) - int32(currentInstancesNumber)
-	if leftNumber < replica {
-		replica = leftNumber
-		log.Printf("But the left space can only deploy %d pods in %s", replica, zoneId)
+	if result.Promoted == replica {
+		return result, nil
 	}
 
+	// 热备实例已经在计费，只有新建的 Pod 受预算限制。
+	create, err := budgetLimit(zoneId, flavor, replica-result.Promoted)
+	var placements []placement
+	if err == nil {
+		placements, err = reserveCapacity(zoneId, flavor, create)
+	}
+	if err != nil {
+		if result.Promoted > 0 {
+			logger.Warn("Standby instances promoted, but no more instances can be created", "promoted", result.Promoted, "error", err)
+			result.Requested = result.Promoted
+			return result, nil
+		}
+		return result, err
+	}
+	result.Requested = result.Promoted + int32(len(placements))
+
 	var (
-		wg    sync.WaitGroup
-		mu    sync.Mutex
-		count = int32(0)
-		ch    = make(chan struct{}, 50)
+		wg sync.WaitGroup
+		mu sync.Mutex
+		ch = make(chan struct{}, 50)
 	)
-	for i := 1; i <= int(replica); i++ {
+	for _, p := range placements {
 		wg.Add(1)
 		ch <- struct{}{}
-		go func(zoneId string) {
+		go func(zoneId string, p placement) {
 			defer wg.Done()
 			defer func() { <-ch }()
 
-			randomId := uuid.NewUUID()
-			podName := fmt.Sprintf("cloudgame-center-%s", randomId)
-			instanceId := fmt.Sprintf("instance-%s", podName)
-
-			serverIp, port, err := createAndWatchPod(podName, instanceId, zoneId)
-			if err != nil {
-				log.Printf("Failed to create and watch Pod: %v", err)
-				return
-			}
-
-			// 部署完成后才能保存实例到数据库
-			if err = mysql_service.InsertInstance(zoneId, "null", serverIp, instanceId, podName, port, 1, "available", "null"); err != nil {
-				log.Printf("Failed to insert instance into database  when applying: %v", err)
-				return
-			}
-
-			// 计算成功部署的实例数量
+			instance := applyInstance(ctx, zoneId, flavor, p, op)
 			mu.Lock()
-			count++
+			result.add(instance)
 			mu.Unlock()
-		}(zoneId)
+		}(zoneId, p)
 	}
 
 	wg.Wait()
+	span.SetAttributes(attribute.Int("promoted", int(result.Promoted)), attribute.Int("failed", int(result.Failed)))
+	return result, result.err()
+}
+
+func applyInstance(ctx context.Context, zoneId string, flavor *config.Flavor, p placement, op *operation) InstanceResult {
+	var (
+		podName    = p.podName
+		cluster    = p.cluster
+		instanceId string
+		serverIp   string
+		port       int32
+	)
+	defer func() { releaseReservation(podName) }()
+	logger := op.logger(zoneId).With("flavor", flavor.Name)
 
-	if count != replica {
-		return fmt.Errorf("%d instances need to be applied, but %d instances failed to apply", replica, replica-count)
+	attempts, err := retry(func(attempt int) error {
+		if attempt > 1 {
+			// 上一次的 Pod 可能还在删除中，换一个名称重新创建，原集群不健康时换一个集群。
+			newPodName := fmt.Sprintf("cloudgame-center-%s", uuid.NewUUID())
+			cluster = swapReservation(cluster, podName, newPodName)
+			podName = newPodName
+		}
+		instanceId = fmt.Sprintf("instance-%s", podName)
+		op.track(zoneId, flavor.Name, instanceId, podName, InstanceActionApply, InstancePending, "")
+
+		// 创建 Pod 之前以 provisioning 入库，Pod 就绪之前不会分配给终端。
+		err := mysql_service.InsertInstance(zoneId, "null", "null", instanceId, podName, 0, 1, instancestate.Provisioning, "null", flavor.Name, cluster.Name)
+		if err == nil {
+			serverIp, port, err = createAndWatchPod(ctx, cluster, podName, instanceId, zoneId, flavor, false)
+			if err != nil {
+				// 创建失败的 Pod 已经被删除，记录也一并删除，重试时使用新的 Pod 名称。
+				if _, derr := mysql_service.DeleteInstance(zoneId, instanceId); derr != nil {
+					logger.Error("Failed to delete provisioning instance", "instance_id", instanceId, "error", derr)
+				}
+			}
+		} else {
+			err = fmt.Errorf("error inserting instance: %w", err)
+		}
+		if err != nil {
+			logger.Warn("Failed to create and watch pod", "pod_name", podName, "cluster", cluster.Name, "attempt", attempt, "error", err)
+			status := InstanceFailed
+			if attempt < config.SCALEMAXATTEMPTS {
+				status = InstanceRetried
+			}
+			op.track(zoneId, flavor.Name, instanceId, podName, InstanceActionApply, status, err.Error())
+		}
+		return err
+	})
+	instance := InstanceResult{InstanceId: instanceId, PodName: podName, Cluster: cluster.Name, Status: InstanceFailed, Attempts: attempts}
+	if err != nil {
+		instance.Error = err.Error()
+		return instance
 	}
 
-	return nil
+	// Pod 就绪后才能分配给终端
+	if _, err = retry(func(int) error {
+		return mysql_service.MarkInstanceReady(zoneId, instanceId, serverIp, port)
+	}); err != nil {
+		logger.Error("Failed to mark instance available when applying", "pod_name", podName, "error", err)
+		// 补偿：实例无法变为可用时删除 Pod、Service 和记录，避免留下永远不可用的实例。
+		instance.Error = fmt.Sprintf("error marking instance available: %v", err)
+		if _, err := retry(func(int) error { return deletePodAndService(cluster, podName, fmt.Sprintf("service-%s", podName)) }); err != nil {
+			instance.Error = fmt.Sprintf("%s; error deleting pod: %v", instance.Error, err)
+		} else if _, err := mysql_service.DeleteInstance(zoneId, instanceId); err != nil {
+			instance.Error = fmt.Sprintf("%s; error deleting instance: %v", instance.Error, err)
+		}
+		op.track(zoneId, flavor.Name, instanceId, podName, InstanceActionApply, InstanceFailed, instance.Error)
+		return instance
+	}
+	op.track(zoneId, flavor.Name, instanceId, podName, InstanceActionApply, InstanceReady, "")
+	instance.Status = InstanceReady
+	return instance
 }
 
-func release(zoneId string, replica int32) error {
-
-	podList, err := mysql_service.GetAndDeleteAvailableInstancesInCenter(zoneId, replica)
+// release 回收 replica 个可用的弹性实例，优先回收成本高的集群中的实例。
+// 实例先标记为 terminating，Pod 删除成功后再删除记录，Pod 删除失败时恢复为 available，保证数据库和集群一致。
+func release(ctx context.Context, zoneId string, flavor *config.Flavor, replica int32, op *operation) (*ScaleResult, error) {
+	ctx, span := tracer.Start(ctx, "manager.release", trace.WithAttributes(
+		attribute.String("zone_id", zoneId),
+		attribute.String("flavor", flavor.Name),
+		attribute.Int("replica", int(replica)),
+	))
+	defer span.End()
+	result := &ScaleResult{Action: InstanceActionRelease, Requested: replica, Instances: []InstanceResult{}}
+	instances, err := mysql_service.MarkInstancesTerminating(zoneId, flavor.Name, replica, drainOrder())
 	if err != nil {
-		return fmt.Errorf("failed to get available instances from database")
-	} else if podList == nil {
-		return fmt.Errorf("there is no elastic instance in this zone")
+		return result, fmt.Errorf("failed to get available instances from database: %w", err)
+	} else if len(instances) == 0 {
+		return result, fmt.Errorf("there is no elastic instance in this zone")
 	}
+	result.Requested = int32(len(instances))
 
 	var (
-		wg    sync.WaitGroup
-		mu    sync.Mutex
-		count = int32(0)
+		wg sync.WaitGroup
+		mu sync.Mutex
 	)
-	for _, podName := range podList {
+	for _, instance := range instances {
 		wg.Add(1)
-		go func(podName string) {
+		go func(instance mysql_service.ElasticInstance) {
 			defer wg.Done()
 
-			serviceName := fmt.Sprintf("service-%s", podName)
-			err := deletePodAndService(podName, serviceName)
-			if err != nil {
-				log.Printf("Failed to release pod %s: %v", podName, err)
-				return
-			}
-
+			r := releaseInstance(ctx, zoneId, flavor, instance, op)
 			mu.Lock()
-			count++
+			result.add(r)
 			mu.Unlock()
-		}(podName)
+		}(instance)
 	}
 
 	wg.Wait()
+	return result, result.err()
+}
+
+func releaseInstance(ctx context.Context, zoneId string, flavor *config.Flavor, instance mysql_service.ElasticInstance, op *operation) InstanceResult {
+	podName, instanceId, cluster := instance.PodName, instance.InstanceId, getCluster(instance.Cluster)
+	_, span := tracer.Start(ctx, "manager.releaseInstance", trace.WithAttributes(
+		attribute.String("pod_name", podName),
+		attribute.String("cluster", instance.Cluster),
+	))
+	defer span.End()
+	logger := op.logger(zoneId).With("flavor", flavor.Name, "pod_name", podName, "cluster", instance.Cluster)
+	op.track(zoneId, flavor.Name, instanceId, podName, InstanceActionRelease, InstancePending, "")
+	r := InstanceResult{InstanceId: instanceId, PodName: podName, Cluster: instance.Cluster, Status: InstanceFailed}
 
-	if count != replica {
-		return fmt.Errorf("%d instances need to be released, but %d instances failed to release", replica, replica-count)
+	var err error
+	if cluster == nil {
+		err = fmt.Errorf("cluster %q is not configured", instance.Cluster)
+	} else {
+		r.Attempts, err = retry(func(int) error { return deletePod(cluster, podName) })
+	}
+	if err != nil {
+		logger.Error("Failed to release pod", "error", err)
+		r.Error = err.Error()
+		// 补偿：Pod 仍然存在，恢复为可用。
+		if _, err := mysql_service.CompareAndSetInstanceStatus(zoneId, instanceId, instancestate.Terminating, instancestate.Available, "release failed"); err != nil {
+			r.Error = fmt.Sprintf("%s; error restoring instance: %v", r.Error, err)
+		}
+		op.track(zoneId, flavor.Name, instanceId, podName, InstanceActionRelease, InstanceFailed, r.Error)
+		return r
 	}
 
-	return nil
+	// Pod 已经删除，剩下的步骤失败时交给后台调谐处理。
+	if _, err := mysql_service.DeleteInstance(zoneId, instanceId); err != nil {
+		logger.Error("Failed to delete instance from database", "error", err)
+	}
+	if _, err := retry(func(int) error { return deleteService(cluster, fmt.Sprintf("service-%s", podName)) }); err != nil {
+		logger.Error("Failed to delete service", "error", err)
+		r.Error = err.Error()
+	}
+	op.track(zoneId, flavor.Name, instanceId, podName, InstanceActionRelease, InstanceReleased, r.Error)
+	r.Status = InstanceReleased
+	return r
 }
@@ -0,0 +1,94 @@
+package apis
+
+import (
+	mysql_service "manager/mysql/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectExistingKey 模拟幂等键已经被 operationId 使用过，请求摘要为 hash，操作的状态为 status。
+func expectExistingKey(mock sqlmock.Sqlmock, key string, operationId string, hash string, status string) {
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT k.operation_id, k.request_hash, IFNULL\\(o.status, ''\\) FROM idempotency_keys k LEFT JOIN operations o").WithArgs(key).
+		WillReturnRows(sqlmock.NewRows([]string{"operation_id", "request_hash", "status"}).AddRow(operationId, hash, status))
+}
+
+func TestInstanceManageReplaysIdempotentRequest(t *testing.T) {
+	// missing 等价于默认规格，摘要与直接传 flavors 相同。
+	hash := requestHash(InstanceManageRequest{ZoneId: "huadong", Flavors: map[string]int32{"default": 2}})
+	mock := newTestDB(t)
+	expectExistingKey(mock, "huadong-1", "op-1", hash, OperationSucceeded)
+	mock.ExpectRollback()
+
+	r := httptest.NewRequest(http.MethodPost, "/instance/manage", strings.NewReader(`{"zone_id":"huadong","missing":2}`))
+	r.Header.Set("Idempotency-Key", "huadong-1")
+	var resp InstanceManageResponse
+	w, code := serve(t, InstanceManage, r, nil, &resp)
+	if w.Code != http.StatusAccepted || code != 202 {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+	if resp.OperationId != "op-1" || !resp.Replayed || w.Header().Get("Location") != "/operations/op-1" {
+		t.Errorf("unexpected response %+v, location %q", resp, w.Header().Get("Location"))
+	}
+}
+
+func TestInstanceManageRejectsReusedKey(t *testing.T) {
+	mock := newTestDB(t)
+	expectExistingKey(mock, "huadong-1", "op-1", "another request", OperationSucceeded)
+	mock.ExpectRollback()
+
+	r := httptest.NewRequest(http.MethodPost, "/instance/manage", strings.NewReader(`{"zone_id":"huadong","flavors":{"default":3},"idempotency_key":"huadong-1"}`))
+	var detail string
+	w, code := serve(t, InstanceManage, r, nil, &detail)
+	if w.Code != http.StatusConflict || code != 409 || !strings.Contains(detail, "huadong-1") {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+}
+
+func TestIdempotencyKeyReplayAndTakeover(t *testing.T) {
+	liveOperations.Store("op-live", struct{}{})
+	defer liveOperations.Delete("op-live")
+
+	for _, c := range []struct {
+		operationId string
+		status      string
+		replayed    bool
+	}{
+		{"op-1", OperationSucceeded, true},
+		{"op-live", OperationRunning, true},
+		// 上一个主副本遗留的操作和失败的操作由新的请求接管。
+		{"op-1", OperationRunning, false},
+		{"op-1", OperationPending, false},
+		{"op-1", OperationFailed, false},
+		{"op-1", "", false},
+	} {
+		mock := newTestDB(t)
+		expectExistingKey(mock, "huadong-1", c.operationId, "hash", c.status)
+		if c.replayed {
+			mock.ExpectRollback()
+		} else {
+			mock.ExpectExec("UPDATE idempotency_keys SET operation_id = \\?").WithArgs("op-2", sqlmock.AnyArg(), "huadong-1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO operations").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+
+		existing, err := mysql_service.InsertOperationWithKey("huadong-1", time.Hour, "hash", "op-2", "huadong", OperationPending, "{}", replayable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (existing != nil) != c.replayed {
+			t.Errorf("operation %s in status %q: expected replayed %v, got %+v", c.operationId, c.status, c.replayed, existing)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("operation %s in status %q: %v", c.operationId, c.status, err)
+		}
+	}
+}
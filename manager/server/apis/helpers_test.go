@@ -0,0 +1,110 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"manager/config"
+	"manager/mysql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	k8s_client "manager/k8s-client"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TestMain 设置测试使用的配置和内置模板，集群和规格使用 config 中的默认值。
+func TestMain(m *testing.M) {
+	config.K8SNAMSPACE = "default"
+	config.WEBHOOKSECRETKEY = "test"
+	config.SCALERATIO, config.HUADONGTOTAL, config.CENTERCAPACITY = 1, 100, 100
+	if err := LoadTemplates(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestDB 用 sqlmock 替换数据库，查询按正则匹配，测试结束时检查预期的语句都已执行。
+func newTestDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := mysql.DB
+	mysql.DB = db
+	t.Cleanup(func() {
+		mysql.DB = old
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return mock
+}
+
+// newTestCluster 返回使用 fake 客户端的健康集群，objects 同时放入客户端和 informer 缓存。
+func newTestCluster(name string, objects ...runtime.Object) *clusterState {
+	pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	services := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, obj := range objects {
+		switch obj.(type) {
+		case *corev1.Pod:
+			pods.Add(obj)
+		case *corev1.Service:
+			services.Add(obj)
+		}
+	}
+	return &clusterState{
+		Cluster: &k8s_client.Cluster{
+			Cluster: &config.Cluster{Name: name},
+			Client:  fake.NewSimpleClientset(objects...),
+		},
+		podLister:     corelisters.NewPodLister(pods),
+		serviceLister: corelisters.NewServiceLister(services),
+		synced:        func() bool { return true },
+		healthy:       true,
+	}
+}
+
+// useClusters 在测试期间替换目标集群。
+func useClusters(t *testing.T, cs ...*clusterState) {
+	old := clusters
+	clusters = cs
+	t.Cleanup(func() { clusters = old })
+}
+
+// serve 调用 handler 处理请求，vars 为路由中的路径参数。
+// data 不为 nil 时将响应中的 data 解码到 data，并返回 status_code。
+func serve(t *testing.T, handler http.HandlerFunc, r *http.Request, vars map[string]string, data interface{}) (*httptest.ResponseRecorder, uint32) {
+	t.Helper()
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if data == nil || w.Header().Get("Content-Type") != "application/json; charset=UTF-8" {
+		return w, 0
+	}
+	var resp struct {
+		StatusCode uint32          `json:"status_code"`
+		Data       json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding response %q: %v", w.Body.String(), err)
+	}
+	if err := json.Unmarshal(resp.Data, data); err != nil {
+		t.Fatalf("error decoding data %s: %v", resp.Data, err)
+	}
+	return w, resp.StatusCode
+}
+
+var errTest = errors.New("test error")
@@ -1,11 +1,17 @@
 package apis
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Response struct {
@@ -29,7 +35,7 @@ func SendHttpResponse(w http.ResponseWriter, m *Response, httpCode int) {
 	if m != nil {
 		err := json.NewEncoder(w).Encode(m)
 		if err != nil {
-			fmt.Printf("Failed to encode response: %v\n", err)
+			slog.Error("Failed to encode response", "error", err)
 			return
 		}
 	}
@@ -43,6 +49,62 @@ func SendErrorResponse(w http.ResponseWriter, err *ErrorCodeWithMessage, describ
 	}, err.HttpStatus)
 }
 
+func sendOK(w http.ResponseWriter, data interface{}) {
+	SendHttpResponse(w, &Response{
+		StatusCode: 200,
+		Message:    "OK",
+		Data:       data,
+	}, http.StatusOK)
+}
+
+func sendCreated(w http.ResponseWriter, data interface{}) {
+	SendHttpResponse(w, &Response{
+		StatusCode: 201,
+		Message:    "Created",
+		Data:       data,
+	}, http.StatusCreated)
+}
+
+func sendAccepted(w http.ResponseWriter, data interface{}) {
+	SendHttpResponse(w, &Response{
+		StatusCode: 202,
+		Message:    "Accepted",
+		Data:       data,
+	}, http.StatusAccepted)
+}
+
+func sendBadRequest(w http.ResponseWriter, detail string) {
+	SendErrorResponse(w, &ErrorCodeWithMessage{
+		HttpStatus: http.StatusBadRequest,
+		ErrorCode:  400,
+		Message:    "Bad request",
+	}, detail)
+}
+
+func sendNotFound(w http.ResponseWriter, detail string) {
+	SendErrorResponse(w, &ErrorCodeWithMessage{
+		HttpStatus: http.StatusNotFound,
+		ErrorCode:  404,
+		Message:    "Not found",
+	}, detail)
+}
+
+func sendConflict(w http.ResponseWriter, detail string) {
+	SendErrorResponse(w, &ErrorCodeWithMessage{
+		HttpStatus: http.StatusConflict,
+		ErrorCode:  409,
+		Message:    "Conflict",
+	}, detail)
+}
+
+func sendInternalError(w http.ResponseWriter, err error) {
+	SendErrorResponse(w, &ErrorCodeWithMessage{
+		HttpStatus: http.StatusInternalServerError,
+		ErrorCode:  500,
+		Message:    "Internal server error",
+	}, err.Error())
+}
+
 func getInstanceStatus(host string, port int32) (string, error) {
 	url := fmt.Sprintf("http://%s:%d/getStatus", host, port)
 	client := &http.Client{
@@ -52,6 +114,10 @@ func getInstanceStatus(host string, port int32) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("error with request: %v", err)
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -60,16 +126,32 @@ func getInstanceStatus(host string, port int32) (string, error) {
 	return string(body), nil
 }
 
-func checkPodReady(host string, port int32) bool {
+func checkPodReady(ctx context.Context, host string, port int32) (ready bool) {
+	ctx, span := tracer.Start(ctx, "instance.checkPodReady", trace.WithAttributes(
+		attribute.String("host", host),
+		attribute.Int("port", int(port)),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Bool("ready", ready))
+		span.End()
+	}()
 	url := fmt.Sprintf("http://%s:%d/healthz", host, port)
 	client := &http.Client{
-		Timeout: 3 * time.Second,
+		Timeout:   3 * time.Second,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
 	}
 
 	for i := 0; i < 3; i++ {
-		resp, err := client.Get(url)
-		if err == nil && resp.StatusCode == http.StatusOK {
-			return true
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return false
+		}
+		resp, err := client.Do(request)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return true
+			}
 		}
 		time.Sleep(5 * time.Second)
 	}
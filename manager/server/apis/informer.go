@@ -0,0 +1,192 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"manager/config"
+	mysql_service "manager/mysql/service"
+	"sync"
+	"time"
+
+	k8s_client "manager/k8s-client"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+const informerSyncTimeout = 30 * time.Second
+
+var (
+	waitersMu   sync.Mutex
+	podWaiters  = make(map[string]chan *corev1.Pod) // 等待 Pod 就绪的协程，key 为 Pod 名称
+	readyPodSet = make(map[string]bool)             // 已经就绪的 Pod，用于识别就绪状态的变化
+)
+
+// StartInformers 为每个目标集群启动带有 is_elastic 标签的 Pod 和 Service 的共享 informer，
+// 并等待缓存同步完成。之后实例数量统计、一致性检查和就绪检测都基于缓存进行。
+// 缓存在超时时间内没有同步完成的集群会被标记为不健康，同步完成后由健康检查恢复。
+func StartInformers(ctx context.Context) error {
+	for _, cluster := range k8s_client.Clusters {
+		c := &clusterState{Cluster: cluster}
+		factory := informers.NewSharedInformerFactoryWithOptions(
+			cluster.Client,
+			0,
+			informers.WithNamespace(config.K8SNAMSPACE),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = "is_elastic"
+			}),
+		)
+
+		podInformer := factory.Core().V1().Pods()
+		serviceInformer := factory.Core().V1().Services()
+		c.podLister = podInformer.Lister()
+		c.serviceLister = serviceInformer.Lister()
+		c.synced = func() bool {
+			return podInformer.Informer().HasSynced() && serviceInformer.Informer().HasSynced()
+		}
+
+		_, err := podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if pod, ok := obj.(*corev1.Pod); ok {
+					recordUsageStart(c, pod)
+				}
+				onPodUpdate(c, obj)
+			},
+			UpdateFunc: func(_, obj interface{}) { onPodUpdate(c, obj) },
+			DeleteFunc: onPodDelete,
+		})
+		if err != nil {
+			return fmt.Errorf("error adding pod event handler for cluster %s: %w", cluster.Name, err)
+		}
+
+		factory.Start(ctx.Done())
+		clusters = append(clusters, c)
+	}
+
+	for _, c := range clusters {
+		syncCtx, cancel := context.WithTimeout(ctx, informerSyncTimeout)
+		if cache.WaitForCacheSync(syncCtx.Done(), c.synced) {
+			c.setHealth(true, "")
+			slog.Info("Pod and service informers synced", "cluster", c.Name)
+		} else {
+			c.setHealth(false, "informer cache is not synced")
+		}
+		cancel()
+	}
+	startClusterProbe(ctx)
+	return nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.Status.HostIP == "" {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// watchPodReady 注册一个就绪通知，必须在创建 Pod 之前调用，返回的函数用于取消注册。
+func watchPodReady(podName string) (<-chan *corev1.Pod, func()) {
+	ch := make(chan *corev1.Pod, 1)
+	waitersMu.Lock()
+	podWaiters[podName] = ch
+	waitersMu.Unlock()
+	return ch, func() {
+		waitersMu.Lock()
+		delete(podWaiters, podName)
+		waitersMu.Unlock()
+	}
+}
+
+func onPodUpdate(c *clusterState, obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	ready := isPodReady(pod)
+
+	waitersMu.Lock()
+	wasReady := readyPodSet[pod.Name]
+	readyPodSet[pod.Name] = ready
+	ch, waiting := podWaiters[pod.Name]
+	waitersMu.Unlock()
+
+	if ready && waiting {
+		// 只保留最新的 Pod 状态。
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- pod
+	}
+
+	// 已经入库的弹性实例重新就绪后，同步一次实例状态。
+	if ready && !wasReady && !waiting && pod.Labels["is_elastic"] == "1" && !isStandby(pod) {
+		go func() {
+			nodePort, err := getNodePort(c, pod.Name)
+			if err != nil {
+				slog.Warn("Failed to get node port", "zone_id", pod.Labels["zone_id"], "pod_name", pod.Name, "error", err)
+				return
+			}
+			if err := checkInstanceStatus(context.Background(), pod.Labels["zone_id"], pod.Status.HostIP, nodePort, pod.Labels["instance_id"]); err != nil {
+				slog.Warn("Failed to synchronize instance status", "zone_id", pod.Labels["zone_id"], "pod_name", pod.Name, "error", err)
+			}
+		}()
+	}
+}
+
+func onPodDelete(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if pod, ok = tombstone.Obj.(*corev1.Pod); !ok {
+			return
+		}
+	}
+
+	waitersMu.Lock()
+	delete(readyPodSet, pod.Name)
+	waitersMu.Unlock()
+	recordUsageEnd(pod)
+
+	// 弹性实例的 Pod 被删除后，数据库中的记录也随之删除。
+	zoneId, instanceId := pod.Labels["zone_id"], pod.Labels["instance_id"]
+	if pod.Labels["is_elastic"] != "1" || zoneId == "" || instanceId == "" {
+		return
+	}
+	deleted, err := mysql_service.DeleteInstance(zoneId, instanceId)
+	if err != nil {
+		slog.Error("Failed to delete instance after its pod was deleted", "zone_id", zoneId, "instance_id", instanceId, "error", err)
+	} else if deleted {
+		slog.Info("Instance deleted from database because its pod was deleted", "zone_id", zoneId, "instance_id", instanceId)
+	}
+}
+
+// getNodePort 从缓存中获取 Pod 对应 Service 的 NodePort，缓存中不存在时（例如 Service 没有 is_elastic 标签）回退到 API 查询。
+func getNodePort(c *clusterState, podName string) (int32, error) {
+	serviceName := fmt.Sprintf("service-%s", podName)
+	service, err := c.serviceLister.Services(config.K8SNAMSPACE).Get(serviceName)
+	if apierrors.IsNotFound(err) {
+		service, err = c.Client.CoreV1().Services(config.K8SNAMSPACE).Get(context.Background(), serviceName, metav1.GetOptions{})
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get service %s: %w", serviceName, err)
+	}
+	for _, port := range service.Spec.Ports {
+		if port.NodePort != 0 {
+			return port.NodePort, nil
+		}
+	}
+	return 0, fmt.Errorf("service %s has no node port", serviceName)
+}
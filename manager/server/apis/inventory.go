@@ -0,0 +1,446 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"manager/config"
+	mysql_service "manager/mysql/service"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	historyDefaultLimit = 100
+	historyMaxLimit     = 1000
+)
+
+// idPattern 是站点 ID 和实例 ID 允许的格式，null 在实例表中表示没有站点，不能作为 ID。
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,254}$`)
+
+type SiteRequest struct {
+	SiteId      string  `json:"site_id"`
+	Description *string `json:"description"`
+}
+
+// EdgeInstanceRequest 是登记或修改固定实例的请求，修改时只更新不为空的字段。
+type EdgeInstanceRequest struct {
+	InstanceId string  `json:"instance_id"`
+	PodName    *string `json:"pod_name"` // 为空时与 instance_id 相同
+	ServerIp   *string `json:"server_ip"`
+	Port       *int32  `json:"port"`
+	Flavor     *string `json:"flavor"` // 为空时为默认规格
+	Cordoned   bool    `json:"cordoned"`
+}
+
+func validID(id string) bool {
+	return idPattern.MatchString(id) && id != "null"
+}
+
+// pathSite 返回路径中的 zone 和站点，zone 或站点不存在时返回 404。
+func pathSite(w http.ResponseWriter, r *http.Request) (*mysql_service.Site, bool) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return nil, false
+	}
+	siteId := mux.Vars(r)["site"]
+	site, err := mysql_service.GetSite(zoneId, siteId)
+	if err != nil {
+		sendInternalError(w, err)
+		return nil, false
+	}
+	if site == nil {
+		sendNotFound(w, fmt.Sprintf("Site %s not found in zone %s", siteId, zoneId))
+		return nil, false
+	}
+	return site, true
+}
+
+// pathEdgeInstance 返回路径中的 zone 和固定实例，zone 或实例不存在时返回 404。
+func pathEdgeInstance(w http.ResponseWriter, r *http.Request) (*mysql_service.EdgeInstance, bool) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return nil, false
+	}
+	instanceId := mux.Vars(r)["id"]
+	instance, err := mysql_service.GetEdgeInstance(zoneId, instanceId)
+	if err != nil {
+		sendInternalError(w, err)
+		return nil, false
+	}
+	if instance == nil {
+		sendNotFound(w, fmt.Sprintf("Edge instance %s not found in zone %s", instanceId, zoneId))
+		return nil, false
+	}
+	return instance, true
+}
+
+// CreateSite 登记边缘站点。
+func CreateSite(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	reqBody := SiteRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+	if !validID(reqBody.SiteId) {
+		sendBadRequest(w, fmt.Sprintf("Invalid site_id %q, it must match %s and must not be null", reqBody.SiteId, idPattern))
+		return
+	}
+	existing, err := mysql_service.GetSite(zoneId, reqBody.SiteId)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	if existing != nil {
+		sendConflict(w, fmt.Sprintf("Site %s already exists in zone %s", reqBody.SiteId, zoneId))
+		return
+	}
+
+	site := &mysql_service.Site{ZoneId: zoneId, SiteId: reqBody.SiteId}
+	if reqBody.Description != nil {
+		site.Description = *reqBody.Description
+	}
+	if err := mysql_service.InsertSite(site); err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	slog.Info("Site registered", "zone_id", zoneId, "site_id", site.SiteId)
+	sendCreated(w, site)
+}
+
+func ListSites(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	sites, err := mysql_service.ListSites(zoneId)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, sites)
+}
+
+// UpdateSite 修改站点描述。
+func UpdateSite(w http.ResponseWriter, r *http.Request) {
+	site, ok := pathSite(w, r)
+	if !ok {
+		return
+	}
+	reqBody := SiteRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+	if reqBody.SiteId != "" && reqBody.SiteId != site.SiteId {
+		sendBadRequest(w, "site_id cannot be changed")
+		return
+	}
+	if reqBody.Description != nil {
+		if err := mysql_service.UpdateSiteDescription(site.ZoneId, site.SiteId, *reqBody.Description); err != nil {
+			sendInternalError(w, err)
+			return
+		}
+	}
+	sendSite(w, site.ZoneId, site.SiteId)
+}
+
+// CordonSite 封锁站点，站点上的固定实例不再分配给新的终端，也不计入站点容量，已接入的终端不受影响。
+func CordonSite(w http.ResponseWriter, r *http.Request) {
+	setSiteCordoned(w, r, true)
+}
+
+func UncordonSite(w http.ResponseWriter, r *http.Request) {
+	setSiteCordoned(w, r, false)
+}
+
+func setSiteCordoned(w http.ResponseWriter, r *http.Request, cordoned bool) {
+	site, ok := pathSite(w, r)
+	if !ok {
+		return
+	}
+	if err := mysql_service.SetSiteCordoned(site.ZoneId, site.SiteId, cordoned); err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	slog.Info("Site cordon changed", "zone_id", site.ZoneId, "site_id", site.SiteId, "cordoned", cordoned)
+	sendSite(w, site.ZoneId, site.SiteId)
+}
+
+func sendSite(w http.ResponseWriter, zoneId string, siteId string) {
+	site, err := mysql_service.GetSite(zoneId, siteId)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, site)
+}
+
+// DecommissionSite 下线站点，站点上的固定实例需要先全部下线。
+func DecommissionSite(w http.ResponseWriter, r *http.Request) {
+	site, ok := pathSite(w, r)
+	if !ok {
+		return
+	}
+	if site.Instances > 0 {
+		sendConflict(w, fmt.Sprintf("Site %s still has %d edge instances, decommission them first", site.SiteId, site.Instances))
+		return
+	}
+	deleted, err := mysql_service.DeleteSite(site.ZoneId, site.SiteId)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	if !deleted {
+		sendConflict(w, fmt.Sprintf("Site %s has edge instances registered concurrently", site.SiteId))
+		return
+	}
+	slog.Info("Site decommissioned", "zone_id", site.ZoneId, "site_id", site.SiteId)
+	sendOK(w, site)
+}
+
+// validateEdgeInstance 校验固定实例的地址和规格。
+func validateEdgeInstance(instance *mysql_service.EdgeInstance) error {
+	if !validID(instance.PodName) {
+		return fmt.Errorf("invalid pod_name %q, it must match %s and must not be null", instance.PodName, idPattern)
+	}
+	if ip := net.ParseIP(instance.ServerIp); ip == nil {
+		return fmt.Errorf("invalid server_ip %q", instance.ServerIp)
+	}
+	if instance.Port < 1 || instance.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	if _, ok := config.GetFlavor(instance.Flavor); !ok {
+		return fmt.Errorf("unknown flavor %s", instance.Flavor)
+	}
+	return nil
+}
+
+// checkAddress 检查地址是否已被 zone 中其他实例使用，被使用时返回 409。
+func checkAddress(w http.ResponseWriter, instance *mysql_service.EdgeInstance) bool {
+	inUse, err := mysql_service.AddressInUse(instance.ZoneId, instance.ServerIp, instance.Port, instance.InstanceId)
+	if err != nil {
+		sendInternalError(w, err)
+		return false
+	}
+	if inUse {
+		sendConflict(w, fmt.Sprintf("Address %s is already used by another instance", net.JoinHostPort(instance.ServerIp, fmt.Sprint(instance.Port))))
+		return false
+	}
+	return true
+}
+
+// CreateEdgeInstance 在站点上登记一个固定实例，登记后实例即可分配给终端。
+func CreateEdgeInstance(w http.ResponseWriter, r *http.Request) {
+	site, ok := pathSite(w, r)
+	if !ok {
+		return
+	}
+	reqBody := EdgeInstanceRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+	if !validID(reqBody.InstanceId) {
+		sendBadRequest(w, fmt.Sprintf("Invalid instance_id %q, it must match %s and must not be null", reqBody.InstanceId, idPattern))
+		return
+	}
+	if reqBody.ServerIp == nil || reqBody.Port == nil {
+		sendBadRequest(w, "server_ip and port are required")
+		return
+	}
+	instance := &mysql_service.EdgeInstance{
+		ZoneId:     site.ZoneId,
+		SiteId:     site.SiteId,
+		InstanceId: reqBody.InstanceId,
+		PodName:    reqBody.InstanceId,
+		ServerIp:   *reqBody.ServerIp,
+		Port:       *reqBody.Port,
+		Flavor:     config.DefaultFlavor,
+		Cordoned:   reqBody.Cordoned,
+	}
+	if reqBody.PodName != nil {
+		instance.PodName = *reqBody.PodName
+	}
+	if reqBody.Flavor != nil && *reqBody.Flavor != "" {
+		instance.Flavor = *reqBody.Flavor
+	}
+	if err := validateEdgeInstance(instance); err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+
+	exists, err := mysql_service.InstanceExists(instance.ZoneId, instance.InstanceId)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	if exists {
+		sendConflict(w, fmt.Sprintf("Instance %s already exists in zone %s", instance.InstanceId, instance.ZoneId))
+		return
+	}
+	if !checkAddress(w, instance) {
+		return
+	}
+	if err := mysql_service.InsertEdgeInstance(instance); err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	slog.Info("Edge instance registered", "zone_id", instance.ZoneId, "site_id", instance.SiteId, "instance_id", instance.InstanceId, "flavor", instance.Flavor)
+	sendCreated(w, instance)
+}
+
+func ListEdgeInstances(w http.ResponseWriter, r *http.Request) {
+	site, ok := pathSite(w, r)
+	if !ok {
+		return
+	}
+	instances, err := mysql_service.ListEdgeInstances(site.ZoneId, site.SiteId)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, instances)
+}
+
+// UpdateEdgeInstance 修改固定实例的地址和规格，接入终端的实例不能修改。
+func UpdateEdgeInstance(w http.ResponseWriter, r *http.Request) {
+	instance, ok := pathEdgeInstance(w, r)
+	if !ok {
+		return
+	}
+	reqBody := EdgeInstanceRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+	if reqBody.InstanceId != "" && reqBody.InstanceId != instance.InstanceId {
+		sendBadRequest(w, "instance_id cannot be changed")
+		return
+	}
+	if reqBody.PodName != nil {
+		instance.PodName = *reqBody.PodName
+	}
+	if reqBody.ServerIp != nil {
+		instance.ServerIp = *reqBody.ServerIp
+	}
+	if reqBody.Port != nil {
+		instance.Port = *reqBody.Port
+	}
+	if reqBody.Flavor != nil {
+		instance.Flavor = *reqBody.Flavor
+	}
+	if err := validateEdgeInstance(instance); err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+	if instance.Status == "using" {
+		sendConflict(w, fmt.Sprintf("Instance %s is used by device %s", instance.InstanceId, instance.DeviceId))
+		return
+	}
+	if !checkAddress(w, instance) {
+		return
+	}
+	updated, err := mysql_service.UpdateEdgeInstance(instance)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	if !updated {
+		// 没有修改记录时，实例可能在检查之后接入了终端或被下线，也可能各字段都没有变化。
+		current, err := mysql_service.GetEdgeInstance(instance.ZoneId, instance.InstanceId)
+		if err != nil {
+			sendInternalError(w, err)
+			return
+		}
+		if current == nil {
+			sendNotFound(w, fmt.Sprintf("Edge instance %s not found in zone %s", instance.InstanceId, instance.ZoneId))
+			return
+		}
+		if current.Status == "using" {
+			sendConflict(w, fmt.Sprintf("Instance %s is used by device %s", current.InstanceId, current.DeviceId))
+			return
+		}
+	}
+	sendEdgeInstance(w, instance.ZoneId, instance.InstanceId)
+}
+
+// CordonEdgeInstance 封锁固定实例，实例不再分配给新的终端，也不计入站点容量，已接入的终端不受影响。
+func CordonEdgeInstance(w http.ResponseWriter, r *http.Request) {
+	setEdgeInstanceCordoned(w, r, true)
+}
+
+func UncordonEdgeInstance(w http.ResponseWriter, r *http.Request) {
+	setEdgeInstanceCordoned(w, r, false)
+}
+
+func setEdgeInstanceCordoned(w http.ResponseWriter, r *http.Request, cordoned bool) {
+	instance, ok := pathEdgeInstance(w, r)
+	if !ok {
+		return
+	}
+	if err := mysql_service.SetInstanceCordoned(instance.ZoneId, instance.InstanceId, cordoned); err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	slog.Info("Edge instance cordon changed", "zone_id", instance.ZoneId, "instance_id", instance.InstanceId, "cordoned", cordoned)
+	sendEdgeInstance(w, instance.ZoneId, instance.InstanceId)
+}
+
+func sendEdgeInstance(w http.ResponseWriter, zoneId string, instanceId string) {
+	instance, err := mysql_service.GetEdgeInstance(zoneId, instanceId)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, instance)
+}
+
+// DecommissionEdgeInstance 下线固定实例，接入终端的实例需要先封锁，等终端登出后再下线。
+func DecommissionEdgeInstance(w http.ResponseWriter, r *http.Request) {
+	instance, ok := pathEdgeInstance(w, r)
+	if !ok {
+		return
+	}
+	deleted, err := mysql_service.DecommissionEdgeInstance(instance.ZoneId, instance.InstanceId)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	if !deleted {
+		sendConflict(w, fmt.Sprintf("Instance %s is in use, cordon it and wait for the device to log out", instance.InstanceId))
+		return
+	}
+	slog.Info("Edge instance decommissioned", "zone_id", instance.ZoneId, "site_id", instance.SiteId, "instance_id", instance.InstanceId)
+	sendOK(w, instance)
+}
+
+// GetInstanceHistory 返回实例最近的状态变更记录，包括弹性实例，limit 默认为 historyDefaultLimit。
+func GetInstanceHistory(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	limit := historyDefaultLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > historyMaxLimit {
+			sendBadRequest(w, fmt.Sprintf("limit must be between 1 and %d", historyMaxLimit))
+			return
+		}
+	}
+	history, err := mysql_service.GetInstanceHistory(zoneId, mux.Vars(r)["id"], limit)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, history)
+}
@@ -0,0 +1,95 @@
+package apis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	mysql_service "manager/mysql/service"
+)
+
+func TestValidID(t *testing.T) {
+	for _, id := range []string{"a", "instance-1", "pod_1.v2", "0", strings.Repeat("a", 255)} {
+		if !validID(id) {
+			t.Errorf("expected %q to be valid", id)
+		}
+	}
+	// null 是未接入终端时 device_id 的取值，不能作为 ID。
+	for _, id := range []string{"", "null", "-instance", ".instance", "instance 1", "instance/1", strings.Repeat("a", 256)} {
+		if validID(id) {
+			t.Errorf("expected %q to be invalid", id)
+		}
+	}
+}
+
+func TestValidateEdgeInstance(t *testing.T) {
+	cases := []struct {
+		name     string
+		instance mysql_service.EdgeInstance
+		err      string
+	}{
+		{"valid", mysql_service.EdgeInstance{PodName: "pod-1", ServerIp: "10.0.0.1", Port: 8080}, ""},
+		{"ipv6", mysql_service.EdgeInstance{PodName: "pod-1", ServerIp: "fd00::1", Port: 65535}, ""},
+		{"pod name", mysql_service.EdgeInstance{PodName: "null", ServerIp: "10.0.0.1", Port: 8080}, "pod_name"},
+		{"server ip", mysql_service.EdgeInstance{PodName: "pod-1", ServerIp: "10.0.0", Port: 8080}, "server_ip"},
+		{"port 0", mysql_service.EdgeInstance{PodName: "pod-1", ServerIp: "10.0.0.1", Port: 0}, "port"},
+		{"port 65536", mysql_service.EdgeInstance{PodName: "pod-1", ServerIp: "10.0.0.1", Port: 65536}, "port"},
+		{"flavor", mysql_service.EdgeInstance{PodName: "pod-1", ServerIp: "10.0.0.1", Port: 8080, Flavor: "unknown"}, "flavor"},
+	}
+	for _, c := range cases {
+		err := validateEdgeInstance(&c.instance)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: expected error about %s, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+// expectEdgeInstance 模拟查询 huadong 中的固定实例 instance-1。
+func expectEdgeInstance(mock sqlmock.Sqlmock, status string, deviceId string) {
+	mock.ExpectQuery("SELECT .* FROM instance_huadong WHERE is_elastic = 0 AND instance_id = \\?").WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows([]string{"site_id", "instance_id", "pod_name", "server_ip", "port", "flavor", "status", "device_id", "cordoned"}).
+			AddRow("site-1", "instance-1", "pod-1", "10.0.0.1", 8080, "default", status, deviceId, false))
+}
+
+func TestUpdateEdgeInstanceConflictsWithLogin(t *testing.T) {
+	mock := newTestDB(t)
+	expectZones(mock, "huadong")
+	expectEdgeInstance(mock, "available", "null")
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM instance_huadong WHERE server_ip = \\? AND port = \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	// 检查之后终端登录了该实例，更新没有修改记录。
+	mock.ExpectExec("UPDATE instance_huadong SET server_ip = \\?, port = \\?, pod_name = \\?, flavor = \\? WHERE .* AND NOT \\(status IN \\('using', 'draining'\\) AND device_id != 'null'\\)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectEdgeInstance(mock, "using", "device-1")
+
+	var detail string
+	r := httptest.NewRequest(http.MethodPatch, "/zones/huadong/edge-instances/instance-1", strings.NewReader(`{"port": 9090}`))
+	w, code := serve(t, UpdateEdgeInstance, r, map[string]string{"zone": "huadong", "id": "instance-1"}, &detail)
+	if w.Code != http.StatusConflict || code != 409 || !strings.Contains(detail, "device-1") {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+}
+
+func TestUpdateEdgeInstanceUnchanged(t *testing.T) {
+	mock := newTestDB(t)
+	expectZones(mock, "huadong")
+	expectEdgeInstance(mock, "available", "null")
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM instance_huadong WHERE server_ip = \\? AND port = \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	// 各字段都没有变化时同样不修改记录，但不是冲突。
+	mock.ExpectExec("UPDATE instance_huadong SET").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectEdgeInstance(mock, "available", "null")
+	expectEdgeInstance(mock, "available", "null")
+
+	r := httptest.NewRequest(http.MethodPatch, "/zones/huadong/edge-instances/instance-1", strings.NewReader(`{"port": 8080}`))
+	w, code := serve(t, UpdateEdgeInstance, r, map[string]string{"zone": "huadong", "id": "instance-1"}, new(interface{}))
+	if w.Code != http.StatusOK || code != 200 {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+}
@@ -1,181 +1,157 @@
 package apis
 
 import (
+	"common/logging"
+	"common/tracing"
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"manager/config"
+	"manager/metrics"
 	mysql_service "manager/mysql/service"
 	"strings"
 	"sync"
 	"time"
 
-	k8s_client "manager/k8s-client"
+	"manager/podtemplate"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
-func podFactory(
+var renderer *podtemplate.Renderer
+
+// LoadTemplates 按配置加载弹性实例的 Pod 和 Service 模板。
+func LoadTemplates() error {
+	var err error
+	renderer, err = podtemplate.NewRenderer(config.PODTEMPLATEPATH, config.SERVICETEMPLATEPATH)
+	return err
+}
+
+func templateValues(
 	instanceId string,
 	podName string,
 	zoneId string,
-) *corev1.Pod {
-	return &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      podName,
-			Namespace: config.K8SNAMSPACE,
-			Labels: map[string]string{
-				"instance_id": instanceId,
-				"zone_id":     zoneId,
-				"is_elastic":  "1",
-			},
-		},
-		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{
-				{
-					Name:            "cloudgame-container",
-					Image:           "cloudgame:latest",
-					ImagePullPolicy: corev1.PullIfNotPresent,
-					Ports: []corev1.ContainerPort{
-						{
-							Name:          "http",
-							ContainerPort: 8080,
-							Protocol:      corev1.ProtocolTCP,
-						},
-					},
-					Resources: corev1.ResourceRequirements{
-						Limits: corev1.ResourceList{
-							corev1.ResourceCPU:    resource.MustParse("50m"),
-							corev1.ResourceMemory: resource.MustParse("64Mi"),
-						},
-						Requests: corev1.ResourceList{
-							corev1.ResourceCPU:    resource.MustParse("25m"),
-							corev1.ResourceMemory: resource.MustParse("32Mi"),
-						},
-					},
-					ReadinessProbe: &corev1.Probe{
-						ProbeHandler: corev1.ProbeHandler{
-							HTTPGet: &corev1.HTTPGetAction{
-								Path: "/healthz",
-								Port: intstr.FromInt(8080),
-							},
-						},
-						InitialDelaySeconds: 15,
-						PeriodSeconds:       10,
-						TimeoutSeconds:      5,
-						SuccessThreshold:    1,
-						FailureThreshold:    3,
-					},
-				},
-			},
-			Affinity: &corev1.Affinity{
-				NodeAffinity: &corev1.NodeAffinity{
-					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
-						NodeSelectorTerms: []corev1.NodeSelectorTerm{
-							{
-								MatchExpressions: []corev1.NodeSelectorRequirement{
-									{
-										Key:      "zone_id",
-										Operator: corev1.NodeSelectorOpIn,
-										Values:   []string{zoneId},
-									},
-									{
-										Key:      "role",
-										Operator: corev1.NodeSelectorOpIn,
-										Values:   []string{"center"},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			RestartPolicy: corev1.RestartPolicyAlways,
-		},
+	flavor *config.Flavor,
+) *podtemplate.Values {
+	return &podtemplate.Values{
+		Namespace:    config.K8SNAMSPACE,
+		ZoneId:       zoneId,
+		InstanceId:   instanceId,
+		PodName:      podName,
+		ServiceName:  fmt.Sprintf("service-%s", podName),
+		Flavor:       flavor.Name,
+		Image:        flavor.Image,
+		Port:         flavor.Ports[0].ContainerPort,
+		Ports:        flavor.Ports,
+		Resources:    flavor.Resources,
+		NodeSelector: flavor.NodeSelector,
 	}
 }
 
+func podFactory(
+	instanceId string,
+	podName string,
+	zoneId string,
+	flavor *config.Flavor,
+) (*corev1.Pod, error) {
+	return renderer.RenderPod(templateValues(instanceId, podName, zoneId, flavor))
+}
+
 func serviceFactory(
-	serviceName string,
 	instanceId string,
-) *corev1.Service {
-	return &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      serviceName,
-			Namespace: config.K8SNAMSPACE,
-		},
-		Spec: corev1.ServiceSpec{
-			Selector: map[string]string{
-				"instance_id": instanceId,
-			},
-			Type: corev1.ServiceTypeNodePort,
-			Ports: []corev1.ServicePort{
-				{
-					Name:       "http",
-					Port:       80,
-					TargetPort: intstr.IntOrString{IntVal: 8080},
-					Protocol:   corev1.ProtocolTCP,
-				},
-			},
-		},
-	}
+	podName string,
+	zoneId string,
+	flavor *config.Flavor,
+) (*corev1.Service, error) {
+	return renderer.RenderService(templateValues(instanceId, podName, zoneId, flavor))
 }
 
-func createAndWatchPod(podName string, instanceId string, zoneId string) (string, int32, error) {
-	pod := podFactory(instanceId, podName, zoneId)
-	_, err := k8s_client.TargetClient.CoreV1().Pods(config.K8SNAMSPACE).Create(context.Background(), pod, metav1.CreateOptions{})
+// correlationAnnotation 是 Pod 上记录触发创建的请求关联 ID 的注解，用于从 Pod 追溯到 predict 的预测周期。
+const correlationAnnotation = "dispatcher/correlation-id"
+
+// traceAnnotation 是 Pod 上记录创建该 Pod 的链路追踪 ID 的注解。
+const traceAnnotation = "dispatcher/trace-id"
+
+// createAndWatchPod 创建 Pod 和 Service 并等待实例就绪，standby 为 true 时创建热备实例。
+func createAndWatchPod(ctx context.Context, c *clusterState, podName string, instanceId string, zoneId string, flavor *config.Flavor, standby bool) (serverIp string, nodePort int32, err error) {
+	ctx, span := tracer.Start(ctx, "k8s.createAndWatchPod", trace.WithAttributes(
+		attribute.String("pod_name", podName),
+		attribute.String("cluster", c.Name),
+		attribute.Bool("standby", standby),
+	))
+	defer func() { tracing.End(span, err) }()
+	correlationId := logging.CorrelationID(ctx)
+
+	podFlavor := flavor
+	if standby {
+		// 热备实例以较小的 requests 运行，提升时再原地调整。
+		f := *flavor
+		f.Resources = flavor.StandbyResources()
+		podFlavor = &f
+	}
+	pod, err := podFactory(instanceId, podName, zoneId, podFlavor)
+	if err != nil {
+		return "", 0, fmt.Errorf("error building pod: %w", err)
+	}
+	pod.Labels["cluster"] = c.Name
+	if standby {
+		pod.Labels[standbyLabel] = "1"
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	if correlationId != "" {
+		pod.Annotations[correlationAnnotation] = correlationId
+	}
+	if sc := span.SpanContext(); sc.IsSampled() {
+		pod.Annotations[traceAnnotation] = sc.TraceID().String()
+	}
+	service, err := serviceFactory(instanceId, podName, zoneId, flavor)
+	if err != nil {
+		return "", 0, fmt.Errorf("error building service: %w", err)
+	}
+	serviceName := service.Name
+
+	// 创建 Pod 之前注册就绪通知，避免错过 informer 的事件。
+	readyCh, unwatch := watchPodReady(podName)
+	defer unwatch()
+
+	_, err = c.Client.CoreV1().Pods(config.K8SNAMSPACE).Create(ctx, pod, metav1.CreateOptions{})
 	if err != nil {
 		return "", 0, fmt.Errorf("error creating pod: %w", err)
 	}
+	createdAt := time.Now()
 
-	serviceName := fmt.Sprintf("service-%s", podName)
-	service := serviceFactory(serviceName, instanceId)
-	if service, err = k8s_client.TargetClient.CoreV1().Services(config.K8SNAMSPACE).Create(context.Background(), service, metav1.CreateOptions{}); err != nil {
+	if service, err = c.Client.CoreV1().Services(config.K8SNAMSPACE).Create(ctx, service, metav1.CreateOptions{}); err != nil {
+		// 补偿：删除已经创建的 Pod，避免留下没有 Service 的 Pod。
+		if err := deletePod(c, podName); err != nil {
+			slog.Error("Failed to delete pod after service creation failed", "zone_id", zoneId, "pod_name", podName, "cluster", c.Name, "correlation_id", correlationId, "error", err)
+		}
 		return "", 0, fmt.Errorf("error creating service: %w", err)
 	}
-	nodePort := service.Spec.Ports[0].NodePort
+	nodePort = service.Spec.Ports[0].NodePort
+	span.AddEvent("pod and service created")
 
 	// 监控Pod状态，设置超时时间
 	timeoutDuration := 3 * time.Minute // 超时时长
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutDuration)
+	timeout, cancel := context.WithTimeout(context.Background(), timeoutDuration)
 	defer cancel()
 
-	watchInterface, err := k8s_client.TargetClient.CoreV1().Pods(config.K8SNAMSPACE).Watch(ctx, metav1.ListOptions{
-		FieldSelector: fmt.Sprintf("metadata.name=%s", podName),
-	})
-	if err != nil {
-		return "", 0, fmt.Errorf("error watching Pod: %w", err)
-	}
-
-	ch := watchInterface.ResultChan()
 	for {
 		select {
-		case event := <-ch:
-			pod, ok := event.Object.(*corev1.Pod)
-			if !ok {
-				return "", 0, fmt.Errorf("error watching: unexpected type")
+		case pod := <-readyCh:
+			serverIp := pod.Status.HostIP
+			if checkPodReady(ctx, serverIp, nodePort) {
+				metrics.PodReadyDuration.WithLabelValues(c.Name, flavor.Name).Observe(time.Since(createdAt).Seconds())
+				return serverIp, nodePort, nil
 			}
-
-			if event.Type == watch.Modified {
-				if pod.Status.Phase == corev1.PodRunning {
-					for _, cond := range pod.Status.Conditions {
-						if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
-							serverIp := pod.Status.HostIP
-							if serverIp != "" && checkPodReady(serverIp, nodePort) {
-								watchInterface.Stop()
-								return serverIp, nodePort, nil
-							}
-						}
-					}
-				}
-			}
-		case <-ctx.Done():
-			watchInterface.Stop()
-			err := deletePodAndService(podName, serviceName)
+		case <-timeout.Done():
+			err := deletePodAndService(c, podName, serviceName)
 			if err != nil {
 				return "", 0, fmt.Errorf("pod %s not ready within timeout, error dealing timeout: %w", podName, err)
 			}
@@ -184,92 +160,90 @@ func createAndWatchPod(podName string, instanceId string, zoneId string) (string
 	}
 }
 
-func ensureK8sDBConsistency(zoneId string) error {
-	// 1. 从集群中获取对应zone下的实例
-	podLabelSelector := fmt.Sprintf("zone_id=%s", zoneId)
-	podList, err := k8s_client.TargetClient.CoreV1().Pods(config.K8SNAMSPACE).List(context.Background(), metav1.ListOptions{
-		LabelSelector: podLabelSelector,
-	})
+func ensureK8sDBConsistency(ctx context.Context, zoneId string) (err error) {
+	_, span := tracer.Start(ctx, "manager.ensureK8sDBConsistency")
+	defer func() { tracing.End(span, err) }()
 
-	if err != nil {
-		return fmt.Errorf("failed to get pod list from kubernetes when checking: %w", err)
-	}
 	var (
 		wg    sync.WaitGroup
 		mu    sync.Mutex
 		count = int32(0)
+		total = int32(0)
 		ch    = make(chan struct{}, 50)
 	)
 
-	// 2. 遍历pod，确认和数据库状态一致
-	for _, pod := range podList.Items {
-		wg.Add(1)
-		ch <- struct{}{}
-		go func(pod corev1.Pod) {
-			defer wg.Done()
-			defer func() { <-ch }()
-
-			instanceName := fmt.Sprintf("instance-%s", pod.Name)
-			serviceName := fmt.Sprintf("service-%s", pod.Name)
-			nodePort := int32(0)
+	for _, c := range clusters {
+		if !c.Healthy() {
+			slog.Warn("Cluster is unhealthy, skip checking its instances", "zone_id", zoneId, "cluster", c.Name)
+			continue
+		}
+		// 1. 从缓存中获取对应zone下的实例
+		podList, err := c.listPods(labels.Set{"zone_id": zoneId})
+		if err != nil {
+			return fmt.Errorf("failed to get pod list of cluster %s from cache when checking: %w", c.Name, err)
+		}
+		total += int32(len(podList))
 
-			// 从service获取port
-			service, err := k8s_client.TargetClient.CoreV1().Services(config.K8SNAMSPACE).Get(context.Background(), serviceName, metav1.GetOptions{})
-			if err != nil {
-				log.Printf("Failed to get service when checking: %v", err)
-				return
+		// 2. 遍历pod，确认和数据库状态一致，热备实例没有入库，不需要检查
+		for _, pod := range podList {
+			if isStandby(pod) {
+				total--
+				continue
 			}
-			for _, port := range service.Spec.Ports {
-				if port.NodePort != 0 {
-					nodePort = port.NodePort
-					break
+			wg.Add(1)
+			ch <- struct{}{}
+			go func(c *clusterState, pod *corev1.Pod) {
+				defer wg.Done()
+				defer func() { <-ch }()
+
+				instanceName := fmt.Sprintf("instance-%s", pod.Name)
+
+				// 从service获取port
+				nodePort, err := getNodePort(c, pod.Name)
+				if err != nil {
+					slog.Warn("Failed to get port when checking", "zone_id", zoneId, "pod_name", pod.Name, "error", err)
+					return
 				}
-			}
-			if nodePort == 0 {
-				log.Printf("Failed to get port of %s when checking", service)
-				return
-			}
 
-			if err := checkInstanceStatus(zoneId, pod.Status.HostIP, nodePort, instanceName); err != nil {
-				log.Printf("Failed to check instance status: %v", err)
-				return
-			}
+				if err := checkInstanceStatus(ctx, zoneId, pod.Status.HostIP, nodePort, instanceName); err != nil {
+					slog.Warn("Failed to check instance status", "zone_id", zoneId, "pod_name", pod.Name, "error", err)
+					return
+				}
 
-			mu.Lock()
-			count++
-			mu.Unlock()
-		}(pod)
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}(c, pod)
+		}
 	}
 	wg.Wait()
 
-	total := int32(len(podList.Items))
+	span.SetAttributes(attribute.Int("total", int(total)), attribute.Int("failed", int(total-count)))
 	if count != total {
-		log.Printf("There are %d ready instances in %s totally, and %d instances failed to synchronized", total, zoneId, total-count)
+		slog.Warn("Some instances failed to synchronize", "zone_id", zoneId, "total", total, "failed", total-count)
 	}
 	return nil
 }
 
-func checkInstanceStatus(zoneId string, host string, port int32, instanceName string) error {
+func checkInstanceStatus(ctx context.Context, zoneId string, host string, port int32, instanceName string) error {
 	status, err := getInstanceStatus(host, port)
 	if err != nil {
 		return fmt.Errorf("failed to get instance status: %w", err)
 	}
-	if err := mysql_service.SynchronizeInstanceStatus(zoneId, instanceName, status); err != nil {
+	if err := mysql_service.SynchronizeInstanceStatus(ctx, zoneId, instanceName, status); err != nil {
 		return fmt.Errorf("failed to synchronize instance status for %s: %w", instanceName, err)
 	}
 	return nil
 }
 
-func deletePodAndService(podName string, serviceName string) error {
+// deletePodAndService 先删除 Pod 再删除 Service，已经不存在的资源视为删除成功，可以重复调用。
+func deletePodAndService(c *clusterState, podName string, serviceName string) error {
 	var builder strings.Builder
-	if err := k8s_client.TargetClient.CoreV1().Services(config.K8SNAMSPACE).Delete(context.Background(), serviceName, metav1.DeleteOptions{}); err != nil {
-		builder.WriteString(fmt.Sprintf("error deleting service %s: %v.", serviceName, err))
+	if err := deletePod(c, podName); err != nil {
+		builder.WriteString(fmt.Sprintf("%v.", err))
 	}
-
-	if err := k8s_client.TargetClient.CoreV1().Pods(config.K8SNAMSPACE).Delete(context.Background(), podName, metav1.DeleteOptions{
-		GracePeriodSeconds: func() *int64 { t := int64(0); return &t }(),
-	}); err != nil {
-		builder.WriteString(fmt.Sprintf("error deleting pod %s: %v.", podName, err))
+	if err := deleteService(c, serviceName); err != nil {
+		builder.WriteString(fmt.Sprintf("%v.", err))
 	}
 
 	if builder.Len() == 0 {
@@ -279,12 +253,41 @@ func deletePodAndService(podName string, serviceName string) error {
 	}
 }
 
-func queryCurrentInstanesInCenter(zoneId string) (int, error) {
-	podList, err := k8s_client.TargetClient.CoreV1().Pods(config.K8SNAMSPACE).List(context.Background(), metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("zone_id=%s, is_elastic=1", zoneId),
+func deletePod(c *clusterState, podName string) error {
+	err := c.Client.CoreV1().Pods(config.K8SNAMSPACE).Delete(context.Background(), podName, metav1.DeleteOptions{
+		GracePeriodSeconds: func() *int64 { t := int64(0); return &t }(),
 	})
-	if err != nil {
-		return 0, fmt.Errorf("error listing pods :%v", err)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting pod %s: %w", podName, err)
+	}
+	return nil
+}
+
+func deleteService(c *clusterState, serviceName string) error {
+	err := c.Client.CoreV1().Services(config.K8SNAMSPACE).Delete(context.Background(), serviceName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting service %s: %w", serviceName, err)
+	}
+	return nil
+}
+
+// flavor 为空时统计该 zone 下所有规格的弹性实例，包括所有集群中的实例，不包括热备实例。
+func queryCurrentInstanesInCenter(zoneId string, flavor string) (int, error) {
+	set := labels.Set{"zone_id": zoneId, "is_elastic": "1"}
+	if flavor != "" {
+		set["flavor"] = flavor
+	}
+	count := 0
+	for _, c := range clusters {
+		podList, err := c.listPods(set)
+		if err != nil {
+			return 0, fmt.Errorf("error listing pods in cluster %s: %v", c.Name, err)
+		}
+		for _, pod := range podList {
+			if !isStandby(pod) {
+				count++
+			}
+		}
 	}
-	return len(podList.Items), nil
+	return count, nil
 }
@@ -0,0 +1,191 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"manager/config"
+	mysql_service "manager/mysql/service"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const maintenanceNoticeInterval = 30 * time.Second
+
+// MaintenanceRequest 是创建维护窗口的请求，时间为 2006-01-02 15:04:05 或 2006-01-02 格式，site_id 为空时对整个 zone 生效。
+type MaintenanceRequest struct {
+	SiteId string `json:"site_id"`
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Reason string `json:"reason"`
+}
+
+// MaintenanceEventData 是 maintenance.drain 事件的内容，Sessions 为需要迁移的终端。
+type MaintenanceEventData struct {
+	ZoneId   string                           `json:"zone_id"`
+	Window   *mysql_service.MaintenanceWindow `json:"window"`
+	Sessions []mysql_service.Session          `json:"sessions"`
+}
+
+// CreateMaintenanceWindow 创建维护窗口。窗口内站点的固定实例不再分配给终端，predict 将站点容量视为 0 并提前申请弹性实例，
+// 窗口开始前 MAINTENANCEDRAINNOTICE 通知正在使用这些实例的终端迁移。
+func CreateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	reqBody := MaintenanceRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+	start, err := parseQueryTime(reqBody.Start, false)
+	if err != nil {
+		sendBadRequest(w, "invalid start: "+err.Error())
+		return
+	}
+	end, err := parseQueryTime(reqBody.End, true)
+	if err != nil {
+		sendBadRequest(w, "invalid end: "+err.Error())
+		return
+	}
+	if !start.Before(end) {
+		sendBadRequest(w, "start must be earlier than end")
+		return
+	}
+	if !end.After(time.Now()) {
+		sendBadRequest(w, "end must be in the future")
+		return
+	}
+	if strings.TrimSpace(reqBody.Reason) == "" {
+		sendBadRequest(w, "reason is required")
+		return
+	}
+	if reqBody.SiteId != "" {
+		site, err := mysql_service.GetSite(zoneId, reqBody.SiteId)
+		if err != nil {
+			sendInternalError(w, err)
+			return
+		}
+		if site == nil {
+			sendNotFound(w, fmt.Sprintf("Site %s not found in zone %s", reqBody.SiteId, zoneId))
+			return
+		}
+	}
+
+	window := &mysql_service.MaintenanceWindow{
+		Id:       string(uuid.NewUUID()),
+		ZoneId:   zoneId,
+		SiteId:   reqBody.SiteId,
+		StartsAt: start.Format(queryTimeLayout),
+		EndsAt:   end.Format(queryTimeLayout),
+		Reason:   reqBody.Reason,
+	}
+	if err := mysql_service.InsertMaintenanceWindow(window); err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	slog.Info("Maintenance window created", "zone_id", zoneId, "site_id", window.SiteId, "window_id", window.Id, "starts_at", window.StartsAt, "ends_at", window.EndsAt)
+	sendCreated(w, window)
+}
+
+// ListMaintenanceWindows 返回 zone 中还没有结束的维护窗口，参数 all=true 时同时返回已经结束的窗口。
+func ListMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	windows, err := mysql_service.ListMaintenanceWindows(zoneId, r.URL.Query().Get("all") == "true")
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, windows)
+}
+
+// CancelMaintenanceWindow 取消维护窗口，进行中的窗口取消后站点立即恢复。
+func CancelMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	zoneId, ok := pathZone(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	window, err := mysql_service.GetMaintenanceWindow(zoneId, id)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	if window == nil {
+		sendNotFound(w, fmt.Sprintf("Maintenance window %s not found in zone %s", id, zoneId))
+		return
+	}
+	if _, err := mysql_service.DeleteMaintenanceWindow(zoneId, id); err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	slog.Info("Maintenance window cancelled", "zone_id", zoneId, "site_id", window.SiteId, "window_id", id)
+	sendOK(w, window)
+}
+
+// StartMaintenanceNotifier 定期检查即将开始的维护窗口，将站点的固定实例改为 draining，并向订阅方发送 maintenance.drain 事件通知终端迁移，
+// 每个窗口只通知一次。窗口结束或被取消后，已经没有终端的 draining 实例恢复为 available。
+func StartMaintenanceNotifier(ctx context.Context) {
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		restoreDrainedInstances()
+		sendDrainNotices()
+	}, maintenanceNoticeInterval)
+}
+
+func sendDrainNotices() {
+	windows, err := mysql_service.GetPendingDrainNotices(time.Now().Add(config.MAINTENANCEDRAINNOTICE))
+	if err != nil {
+		slog.Error("Failed to get pending drain notices", "error", err)
+		return
+	}
+	for _, window := range windows {
+		logger := slog.With("zone_id", window.ZoneId, "site_id", window.SiteId, "window_id", window.Id)
+		sessions, err := mysql_service.GetEdgeSessions(window.ZoneId, window.SiteId)
+		if err != nil {
+			logger.Error("Failed to get edge sessions", "error", err)
+			continue
+		}
+		// 修改失败时不标记已通知，下一次检查重试，已经是 draining 的实例不会重复修改。
+		drained, err := mysql_service.DrainEdgeInstances(window.ZoneId, window.SiteId, "maintenance "+window.Id)
+		if err != nil {
+			logger.Error("Failed to drain edge instances", "drained", drained, "error", err)
+			continue
+		}
+		now := time.Now()
+		if err := mysql_service.SetDrainNotified(window.Id, now); err != nil {
+			logger.Error("Failed to mark drain notified", "error", err)
+			continue
+		}
+		window.DrainNotifiedAt = now.Format(queryTimeLayout)
+		emitEvent(EventMaintenanceDrain, &MaintenanceEventData{ZoneId: window.ZoneId, Window: window, Sessions: sessions})
+		logger.Info("Drain notice sent", "sessions", len(sessions), "drained", drained, "starts_at", window.StartsAt)
+	}
+}
+
+func restoreDrainedInstances() {
+	zones, err := mysql_service.GetZoneListInDB()
+	if err != nil {
+		slog.Error("Failed to get zone list", "error", err)
+		return
+	}
+	for _, zoneId := range zones {
+		restored, err := mysql_service.RestoreDrainedInstances(zoneId)
+		if err != nil {
+			slog.Error("Failed to restore drained instances", "zone_id", zoneId, "error", err)
+			continue
+		}
+		if restored > 0 {
+			slog.Info("Drained instances restored", "zone_id", zoneId, "instances", restored)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package apis
+
+import (
+	instancestate "common/instance"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectDrainTransition 模拟固定实例 instanceId 的一次状态变更。
+func expectDrainTransition(mock sqlmock.Sqlmock, instanceId string, from instancestate.State, to instancestate.State) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE instance_huadong SET status = \\? WHERE instance_id = \\? AND status = \\?").
+		WithArgs(to, instanceId, from).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO instance_state_history").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestDrainNoticeDrainsSiteInstances(t *testing.T) {
+	mock := newTestDB(t)
+	mock.ExpectQuery("FROM maintenance_windows WHERE drain_notified_at IS NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "zone_id", "site_id", "starts_at", "ends_at", "reason", "drain_notified_at", "created_at"}).
+			AddRow("window-1", "huadong", "site-1", "2026-10-19 10:00:00", "2026-10-19 12:00:00", "upgrade", nil, "2026-10-18 10:00:00"))
+	mock.ExpectQuery("SELECT site_id, instance_id, device_id FROM instance_huadong WHERE is_elastic = 0 AND status IN \\('using', 'draining'\\) AND device_id != 'null'").
+		WithArgs("site-1", "site-1").
+		WillReturnRows(sqlmock.NewRows([]string{"site_id", "instance_id", "device_id"}).AddRow("site-1", "instance-2", "device-2"))
+	mock.ExpectQuery("SELECT instance_id, status FROM instance_huadong WHERE is_elastic = 0 AND status IN \\('available', 'using'\\)").
+		WithArgs("site-1", "site-1").
+		WillReturnRows(sqlmock.NewRows([]string{"instance_id", "status"}).AddRow("instance-1", "available").AddRow("instance-2", "using").AddRow("instance-3", "available"))
+	expectDrainTransition(mock, "instance-1", instancestate.Available, instancestate.Draining)
+	expectDrainTransition(mock, "instance-2", instancestate.Using, instancestate.Draining)
+	// instance-3 在查询之后被终端登录，跳过。
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE instance_huadong SET status = \\?").WithArgs(instancestate.Draining, "instance-3", instancestate.Available).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectExec("UPDATE maintenance_windows SET drain_notified_at = \\? WHERE id = \\?").
+		WithArgs(sqlmock.AnyArg(), "window-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("FROM webhook_subscriptions").WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret", "events", "created_at"}))
+
+	sendDrainNotices()
+	waitExpectations(t, mock)
+}
+
+func TestRestoreDrainedInstances(t *testing.T) {
+	mock := newTestDB(t)
+	expectZones(mock, "huadong")
+	// 终端已经登出，且站点不在已通知迁移的维护窗口内的实例才恢复。
+	mock.ExpectQuery("SELECT instance_id FROM instance_huadong i WHERE is_elastic = 0 AND status = 'draining' AND device_id = 'null'\\s+AND NOT EXISTS \\(SELECT 1 FROM maintenance_windows").
+		WithArgs("huadong", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"instance_id"}).AddRow("instance-1"))
+	expectDrainTransition(mock, "instance-1", instancestate.Draining, instancestate.Available)
+
+	restoreDrainedInstances()
+}
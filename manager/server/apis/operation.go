@@ -0,0 +1,173 @@
+package apis
+
+import (
+	"common/logging"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"manager/metrics"
+	mysql_service "manager/mysql/service"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+const (
+	OperationPending   = "pending"
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+
+	InstanceActionApply   = "apply"
+	InstanceActionRelease = "release"
+
+	InstancePending  = "pending"  // 正在创建或回收
+	InstanceReady    = "ready"    // 创建完成并已入库
+	InstanceReleased = "released" // 回收完成
+	InstanceFailed   = "failed"
+	InstanceRetried  = "retried" // 创建失败，已经换一个 Pod 重试
+)
+
+// liveOperations 记录本进程中排队或正在执行的操作 ID，value 为空结构体。
+var liveOperations sync.Map
+
+// operation 记录一次扩缩容操作中每个实例的进度，为 nil 时不记录（例如由实例池控制器触发的扩缩容）。
+type operation struct {
+	id string
+	// ctx 携带请求的关联 ID、操作 ID 字段和链路追踪上下文，不随请求结束而取消。
+	ctx context.Context
+}
+
+func newOperation(r *http.Request) *operation {
+	op := &operation{id: string(uuid.NewUUID())}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(r.Context()))
+	ctx = logging.WithCorrelationID(ctx, logging.CorrelationID(r.Context()))
+	op.ctx = logging.With(ctx, "operation_id", op.id)
+	return op
+}
+
+// logger 返回带有 zone 字段和操作关联 ID 的 logger，op 为 nil 时只带有 zone 字段。
+func (op *operation) logger(zoneId string) *slog.Logger {
+	if op == nil {
+		return slog.With("zone_id", zoneId)
+	}
+	return logging.FromContext(op.ctx).With("zone_id", zoneId)
+}
+
+// track 记录实例进度，实例到达终态时无论是否属于某个操作都会发送 webhook 事件。
+func (op *operation) track(zoneId string, flavor string, instanceId string, podName string, action string, status string, message string) {
+	data := &InstanceEventData{
+		ZoneId:     zoneId,
+		Flavor:     flavor,
+		InstanceId: instanceId,
+		PodName:    podName,
+		Message:    message,
+	}
+	if op != nil {
+		data.OperationId = op.id
+	}
+	switch status {
+	case InstanceReady:
+		emitEvent(EventInstanceReady, data)
+	case InstanceReleased:
+		emitEvent(EventInstanceReleased, data)
+	case InstanceFailed:
+		metrics.InstanceFailures.WithLabelValues(action, zoneId, flavor).Inc()
+		emitEvent(EventInstanceFailed, data)
+	}
+
+	if op == nil {
+		return
+	}
+	err := mysql_service.UpsertOperationInstance(op.id, &mysql_service.OperationInstance{
+		Flavor:     flavor,
+		InstanceId: instanceId,
+		PodName:    podName,
+		Action:     action,
+		Status:     status,
+		Message:    message,
+	})
+	if err != nil {
+		op.logger(zoneId).Error("Failed to record instance progress", "instance_id", instanceId, "error", err)
+	}
+}
+
+// orphanedMessage 是 manager 重启时未完成操作的失败原因。
+const orphanedMessage = "manager restarted"
+
+// FailOrphanedOperations 将上一个主副本遗留的 pending 和 running 操作标记为失败，需要在开始受理请求之前调用。
+// 操作只在进程内的 zone 队列中执行，重启后不会继续，不标记的话等待操作的调用方只能等到超时。
+func FailOrphanedOperations() error {
+	operations, err := mysql_service.FailUnfinishedOperations(orphanedMessage)
+	if err != nil {
+		return err
+	}
+	for _, op := range operations {
+		slog.Warn("Operation orphaned by restart", "operation_id", op.Id, "zone_id", op.ZoneId)
+		emitEvent(EventOperationCompleted, &OperationEventData{
+			OperationId: op.Id,
+			ZoneId:      op.ZoneId,
+			Status:      OperationFailed,
+			Message:     orphanedMessage,
+		})
+	}
+	return nil
+}
+
+type OperationResponse struct {
+	Id        string                            `json:"id"`
+	ZoneId    string                            `json:"zone_id"`
+	Status    string                            `json:"status"`
+	Request   json.RawMessage                   `json:"request"`
+	Result    json.RawMessage                   `json:"result"`
+	Message   string                            `json:"message"`
+	CreatedAt string                            `json:"created_at"`
+	UpdatedAt string                            `json:"updated_at"`
+	Summary   map[string]int                    `json:"summary"` // 各状态的实例数量
+	Instances []mysql_service.OperationInstance `json:"instances"`
+}
+
+func newOperationResponse(op *mysql_service.Operation) *OperationResponse {
+	resp := &OperationResponse{
+		Id:        op.Id,
+		ZoneId:    op.ZoneId,
+		Status:    op.Status,
+		Request:   rawJson(op.Request),
+		Result:    rawJson(op.Result),
+		Message:   op.Message,
+		CreatedAt: op.CreatedAt,
+		UpdatedAt: op.UpdatedAt,
+		Summary:   map[string]int{InstancePending: 0, InstanceReady: 0, InstanceReleased: 0, InstanceFailed: 0, InstanceRetried: 0},
+		Instances: op.Instances,
+	}
+	for _, instance := range op.Instances {
+		resp.Summary[instance.Status]++
+	}
+	return resp
+}
+
+func rawJson(s string) json.RawMessage {
+	if s == "" || !json.Valid([]byte(s)) {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
+
+// GetOperation 查询扩缩容操作的进度。
+func GetOperation(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	op, err := mysql_service.GetOperation(id)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	if op == nil {
+		sendNotFound(w, "Operation "+id+" not found")
+		return
+	}
+
+	sendOK(w, newOperationResponse(op))
+}
@@ -0,0 +1,61 @@
+package apis
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetOperation(t *testing.T) {
+	mock := newTestDB(t)
+	mock.ExpectQuery("SELECT .* FROM operations WHERE id = ?").WithArgs("op-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "zone_id", "status", "request", "result", "message", "created_at", "updated_at"}).
+			AddRow("op-1", "huadong", OperationRunning, `{"zone_id":"huadong"}`, "", "", "2024-06-01 00:00:00", "2024-06-01 00:00:01"))
+	mock.ExpectQuery("SELECT .* FROM operation_instances WHERE operation_id = ?").WithArgs("op-1").
+		WillReturnRows(sqlmock.NewRows([]string{"flavor", "instance_id", "pod_name", "action", "status", "message", "updated_at"}).
+			AddRow("default", "instance-1", "pod-1", InstanceActionApply, InstanceReady, "", "2024-06-01 00:00:01").
+			AddRow("default", "instance-2", "pod-2", InstanceActionApply, InstancePending, "", "2024-06-01 00:00:01"))
+
+	var op OperationResponse
+	w, code := serve(t, GetOperation, httptest.NewRequest(http.MethodGet, "/operations/op-1", nil), map[string]string{"id": "op-1"}, &op)
+	if w.Code != http.StatusOK || code != 200 {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+	if op.Status != OperationRunning || len(op.Instances) != 2 || string(op.Result) != "null" {
+		t.Errorf("unexpected operation %+v", op)
+	}
+	if op.Summary[InstanceReady] != 1 || op.Summary[InstancePending] != 1 || op.Summary[InstanceFailed] != 0 {
+		t.Errorf("unexpected summary %v", op.Summary)
+	}
+}
+
+func TestGetOperationNotFound(t *testing.T) {
+	mock := newTestDB(t)
+	mock.ExpectQuery("SELECT .* FROM operations WHERE id = ?").WithArgs("op-x").WillReturnError(sql.ErrNoRows)
+
+	var detail string
+	w, code := serve(t, GetOperation, httptest.NewRequest(http.MethodGet, "/operations/op-x", nil), map[string]string{"id": "op-x"}, &detail)
+	if w.Code != http.StatusNotFound || code != 404 || detail != "Operation op-x not found" {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+}
+
+func TestFailOrphanedOperations(t *testing.T) {
+	mock := newTestDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, zone_id FROM operations WHERE status IN \\('pending', 'running'\\) FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "zone_id"}).AddRow("op-1", "huadong"))
+	mock.ExpectExec("UPDATE operations SET status = 'failed', message = \\?").WithArgs(orphanedMessage, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// 等待操作的调用方收到 operation.completed 事件。
+	mock.ExpectQuery("FROM webhook_subscriptions").WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret", "events", "created_at"}))
+
+	if err := FailOrphanedOperations(); err != nil {
+		t.Fatal(err)
+	}
+	waitExpectations(t, mock)
+}
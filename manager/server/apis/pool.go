@@ -0,0 +1,71 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"manager/config"
+	"manager/controller"
+	"time"
+
+	k8s_client "manager/k8s-client"
+)
+
+var poolController *controller.PoolController
+
+// poolScaler 基于 apply 和 release 实现 controller.Scaler，与 /instance/manage 共用 zone 队列。
+type poolScaler struct{}
+
+func (poolScaler) Current(_ context.Context, zoneId string, flavor string) (int32, error) {
+	current, err := queryCurrentInstanesInCenter(zoneId, flavor)
+	return int32(current), err
+}
+
+func (poolScaler) Apply(ctx context.Context, zoneId string, flavorName string, replica int32) error {
+	flavor, ok := config.GetFlavor(flavorName)
+	if !ok {
+		return fmt.Errorf("flavor %s is not configured", flavorName)
+	}
+	return runInZone(zoneId, func() error {
+		_, err := apply(ctx, zoneId, flavor, replica, nil)
+		return err
+	})
+}
+
+func (poolScaler) Release(ctx context.Context, zoneId string, flavorName string, replica int32) error {
+	flavor, ok := config.GetFlavor(flavorName)
+	if !ok {
+		return fmt.Errorf("flavor %s is not configured", flavorName)
+	}
+	return runInZone(zoneId, func() error {
+		_, err := release(ctx, zoneId, flavor, replica, nil)
+		return err
+	})
+}
+
+// StartPoolController 启动 ElasticInstancePool 控制器，启动后 /instance/manage 只更新期望实例数量。
+func StartPoolController(ctx context.Context) {
+	poolController = controller.NewPoolController(k8s_client.TargetDynamicClient, config.K8SNAMSPACE, poolScaler{}, 30*time.Second)
+	go func() {
+		if err := poolController.Run(ctx, 4); err != nil {
+			slog.Error("Elastic instance pool controller stopped", "error", err)
+		}
+	}()
+}
+
+// setDesiredReplicas 将 replica 折算为实例池的期望实例数量，由控制器异步完成扩缩容。
+func setDesiredReplicas(zoneId string, flavor *config.Flavor, replica int32) (string, error) {
+	current, err := queryCurrentInstanesInCenter(zoneId, flavor.Name)
+	if err != nil {
+		return "", fmt.Errorf("error quering current instances in zone %s: %w", zoneId, err)
+	}
+	desired := int32(current) + replica
+	if desired < 0 {
+		desired = 0
+	}
+	if err := poolController.SetDesiredReplicas(context.Background(), zoneId, flavor.Name, desired); err != nil {
+		return "", fmt.Errorf("error updating elastic instance pool: %w", err)
+	}
+	slog.Info("Desired replicas updated", "zone_id", zoneId, "flavor", flavor.Name, "desired", desired)
+	return fmt.Sprintf("Desired replicas updated to %d", desired), nil
+}
@@ -0,0 +1,178 @@
+package apis
+
+import (
+	instancestate "common/instance"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"manager/config"
+	"manager/metrics"
+	mysql_service "manager/mysql/service"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	EventInstanceQuarantined = "instance.quarantined"
+	EventInstanceRestored    = "instance.restored"
+
+	probeConcurrency = 50
+)
+
+// probeState 是一个固定实例连续检查成功和失败的次数。
+type probeState struct {
+	failures  int
+	successes int
+}
+
+// edgeProber 定期检查边缘固定实例的 /healthz 和 /getStatus，
+// 可用的实例连续失败 EDGEPROBEFAILURETHRESHOLD 次后隔离，隔离的实例连续成功 EDGEPROBESUCCESSTHRESHOLD 次后恢复。
+// 隔离的实例不再分配给终端，也不计入站点容量。
+type edgeProber struct {
+	client *http.Client
+	mu     sync.Mutex
+	states map[string]*probeState // key 为 zone/instance_id
+}
+
+func StartEdgeProber(ctx context.Context) {
+	if config.EDGEPROBEINTERVAL == 0 {
+		slog.Info("Edge prober is disabled")
+		return
+	}
+	p := &edgeProber{
+		client: &http.Client{Timeout: config.EDGEPROBETIMEOUT},
+		states: make(map[string]*probeState),
+	}
+	go wait.UntilWithContext(ctx, p.probeAll, config.EDGEPROBEINTERVAL)
+}
+
+func (p *edgeProber) probeAll(ctx context.Context) {
+	zones, err := mysql_service.GetZoneListInDB()
+	if err != nil {
+		slog.Error("Failed to get zone list when probing edge instances", "error", err)
+		return
+	}
+
+	var (
+		wg   sync.WaitGroup
+		ch   = make(chan struct{}, probeConcurrency)
+		seen = make(map[string]bool)
+	)
+	for _, zoneId := range zones {
+		instances, err := mysql_service.GetProbeTargets(zoneId)
+		if err != nil {
+			slog.Error("Failed to get edge instances to probe", "zone_id", zoneId, "error", err)
+			continue
+		}
+		for _, instance := range instances {
+			seen[zoneId+"/"+instance.InstanceId] = true
+			wg.Add(1)
+			ch <- struct{}{}
+			go func(instance *mysql_service.EdgeInstance) {
+				defer wg.Done()
+				defer func() { <-ch }()
+				p.probe(ctx, instance)
+			}(instance)
+		}
+	}
+	wg.Wait()
+
+	// 已经下线或者接入终端的实例重新计数。
+	p.mu.Lock()
+	for key := range p.states {
+		if !seen[key] {
+			delete(p.states, key)
+		}
+	}
+	p.mu.Unlock()
+}
+
+func (p *edgeProber) probe(ctx context.Context, instance *mysql_service.EdgeInstance) {
+	logger := slog.With("zone_id", instance.ZoneId, "site_id", instance.SiteId, "instance_id", instance.InstanceId)
+	err := p.check(ctx, instance.ServerIp, instance.Port)
+	result := "success"
+	if err != nil {
+		result = "failure"
+		logger.Debug("Edge instance probe failed", "error", err)
+	}
+	metrics.EdgeProbes.WithLabelValues(instance.ZoneId, instance.SiteId, result).Inc()
+
+	key := instance.ZoneId + "/" + instance.InstanceId
+	p.mu.Lock()
+	state, ok := p.states[key]
+	if !ok {
+		state = &probeState{}
+		p.states[key] = state
+	}
+	if err != nil {
+		state.failures++
+		state.successes = 0
+	} else {
+		state.successes++
+		state.failures = 0
+	}
+	quarantine := instance.Status == instancestate.Available && state.failures >= config.EDGEPROBEFAILURETHRESHOLD
+	restore := instance.Status == instancestate.Quarantined && state.successes >= config.EDGEPROBESUCCESSTHRESHOLD
+	p.mu.Unlock()
+
+	switch {
+	case quarantine:
+		// 只在实例仍然可用时隔离，避免覆盖检查期间接入终端的实例。
+		updated, cerr := mysql_service.CompareAndSetInstanceStatus(instance.ZoneId, instance.InstanceId, instancestate.Available, instancestate.Quarantined, "health probe failed: "+err.Error())
+		if cerr != nil {
+			logger.Error("Failed to quarantine edge instance", "error", cerr)
+			return
+		}
+		if updated {
+			logger.Warn("Edge instance quarantined", "failures", config.EDGEPROBEFAILURETHRESHOLD, "error", err)
+			emitEvent(EventInstanceQuarantined, &InstanceEventData{
+				ZoneId:     instance.ZoneId,
+				Flavor:     instance.Flavor,
+				InstanceId: instance.InstanceId,
+				PodName:    instance.PodName,
+				Message:    err.Error(),
+			})
+		}
+	case restore:
+		updated, cerr := mysql_service.CompareAndSetInstanceStatus(instance.ZoneId, instance.InstanceId, instancestate.Quarantined, instancestate.Available, "health probe recovered")
+		if cerr != nil {
+			logger.Error("Failed to restore edge instance", "error", cerr)
+			return
+		}
+		if updated {
+			logger.Info("Edge instance restored", "successes", config.EDGEPROBESUCCESSTHRESHOLD)
+			emitEvent(EventInstanceRestored, &InstanceEventData{
+				ZoneId:     instance.ZoneId,
+				Flavor:     instance.Flavor,
+				InstanceId: instance.InstanceId,
+				PodName:    instance.PodName,
+			})
+		}
+	}
+}
+
+// check 依次请求实例的 /healthz 和 /getStatus，都返回 200 时视为健康。
+func (p *edgeProber) check(ctx context.Context, host string, port int32) error {
+	address := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	for _, path := range []string{"/healthz", "/getStatus"} {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", address, path), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := p.client.Do(request)
+		if err != nil {
+			return fmt.Errorf("error requesting %s: %w", path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %s from %s", resp.Status, path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package apis
+
+import (
+	instancestate "common/instance"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"manager/config"
+	mysql_service "manager/mysql/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectProbeTransition 模拟一次状态变更，以及投递事件时查询订阅。
+func expectProbeTransition(mock sqlmock.Sqlmock, from instancestate.State, to instancestate.State) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE instance_huadong SET status = \\? WHERE instance_id = \\? AND status = \\?").
+		WithArgs(to, "instance-1", from).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO instance_state_history").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("FROM webhook_subscriptions").WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret", "events", "created_at"}))
+}
+
+// waitExpectations 等待异步投递事件时的查询完成。
+func waitExpectations(t *testing.T, mock sqlmock.Sqlmock) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := mock.ExpectationsWereMet()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEdgeProberThresholds(t *testing.T) {
+	mock := newTestDB(t)
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	instance := &mysql_service.EdgeInstance{ZoneId: "huadong", SiteId: "site-1", InstanceId: "instance-1", ServerIp: host, Port: int32(p), Status: instancestate.Available}
+	prober := &edgeProber{client: server.Client(), states: make(map[string]*probeState)}
+	events, unsubscribe := dashboardEvents.subscribe()
+	defer unsubscribe()
+
+	// 连续失败达到阈值前不隔离。
+	for i := 1; i < config.EDGEPROBEFAILURETHRESHOLD; i++ {
+		prober.probe(context.Background(), instance)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	expectProbeTransition(mock, instancestate.Available, instancestate.Quarantined)
+	prober.probe(context.Background(), instance)
+	waitExpectations(t, mock)
+	if e := <-events; e.Type != EventInstanceQuarantined {
+		t.Errorf("unexpected event %s", e.Type)
+	}
+
+	// 恢复需要连续成功，中间的失败重新计数。
+	instance.Status = instancestate.Quarantined
+	healthy.Store(true)
+	for i := 1; i < config.EDGEPROBESUCCESSTHRESHOLD; i++ {
+		prober.probe(context.Background(), instance)
+	}
+	healthy.Store(false)
+	prober.probe(context.Background(), instance)
+	healthy.Store(true)
+	for i := 1; i < config.EDGEPROBESUCCESSTHRESHOLD; i++ {
+		prober.probe(context.Background(), instance)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	expectProbeTransition(mock, instancestate.Quarantined, instancestate.Available)
+	prober.probe(context.Background(), instance)
+	waitExpectations(t, mock)
+	if e := <-events; e.Type != EventInstanceRestored {
+		t.Errorf("unexpected event %s", e.Type)
+	}
+}
@@ -0,0 +1,329 @@
+package apis
+
+import (
+	instancestate "common/instance"
+	"context"
+	"fmt"
+	"log/slog"
+	"manager/config"
+	mysql_service "manager/mysql/service"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	IssueOrphanPod     = "orphan_pod"     // 集群中有 Pod，数据库中没有记录
+	IssueOrphanRow     = "orphan_row"     // 数据库中有记录，集群中没有 Pod
+	IssueOrphanService = "orphan_service" // service-* 没有对应的 Pod
+	IssueStuckPod      = "stuck_pod"      // Pod 长时间未就绪
+
+	ActionAdopt  = "adopt"
+	ActionDelete = "delete"
+	ActionAlert  = "alert"
+
+	// 刚创建的资源可能还在 createAndWatchPod 中等待就绪，尚未入库，在此期间不做处理。
+	reconcileGracePeriod = 5 * time.Minute
+)
+
+type ReconcileIssue struct {
+	Kind   string `json:"kind"`
+	ZoneId string `json:"zone_id"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Detail string `json:"detail"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ReconcileReport struct {
+	DryRun bool             `json:"dry_run"`
+	Time   string           `json:"time"`
+	Issues []ReconcileIssue `json:"issues"`
+}
+
+// reconcileMu 保证同一时间只有一次调谐在执行。
+var reconcileMu sync.Mutex
+
+// StartReconciler 周期性检查集群和数据库的一致性，并按配置的动作修复。
+func StartReconciler(ctx context.Context) {
+	if config.RECONCILEINTERVAL == 0 {
+		slog.Info("Background reconciler is disabled")
+		return
+	}
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		report, err := reconcile(false)
+		if err != nil {
+			slog.Error("Failed to reconcile kubernetes and database", "error", err)
+			return
+		}
+		if len(report.Issues) > 0 {
+			slog.Info("Reconciler found issues", "issues", len(report.Issues))
+		}
+	}, time.Duration(config.RECONCILEINTERVAL)*time.Second)
+}
+
+// ReconcileReportHandler 返回一次 dry-run 的调谐结果，只检查不修复。
+func ReconcileReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := reconcile(true)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, report)
+}
+
+func reconcile(dryRun bool) (*ReconcileReport, error) {
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	report := &ReconcileReport{DryRun: dryRun, Time: time.Now().Format(time.RFC3339), Issues: []ReconcileIssue{}}
+	zones, err := mysql_service.GetZoneListInDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get zone list: %w", err)
+	}
+
+	// 不健康的集群缓存可能不完整，跳过其中的 Pod 和记录，避免误删。
+	type clusterPod struct {
+		cluster *clusterState
+		pod     *corev1.Pod
+	}
+	var pods []clusterPod
+	podsByName := make(map[string]*corev1.Pod)
+	skipped := make(map[string]bool)
+	for _, c := range clusters {
+		if !c.Healthy() {
+			skipped[c.Name] = true
+			continue
+		}
+		clusterPods, err := c.listPods(labels.Set{"is_elastic": "1"})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods of cluster %s from cache: %w", c.Name, err)
+		}
+		for _, pod := range clusterPods {
+			pods = append(pods, clusterPod{cluster: c, pod: pod})
+			podsByName[pod.Name] = pod
+		}
+	}
+
+	for _, zoneId := range zones {
+		instances, err := mysql_service.GetElasticInstances(zoneId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get elastic instances in %s: %w", zoneId, err)
+		}
+		rowsByPod := make(map[string]bool, len(instances))
+		for _, instance := range instances {
+			rowsByPod[instance.PodName] = true
+			// 集群已经不在配置中时无法确认 Pod 是否存在，保留记录。
+			if c := getCluster(instance.Cluster); c == nil || skipped[c.Name] {
+				continue
+			}
+			// provisioning 的实例在创建 Pod 之前入库，Pod 可能还没有出现在缓存中。
+			if instance.Status == string(instancestate.Provisioning) && reserved(instance.PodName) {
+				continue
+			}
+			if _, ok := podsByName[instance.PodName]; !ok {
+				report.add(dryRun, reconcileOrphanRow(zoneId, instance, dryRun))
+			}
+		}
+
+		for _, p := range pods {
+			pod := p.pod
+			// 热备实例没有入库，由热备池自己维护。
+			if pod.Labels["zone_id"] != zoneId || isStandby(pod) || !settled(pod.CreationTimestamp) {
+				continue
+			}
+			if !rowsByPod[pod.Name] {
+				report.add(dryRun, reconcileOrphanPod(p.cluster, zoneId, pod, dryRun))
+			} else if isStuck(pod) {
+				report.add(dryRun, reconcileStuckPod(p.cluster, zoneId, pod, dryRun))
+			}
+		}
+	}
+
+	for _, c := range clusters {
+		if skipped[c.Name] {
+			continue
+		}
+		services, err := c.Client.CoreV1().Services(config.K8SNAMSPACE).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list services of cluster %s: %w", c.Name, err)
+		}
+		for i := range services.Items {
+			service := &services.Items[i]
+			if !strings.HasPrefix(service.Name, "service-") || !settled(service.CreationTimestamp) {
+				continue
+			}
+			podName := strings.TrimPrefix(service.Name, "service-")
+			if _, err := c.podLister.Pods(config.K8SNAMSPACE).Get(podName); err == nil {
+				continue
+			}
+			// 非弹性实例的 Pod 不在缓存中，需要再确认一次。
+			_, err := c.Client.CoreV1().Pods(config.K8SNAMSPACE).Get(context.Background(), podName, metav1.GetOptions{})
+			if err == nil {
+				continue
+			} else if !apierrors.IsNotFound(err) {
+				slog.Warn("Failed to get pod when reconciling", "pod_name", podName, "cluster", c.Name, "error", err)
+				continue
+			}
+			report.add(dryRun, reconcileOrphanService(c, service, dryRun))
+		}
+	}
+	return report, nil
+}
+
+func (r *ReconcileReport) add(dryRun bool, issue ReconcileIssue) {
+	r.Issues = append(r.Issues, issue)
+	if dryRun {
+		return
+	}
+	logger := slog.With("zone_id", issue.ZoneId, "kind", issue.Kind, "name", issue.Name, "action", issue.Action)
+	if issue.Error != "" {
+		logger.Error("Reconcile failed", "error", issue.Error)
+	} else {
+		logger.Info("Reconciled", "detail", issue.Detail)
+	}
+}
+
+func settled(created metav1.Time) bool {
+	return time.Since(created.Time) > reconcileGracePeriod
+}
+
+// isStuck 判断 Pod 是否长时间未就绪，正在 createAndWatchPod 中等待的 Pod 不算。
+func isStuck(pod *corev1.Pod) bool {
+	if isPodReady(pod) {
+		return false
+	}
+	waitersMu.Lock()
+	_, waiting := podWaiters[pod.Name]
+	waitersMu.Unlock()
+	if waiting {
+		return false
+	}
+
+	since := pod.CreationTimestamp.Time
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady && cond.LastTransitionTime.After(since) {
+			since = cond.LastTransitionTime.Time
+		}
+	}
+	return time.Since(since) > time.Duration(config.RECONCILESTUCKTIMEOUT)*time.Second
+}
+
+func reconcileOrphanPod(c *clusterState, zoneId string, pod *corev1.Pod, dryRun bool) ReconcileIssue {
+	issue := ReconcileIssue{
+		Kind:   IssueOrphanPod,
+		ZoneId: zoneId,
+		Name:   pod.Name,
+		Action: config.RECONCILEORPHANPODACTION,
+		Detail: fmt.Sprintf("pod %s in cluster %s has no record in instance_%s", pod.Name, c.Name, zoneId),
+	}
+	if dryRun {
+		return issue
+	}
+
+	switch issue.Action {
+	case ActionAdopt:
+		if !isPodReady(pod) {
+			issue.Error = "pod is not ready, it cannot be adopted"
+			return issue
+		}
+		nodePort, err := getNodePort(c, pod.Name)
+		if err != nil {
+			issue.Error = err.Error()
+			return issue
+		}
+		flavor := pod.Labels["flavor"]
+		if flavor == "" {
+			flavor = config.DefaultFlavor
+		}
+		instanceId := pod.Labels["instance_id"]
+		if instanceId == "" {
+			instanceId = fmt.Sprintf("instance-%s", pod.Name)
+		}
+		if err := mysql_service.InsertInstance(zoneId, "null", pod.Status.HostIP, instanceId, pod.Name, nodePort, 1, instancestate.Available, "null", flavor, c.Name); err != nil {
+			issue.Error = err.Error()
+			return issue
+		}
+		// 被收养的实例可能正在被使用，入库后同步一次状态。
+		if err := checkInstanceStatus(context.Background(), zoneId, pod.Status.HostIP, nodePort, instanceId); err != nil {
+			slog.Warn("Failed to synchronize status of adopted instance", "zone_id", zoneId, "instance_id", instanceId, "error", err)
+		}
+	case ActionDelete:
+		if err := deletePodAndService(c, pod.Name, fmt.Sprintf("service-%s", pod.Name)); err != nil {
+			issue.Error = err.Error()
+		}
+	}
+	return issue
+}
+
+func reconcileOrphanRow(zoneId string, instance mysql_service.ElasticInstance, dryRun bool) ReconcileIssue {
+	issue := ReconcileIssue{
+		Kind:   IssueOrphanRow,
+		ZoneId: zoneId,
+		Name:   instance.InstanceId,
+		Action: config.RECONCILEORPHANROWACTION,
+		Detail: fmt.Sprintf("instance %s (%s) has no pod %s", instance.InstanceId, instance.Status, instance.PodName),
+	}
+	if dryRun {
+		return issue
+	}
+
+	if issue.Action == ActionDelete {
+		if _, err := mysql_service.DeleteInstance(zoneId, instance.InstanceId); err != nil {
+			issue.Error = err.Error()
+		}
+	}
+	return issue
+}
+
+func reconcileOrphanService(c *clusterState, service *corev1.Service, dryRun bool) ReconcileIssue {
+	issue := ReconcileIssue{
+		Kind:   IssueOrphanService,
+		ZoneId: service.Labels["zone_id"],
+		Name:   service.Name,
+		Action: config.RECONCILEORPHANSERVICEACTION,
+		Detail: fmt.Sprintf("service %s in cluster %s has no pod %s", service.Name, c.Name, strings.TrimPrefix(service.Name, "service-")),
+	}
+	if dryRun {
+		return issue
+	}
+
+	if issue.Action == ActionDelete {
+		if err := deleteService(c, service.Name); err != nil {
+			issue.Error = err.Error()
+		}
+	}
+	return issue
+}
+
+func reconcileStuckPod(c *clusterState, zoneId string, pod *corev1.Pod, dryRun bool) ReconcileIssue {
+	issue := ReconcileIssue{
+		Kind:   IssueStuckPod,
+		ZoneId: zoneId,
+		Name:   pod.Name,
+		Action: config.RECONCILESTUCKPODACTION,
+		Detail: fmt.Sprintf("pod %s in cluster %s is %s and not ready for more than %ds", pod.Name, c.Name, pod.Status.Phase, config.RECONCILESTUCKTIMEOUT),
+	}
+	if dryRun {
+		return issue
+	}
+
+	if issue.Action == ActionDelete {
+		// 先删除记录，避免卡住的实例继续被分配给终端。
+		if _, err := mysql_service.DeleteInstance(zoneId, pod.Labels["instance_id"]); err != nil {
+			issue.Error = err.Error()
+			return issue
+		}
+		if err := deletePodAndService(c, pod.Name, fmt.Sprintf("service-%s", pod.Name)); err != nil {
+			issue.Error = err.Error()
+		}
+	}
+	return issue
+}
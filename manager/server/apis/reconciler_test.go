@@ -0,0 +1,107 @@
+package apis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPod(name string, zoneId string, created time.Time) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         "default",
+		Labels:            map[string]string{"is_elastic": "1", "zone_id": zoneId, "instance_id": "instance-" + name},
+		CreationTimestamp: metav1.NewTime(created),
+	}}
+}
+
+// markReady 将 Pod 标记为已就绪。
+func markReady(pod *corev1.Pod) *corev1.Pod {
+	pod.Status = corev1.PodStatus{
+		Phase:      corev1.PodRunning,
+		HostIP:     "10.0.0.1",
+		Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+	}
+	return pod
+}
+
+func testService(name string, zoneId string, created time.Time) *corev1.Service {
+	return &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         "default",
+		Labels:            map[string]string{"is_elastic": "1", "zone_id": zoneId},
+		CreationTimestamp: metav1.NewTime(created),
+	}}
+}
+
+func TestReconcileReport(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	primary := newTestCluster("default",
+		markReady(testPod("known", "huadong", old)),
+		testPod("stuck", "huadong", old),
+		testService("service-known", "huadong", old),
+		testPod("orphan", "huadong", old),
+		testPod("new", "huadong", time.Now()), // 刚创建的 Pod 还没有入库
+		testService("service-gone", "huadong", old),
+	)
+	unhealthy := newTestCluster("backup")
+	unhealthy.healthy = false
+	useClusters(t, primary, unhealthy)
+
+	// 正在创建的 Pod 已经以 provisioning 入库，还没有出现在缓存中。
+	reservations["creating"] = reservation{zoneId: "huadong", flavor: "default", cluster: "default"}
+	defer releaseReservation("creating")
+
+	mock := newTestDB(t)
+	mock.ExpectQuery("SHOW TABLES LIKE 'instance_%'").WillReturnRows(sqlmock.NewRows([]string{"table"}).AddRow("instance_huadong"))
+	mock.ExpectQuery("SELECT instance_id, pod_name, status, cluster FROM instance_huadong WHERE is_elastic = 1").
+		WillReturnRows(sqlmock.NewRows([]string{"instance_id", "pod_name", "status", "cluster"}).
+			AddRow("instance-known", "known", "available", "default").
+			AddRow("instance-stuck", "stuck", "available", "default").
+			AddRow("instance-missing", "missing", "using", "default").
+			AddRow("instance-creating", "creating", "provisioning", "default").
+			AddRow("instance-abandoned", "abandoned", "provisioning", "default").
+			AddRow("instance-backup", "backup-pod", "available", "backup"))
+
+	var report ReconcileReport
+	w, code := serve(t, ReconcileReportHandler, httptest.NewRequest(http.MethodGet, "/reconcile/report", nil), nil, &report)
+	if w.Code != http.StatusOK || code != 200 || !report.DryRun {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+	var issues []string
+	for _, issue := range report.Issues {
+		if issue.Action != ActionAlert || issue.Error != "" {
+			t.Errorf("unexpected issue %+v", issue)
+		}
+		issues = append(issues, issue.Kind+":"+issue.Name)
+	}
+	sort.Strings(issues)
+	// 不健康集群中的记录不报告，避免误删；没有在创建中的 provisioning 记录是遗留的记录。
+	want := []string{"orphan_pod:orphan", "orphan_row:instance-abandoned", "orphan_row:instance-missing", "orphan_service:service-gone", "stuck_pod:stuck"}
+	if len(issues) != len(want) {
+		t.Fatalf("expected issues %v, got %v", want, issues)
+	}
+	for i := range want {
+		if issues[i] != want[i] {
+			t.Errorf("expected issues %v, got %v", want, issues)
+		}
+	}
+}
+
+func TestReconcileReportDatabaseError(t *testing.T) {
+	useClusters(t, newTestCluster("default"))
+	mock := newTestDB(t)
+	mock.ExpectQuery("SHOW TABLES").WillReturnError(errTest)
+
+	var detail string
+	w, code := serve(t, ReconcileReportHandler, httptest.NewRequest(http.MethodGet, "/reconcile/report", nil), nil, &detail)
+	if w.Code != http.StatusInternalServerError || code != 500 || detail == "" {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,297 @@
+package apis
+
+import (
+	instancestate "common/instance"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"manager/config"
+	mysql_service "manager/mysql/service"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	standbyLabel = "standby" // 热备实例的标签，值为 1 时实例已经就绪但还没有入库
+
+	standbyRefillInterval = 30 * time.Second
+)
+
+var (
+	standbyMu sync.Mutex
+	// claimedStandby 是正在被提升的热备实例，避免被重复提升。
+	claimedStandby = make(map[string]bool)
+	// creatingStandby 是正在创建的热备实例数量，key 为 zone/规格。
+	creatingStandby = make(map[string]int)
+	// refillQueued 记录已经在 zone 队列中等待的补充任务，避免重复排队。
+	refillQueued = make(map[string]bool)
+)
+
+func isStandby(pod *corev1.Pod) bool {
+	return pod.Labels[standbyLabel] == "1"
+}
+
+// StartStandbyPool 周期性为配置了 standby 的规格补充热备实例。
+// 热备实例提前创建并通过健康检查，扩容时直接提升为可用实例，提升后在后台补充。
+func StartStandbyPool(ctx context.Context) {
+	enabled := false
+	for _, flavor := range config.FLAVORS {
+		if flavor.Standby > 0 {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return
+	}
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		zones, err := mysql_service.GetZoneListInDB()
+		if err != nil {
+			slog.Error("Failed to get zone list when refilling standby pool", "error", err)
+			return
+		}
+		for _, zoneId := range zones {
+			refillStandbyLater(zoneId)
+		}
+	}, standbyRefillInterval)
+}
+
+// refillStandbyLater 将补充任务加入 zone 队列，在已经排队的扩缩容操作之后执行。
+func refillStandbyLater(zoneId string) {
+	standbyMu.Lock()
+	if refillQueued[zoneId] {
+		standbyMu.Unlock()
+		return
+	}
+	refillQueued[zoneId] = true
+	standbyMu.Unlock()
+
+	enqueueZone(zoneId, func() {
+		standbyMu.Lock()
+		delete(refillQueued, zoneId)
+		standbyMu.Unlock()
+		refillStandby(zoneId)
+	})
+}
+
+// refillStandby 在 zone 队列中决定需要补充的数量并预留容量，创建和等待就绪在队列之外进行，不阻塞扩缩容。
+func refillStandby(zoneId string) {
+	for _, flavor := range config.FLAVORS {
+		if flavor.Standby == 0 {
+			continue
+		}
+		key := zoneId + "/" + flavor.Name
+
+		missing := missingStandby(zoneId, flavor)
+		if missing <= 0 {
+			continue
+		}
+
+		missing, err := budgetLimit(zoneId, flavor, missing)
+		var placements []placement
+		if err == nil {
+			placements, err = reserveCapacity(zoneId, flavor, missing)
+		}
+		if err != nil {
+			slog.Warn("Failed to refill standby pool", "zone_id", zoneId, "flavor", flavor.Name, "error", err)
+			continue
+		}
+		slog.Info("Refilling standby instances", "zone_id", zoneId, "flavor", flavor.Name, "count", len(placements))
+
+		standbyMu.Lock()
+		creatingStandby[key] += len(placements)
+		standbyMu.Unlock()
+		for _, p := range placements {
+			go func(flavor *config.Flavor, p placement) {
+				defer func() {
+					releaseReservation(p.podName)
+					standbyMu.Lock()
+					creatingStandby[key]--
+					standbyMu.Unlock()
+				}()
+				instanceId := fmt.Sprintf("instance-%s", p.podName)
+				if _, _, err := createAndWatchPod(context.Background(), p.cluster, p.podName, instanceId, zoneId, flavor, true); err != nil {
+					slog.Error("Failed to create standby instance", "zone_id", zoneId, "flavor", flavor.Name, "pod_name", p.podName, "cluster", p.cluster.Name, "error", err)
+				}
+			}(flavor, p)
+		}
+	}
+}
+
+// missingStandby 返回 zone 中该规格还需要补充的热备实例数量，正在创建的实例计入热备池。
+// 正在被提升的实例提升后就不再是热备实例，不计入热备池。
+func missingStandby(zoneId string, flavor *config.Flavor) int32 {
+	standbyMu.Lock()
+	defer standbyMu.Unlock()
+	existing := creatingStandby[zoneId+"/"+flavor.Name]
+	for _, p := range standbyPods(zoneId, flavor.Name, false) {
+		if !claimedStandby[p.pod.Name] {
+			existing++
+		}
+	}
+	return int32(flavor.Standby - existing)
+}
+
+type standbyPod struct {
+	cluster *clusterState
+	pod     *corev1.Pod
+}
+
+// standbyPods 返回 zone 中该规格的热备实例，readyOnly 为 true 时只返回已经就绪且没有被提升的实例，
+// 成本低的集群排在前面。
+func standbyPods(zoneId string, flavor string, readyOnly bool) []standbyPod {
+	var pods []standbyPod
+	for _, c := range placementOrder() {
+		if readyOnly && !c.Healthy() {
+			continue
+		}
+		clusterPods, err := c.listPods(labels.Set{"zone_id": zoneId, "flavor": flavor, "is_elastic": "1", standbyLabel: "1"})
+		if err != nil {
+			slog.Error("Failed to list standby pods", "zone_id", zoneId, "cluster", c.Name, "error", err)
+			continue
+		}
+		for _, pod := range clusterPods {
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			if readyOnly && !isPodReady(pod) {
+				continue
+			}
+			pods = append(pods, standbyPod{cluster: c, pod: pod})
+		}
+	}
+	return pods
+}
+
+// promoteStandby 将最多 replica 个就绪的热备实例提升为可用实例，返回提升成功的实例。
+// 提升失败的热备实例会被删除，由后台重新补充。
+func promoteStandby(ctx context.Context, zoneId string, flavor *config.Flavor, replica int32, op *operation) []InstanceResult {
+	if flavor.Standby == 0 {
+		return nil
+	}
+
+	standbyMu.Lock()
+	var claimed []standbyPod
+	for _, p := range standbyPods(zoneId, flavor.Name, true) {
+		if int32(len(claimed)) >= replica {
+			break
+		}
+		if claimedStandby[p.pod.Name] {
+			continue
+		}
+		claimedStandby[p.pod.Name] = true
+		claimed = append(claimed, p)
+	}
+	standbyMu.Unlock()
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		promoted []InstanceResult
+		logger   = op.logger(zoneId).With("flavor", flavor.Name)
+	)
+	for _, p := range claimed {
+		wg.Add(1)
+		go func(p standbyPod) {
+			defer wg.Done()
+			defer func() {
+				standbyMu.Lock()
+				delete(claimedStandby, p.pod.Name)
+				standbyMu.Unlock()
+			}()
+
+			if err := promote(ctx, zoneId, flavor, p, op); err != nil {
+				logger.Warn("Failed to promote standby instance", "pod_name", p.pod.Name, "cluster", p.cluster.Name, "error", err)
+				if err := deletePodAndService(p.cluster, p.pod.Name, fmt.Sprintf("service-%s", p.pod.Name)); err != nil {
+					logger.Error("Failed to delete standby instance", "pod_name", p.pod.Name, "cluster", p.cluster.Name, "error", err)
+				}
+				return
+			}
+			mu.Lock()
+			promoted = append(promoted, InstanceResult{
+				InstanceId: p.pod.Labels["instance_id"],
+				PodName:    p.pod.Name,
+				Cluster:    p.cluster.Name,
+				Status:     InstanceReady,
+				Attempts:   1,
+			})
+			mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	logger.Info("Standby instances promoted", "count", len(promoted))
+	refillStandbyLater(zoneId)
+	return promoted
+}
+
+// promote 确认热备实例可以访问后去掉热备标签并入库。
+func promote(ctx context.Context, zoneId string, flavor *config.Flavor, p standbyPod, op *operation) error {
+	pod, instanceId := p.pod, p.pod.Labels["instance_id"]
+	nodePort, err := getNodePort(p.cluster, pod.Name)
+	if err != nil {
+		return err
+	}
+	if !checkPodReady(ctx, pod.Status.HostIP, nodePort) {
+		return fmt.Errorf("standby instance %s is not healthy", pod.Name)
+	}
+	if err := resizeStandby(ctx, p.cluster, pod, flavor); err != nil {
+		return err
+	}
+
+	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{%q:null}}}`, standbyLabel))
+	if _, err := p.cluster.Client.CoreV1().Pods(config.K8SNAMSPACE).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("error removing standby label: %w", err)
+	}
+	if err := mysql_service.InsertInstance(zoneId, "null", pod.Status.HostIP, instanceId, pod.Name, nodePort, 1, instancestate.Available, "null", flavor.Name, p.cluster.Name); err != nil {
+		return fmt.Errorf("error inserting instance: %w", err)
+	}
+	op.track(zoneId, flavor.Name, instanceId, pod.Name, InstanceActionApply, InstanceReady, "promoted from standby pool")
+	return nil
+}
+
+// resizeStandby 将热备实例的 requests 原地调整为规格的 requests。
+// Kubernetes 1.33 起通过 resize 子资源调整，之前的版本直接修改 Pod，需要开启 InPlacePodVerticalScaling。
+func resizeStandby(ctx context.Context, c *clusterState, pod *corev1.Pod, flavor *config.Flavor) error {
+	standby := flavor.StandbyResources()
+	if equality.Semantic.DeepEqual(standby.Requests, flavor.Resources.Requests) {
+		return nil
+	}
+	var containers []map[string]interface{}
+	for _, container := range pod.Spec.Containers {
+		if equality.Semantic.DeepEqual(container.Resources.Requests, standby.Requests) {
+			containers = append(containers, map[string]interface{}{
+				"name":      container.Name,
+				"resources": map[string]interface{}{"requests": flavor.Resources.Requests},
+			})
+		}
+	}
+	if len(containers) == 0 {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"containers": containers}})
+	if err != nil {
+		return err
+	}
+
+	pods := c.Client.CoreV1().Pods(config.K8SNAMSPACE)
+	_, err = pods.Patch(ctx, pod.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "resize")
+	if apierrors.IsNotFound(err) || apierrors.IsMethodNotSupported(err) {
+		_, err = pods.Patch(ctx, pod.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("error resizing standby instance: %w", err)
+	}
+	return nil
+}
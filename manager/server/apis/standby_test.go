@@ -0,0 +1,85 @@
+package apis
+
+import (
+	"context"
+	"manager/config"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testStandbyPod 返回该规格的热备 Pod，容器按热备实例的资源配置。
+func testStandbyPod(name string, zoneId string, flavor *config.Flavor) *corev1.Pod {
+	pod := testPod(name, zoneId, time.Now())
+	pod.Labels["flavor"] = flavor.Name
+	pod.Labels[standbyLabel] = "1"
+	pod.Spec.Containers = []corev1.Container{{Name: "cloudgame-container", Resources: flavor.StandbyResources()}}
+	return pod
+}
+
+func testStandbyFlavor() *config.Flavor {
+	return &config.Flavor{
+		Name:    "gpu",
+		Standby: 3,
+		Resources: corev1.ResourceRequirements{
+			Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		},
+		StandbyRequests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")},
+	}
+}
+
+func TestMissingStandbyExcludesPromotingPods(t *testing.T) {
+	flavor := testStandbyFlavor()
+	useClusters(t, newTestCluster("default",
+		testStandbyPod("standby-1", "huadong", flavor),
+		testStandbyPod("standby-2", "huadong", flavor),
+		testStandbyPod("standby-other", "huabei", flavor),
+	))
+	if missing := missingStandby("huadong", flavor); missing != 1 {
+		t.Errorf("expected 1 missing standby instance, got %d", missing)
+	}
+
+	// standby-1 正在被提升，standby-3 正在创建。
+	standbyMu.Lock()
+	claimedStandby["standby-1"] = true
+	creatingStandby["huadong/gpu"] = 1
+	standbyMu.Unlock()
+	t.Cleanup(func() {
+		standbyMu.Lock()
+		delete(claimedStandby, "standby-1")
+		delete(creatingStandby, "huadong/gpu")
+		standbyMu.Unlock()
+	})
+	if missing := missingStandby("huadong", flavor); missing != 1 {
+		t.Errorf("expected 1 missing standby instance, got %d", missing)
+	}
+}
+
+func TestResizeStandby(t *testing.T) {
+	flavor := testStandbyFlavor()
+	pod := testStandbyPod("standby-1", "huadong", flavor)
+	c := newTestCluster("default", pod)
+	if err := resizeStandby(context.Background(), c, pod, flavor); err != nil {
+		t.Fatal(err)
+	}
+	resized, err := c.Client.CoreV1().Pods("default").Get(context.Background(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := resized.Spec.Containers[0].Resources
+	if cpu := resources.Requests[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse("1")) != 0 {
+		t.Errorf("expected cpu request 1 after resizing, got %s", cpu.String())
+	}
+	if limit := resources.Limits[corev1.ResourceCPU]; limit.Cmp(resource.MustParse("2")) != 0 {
+		t.Errorf("expected cpu limit 2 after resizing, got %s", limit.String())
+	}
+
+	// 已经是完整规格的实例不需要调整。
+	if err := resizeStandby(context.Background(), c, resized, flavor); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,251 @@
+package apis
+
+import (
+	"bytes"
+	"common/webhook"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"manager/config"
+	mysql_service "manager/mysql/service"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+const (
+	EventInstanceReady      = "instance.ready"
+	EventInstanceFailed     = "instance.failed"
+	EventInstanceReleased   = "instance.released"
+	EventOperationCompleted = "operation.completed"
+	EventMaintenanceDrain   = "maintenance.drain"
+)
+
+var webhookEvents = map[string]bool{
+	EventInstanceReady:       true,
+	EventInstanceFailed:      true,
+	EventInstanceReleased:    true,
+	EventOperationCompleted:  true,
+	EventMaintenanceDrain:    true,
+	EventInstanceQuarantined: true,
+	EventInstanceRestored:    true,
+}
+
+var webhookClient = &http.Client{
+	Timeout: 5 * time.Second,
+}
+
+type WebhookEvent struct {
+	Id   string      `json:"id"`
+	Type string      `json:"type"`
+	Time string      `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+type InstanceEventData struct {
+	OperationId string `json:"operation_id,omitempty"`
+	ZoneId      string `json:"zone_id"`
+	Flavor      string `json:"flavor"`
+	InstanceId  string `json:"instance_id"`
+	PodName     string `json:"pod_name"`
+	Message     string `json:"message,omitempty"`
+}
+
+type OperationEventData struct {
+	OperationId string                  `json:"operation_id"`
+	ZoneId      string                  `json:"zone_id"`
+	Status      string                  `json:"status"`
+	Result      map[string]*ScaleResult `json:"result"`
+	Message     string                  `json:"message,omitempty"`
+}
+
+// emitEvent 异步投递事件给所有订阅了该事件的订阅方。
+func emitEvent(eventType string, data interface{}) {
+	event := &WebhookEvent{
+		Id:   string(uuid.NewUUID()),
+		Type: eventType,
+		Time: time.Now().Format(time.RFC3339),
+		Data: data,
+	}
+	dashboardEvents.publish(event)
+	if !webhooksEnabled() {
+		// 启动时已经提示没有设置密钥，这里不再逐个事件告警。
+		slog.Debug("Webhook delivery is skipped because WEBHOOK_SECRET_KEY is not set", "event_id", event.Id, "event_type", eventType)
+		return
+	}
+	go func() {
+		subscriptions, err := mysql_service.GetWebhookSubscriptions()
+		if err != nil {
+			slog.Error("Failed to get webhook subscriptions", "event_id", event.Id, "error", err)
+			return
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			slog.Error("Failed to marshal event", "event_id", event.Id, "error", err)
+			return
+		}
+		for _, subscription := range subscriptions {
+			if subscribed(subscription, eventType) {
+				go deliver(subscription, event, payload)
+			}
+		}
+	}()
+}
+
+func subscribed(subscription mysql_service.WebhookSubscription, eventType string) bool {
+	if len(subscription.Events) == 0 {
+		return true
+	}
+	for _, e := range subscription.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver 投递事件，失败后按指数退避重试，超过 WEBHOOKMAXATTEMPTS 次后写入死信表。
+func deliver(subscription mysql_service.WebhookSubscription, event *WebhookEvent, payload []byte) {
+	var lastErr error
+	backoff := time.Second
+	for attempt := 1; attempt <= config.WEBHOOKMAXATTEMPTS; attempt++ {
+		if lastErr = post(subscription, event, payload); lastErr == nil {
+			return
+		}
+		slog.Warn("Failed to deliver event", "event_id", event.Id, "event_type", event.Type, "url", subscription.Url, "attempt", attempt, "error", lastErr)
+		if attempt < config.WEBHOOKMAXATTEMPTS {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	err := mysql_service.InsertWebhookDeadLetter(&mysql_service.WebhookDeadLetter{
+		SubscriptionId: subscription.Id,
+		Url:            subscription.Url,
+		EventId:        event.Id,
+		EventType:      event.Type,
+		Payload:        string(payload),
+		Attempts:       config.WEBHOOKMAXATTEMPTS,
+		LastError:      lastErr.Error(),
+	})
+	if err != nil {
+		slog.Error("Failed to save dead letter", "event_id", event.Id, "error", err)
+	}
+}
+
+func post(subscription mysql_service.WebhookSubscription, event *WebhookEvent, payload []byte) error {
+	request, err := http.NewRequest(http.MethodPost, subscription.Url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhook.EventHeader, event.Type)
+	request.Header.Set(webhook.DeliveryHeader, event.Id)
+	request.Header.Set(webhook.TimestampHeader, timestamp)
+	request.Header.Set(webhook.SignatureHeader, webhook.Sign(subscription.Secret, timestamp, payload))
+
+	resp, err := webhookClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+type WebhookSubscribeRequest struct {
+	Url    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"` // 为空时订阅所有事件
+}
+
+// webhooksEnabled 返回是否设置了加密订阅密钥的密钥，没有设置时不能注册订阅，也不投递事件。
+func webhooksEnabled() bool {
+	return config.WEBHOOKSECRETKEY != ""
+}
+
+// CreateWebhookSubscription 注册 webhook 订阅，没有设置 WEBHOOK_SECRET_KEY 时返回 503。
+func CreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	if !webhooksEnabled() {
+		SendErrorResponse(w, &ErrorCodeWithMessage{
+			HttpStatus: http.StatusServiceUnavailable,
+			ErrorCode:  503,
+			Message:    "Service unavailable",
+		}, "Webhooks are disabled because WEBHOOK_SECRET_KEY is not set")
+		return
+	}
+	reqBody := WebhookSubscribeRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		sendBadRequest(w, err.Error())
+		return
+	}
+	if u, err := url.Parse(reqBody.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		sendBadRequest(w, "Url must be an absolute http or https url")
+		return
+	}
+	if reqBody.Secret == "" {
+		sendBadRequest(w, "Secret is not specified")
+		return
+	}
+	for _, e := range reqBody.Events {
+		if !webhookEvents[e] {
+			sendBadRequest(w, fmt.Sprintf("Unknown event %s", e))
+			return
+		}
+	}
+
+	subscription := &mysql_service.WebhookSubscription{
+		Id:     string(uuid.NewUUID()),
+		Url:    reqBody.Url,
+		Secret: reqBody.Secret,
+		Events: reqBody.Events,
+	}
+	if subscription.Events == nil {
+		subscription.Events = []string{}
+	}
+	if err := mysql_service.InsertWebhookSubscription(subscription); err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendCreated(w, subscription)
+}
+
+func ListWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := mysql_service.GetWebhookSubscriptions()
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, subscriptions)
+}
+
+func DeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	deleted, err := mysql_service.DeleteWebhookSubscription(id)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	if !deleted {
+		sendNotFound(w, fmt.Sprintf("Subscription %s not found", id))
+		return
+	}
+	sendOK(w, nil)
+}
+
+// ListWebhookDeadLetters 查询最近 100 条投递失败的事件。
+func ListWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	deadLetters, err := mysql_service.GetWebhookDeadLetters(100)
+	if err != nil {
+		sendInternalError(w, err)
+		return
+	}
+	sendOK(w, deadLetters)
+}
@@ -0,0 +1,144 @@
+package apis
+
+import (
+	"common/webhook"
+	"database/sql/driver"
+	"io"
+	"manager/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mysql_service "manager/mysql/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// capture 匹配任意字符串参数并记录下来。
+type capture struct{ value string }
+
+func (c *capture) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	c.value = s
+	return ok
+}
+
+func TestWebhookSubscriptionLifecycle(t *testing.T) {
+	mock := newTestDB(t)
+	sealed := &capture{}
+	mock.ExpectExec("INSERT INTO webhook_subscriptions").
+		WithArgs(sqlmock.AnyArg(), "http://predict:7777/callback", sealed, EventOperationCompleted, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	body := `{"url":"http://predict:7777/callback","secret":"s3cret","events":["operation.completed"]}`
+	var created mysql_service.WebhookSubscription
+	w, code := serve(t, CreateWebhookSubscription, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)), nil, &created)
+	if w.Code != http.StatusCreated || code != 201 || created.Id == "" {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+	// 密钥加密后保存，响应中也不返回密钥。
+	if sealed.value == "" || strings.Contains(sealed.value, "s3cret") || strings.Contains(w.Body.String(), "s3cret") {
+		t.Fatalf("secret is stored or returned in plaintext: %q %s", sealed.value, w.Body)
+	}
+
+	mock.ExpectQuery("SELECT id, url, secret, events, created_at FROM webhook_subscriptions").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret", "events", "created_at"}).
+			AddRow(created.Id, created.Url, sealed.value, EventOperationCompleted, created.CreatedAt))
+	subscriptions, err := mysql_service.GetWebhookSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subscriptions) != 1 || subscriptions[0].Secret != "s3cret" {
+		t.Fatalf("unexpected subscriptions %+v", subscriptions)
+	}
+
+	// 投递的请求可以用订阅时的密钥校验。
+	received := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		received <- webhook.Verify("s3cret", r.Header.Get(webhook.TimestampHeader), r.Header.Get(webhook.SignatureHeader), payload, time.Minute)
+	}))
+	defer server.Close()
+	subscription := subscriptions[0]
+	subscription.Url = server.URL
+	event := &WebhookEvent{Id: "event-1", Type: EventOperationCompleted}
+	if err := post(subscription, event, []byte(`{"id":"event-1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-received; err != nil {
+		t.Errorf("delivery failed verification: %v", err)
+	}
+}
+
+func TestCreateWebhookSubscriptionValidation(t *testing.T) {
+	for _, body := range []string{
+		`{"url":"ftp://predict/callback","secret":"s"}`,
+		`{"url":"http://predict/callback","secret":""}`,
+		`{"url":"http://predict/callback","secret":"s","events":["instance.unknown"]}`,
+	} {
+		var detail string
+		w, code := serve(t, CreateWebhookSubscription, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)), nil, &detail)
+		if w.Code != http.StatusBadRequest || code != 400 || detail == "" {
+			t.Errorf("expected 400 for %s, got %d %s", body, w.Code, w.Body)
+		}
+	}
+}
+
+func TestListWebhookSubscriptions(t *testing.T) {
+	mock := newTestDB(t)
+	mock.ExpectQuery("SELECT id, url, secret, events, created_at FROM webhook_subscriptions").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret", "events", "created_at"}).
+			AddRow("sub-1", "http://predict:7777/callback", "legacy-plaintext", "", "2024-06-01 00:00:00"))
+
+	var subscriptions []map[string]interface{}
+	w, code := serve(t, ListWebhookSubscriptions, httptest.NewRequest(http.MethodGet, "/webhooks", nil), nil, &subscriptions)
+	if w.Code != http.StatusOK || code != 200 || len(subscriptions) != 1 {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+	if _, ok := subscriptions[0]["secret"]; ok || strings.Contains(w.Body.String(), "legacy-plaintext") {
+		t.Errorf("secret is returned: %s", w.Body)
+	}
+}
+
+func TestDeleteWebhookSubscription(t *testing.T) {
+	mock := newTestDB(t)
+	mock.ExpectExec("DELETE FROM webhook_subscriptions WHERE id = ?").WithArgs("sub-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM webhook_subscriptions WHERE id = ?").WithArgs("sub-2").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	w, code := serve(t, DeleteWebhookSubscription, httptest.NewRequest(http.MethodDelete, "/webhooks/sub-1", nil), map[string]string{"id": "sub-1"}, new(interface{}))
+	if w.Code != http.StatusOK || code != 200 {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+	w, code = serve(t, DeleteWebhookSubscription, httptest.NewRequest(http.MethodDelete, "/webhooks/sub-2", nil), map[string]string{"id": "sub-2"}, new(interface{}))
+	if w.Code != http.StatusNotFound || code != 404 {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+}
+
+func TestWebhooksDisabledWithoutSecretKey(t *testing.T) {
+	key := config.WEBHOOKSECRETKEY
+	config.WEBHOOKSECRETKEY = ""
+	t.Cleanup(func() { config.WEBHOOKSECRETKEY = key })
+
+	mock := newTestDB(t)
+	var detail string
+	body := `{"url":"http://predict:7777/callback","secret":"s3cret"}`
+	w, code := serve(t, CreateWebhookSubscription, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)), nil, &detail)
+	if w.Code != http.StatusServiceUnavailable || code != 503 || !strings.Contains(detail, "WEBHOOK_SECRET_KEY") {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+
+	// 没有加密的密钥时照常启动，有加密的密钥时无法解密，启动失败。
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM webhook_subscriptions WHERE secret LIKE").WithArgs("v1:%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	if err := mysql_service.SealWebhookSecrets(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM webhook_subscriptions WHERE secret LIKE").WithArgs("v1:%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	if err := mysql_service.SealWebhookSecrets(); err == nil {
+		t.Error("expected an error when sealed secrets cannot be opened")
+	}
+}
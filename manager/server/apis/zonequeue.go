@@ -0,0 +1,91 @@
+package apis
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+// jobQueue 在后台按加入顺序逐个执行任务。
+type jobQueue struct {
+	mu      sync.Mutex
+	jobs    []func() // 正在执行的任务执行完成后才移出队列
+	running bool
+}
+
+// zoneQueues 按 zone 逐个执行扩缩容任务，避免并发的请求基于同一份可用实例数量重复扩缩容。
+// manager 通过选主保证只有一个副本在工作，进程内排队即可。
+var (
+	zoneQueuesMu sync.Mutex
+	zoneQueues   = make(map[string]*jobQueue)
+)
+
+// enqueue 将任务加入队列后立即返回，返回值为任务前面还在排队的任务数。
+func (q *jobQueue) enqueue(job func()) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ahead := len(q.jobs)
+	q.jobs = append(q.jobs, job)
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+	return ahead
+}
+
+func (q *jobQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.jobs) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		job := q.jobs[0]
+		q.mu.Unlock()
+
+		runJob(job)
+
+		q.mu.Lock()
+		q.jobs = q.jobs[1:]
+		q.mu.Unlock()
+	}
+}
+
+// runJob 执行任务，任务 panic 时记录日志，不影响队列中后面的任务。
+func runJob(job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Zone job panicked", "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+	job()
+}
+
+// enqueueZone 将任务加入 zone 的队列后立即返回，返回值为任务前面还在排队的任务数。
+func enqueueZone(zoneId string, job func()) int {
+	zoneQueuesMu.Lock()
+	q, ok := zoneQueues[zoneId]
+	if !ok {
+		q = &jobQueue{}
+		zoneQueues[zoneId] = q
+	}
+	zoneQueuesMu.Unlock()
+	return q.enqueue(job)
+}
+
+// runInZone 将任务加入 zone 的队列并等待任务执行完成，任务 panic 时返回错误。
+func runInZone(zoneId string, job func() error) error {
+	done := make(chan error, 1)
+	enqueueZone(zoneId, func() {
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("Zone job panicked", "zone_id", zoneId, "panic", r, "stack", string(debug.Stack()))
+				done <- fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		done <- job()
+	})
+	return <-done
+}
@@ -0,0 +1,50 @@
+package apis
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestZoneQueueRunsJobsInOrder(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	wg.Add(3)
+	// 第一个任务阻塞时，后面的任务排队等待。
+	if ahead := enqueueZone("queue-test", func() { <-release; mu.Lock(); order = append(order, 1); mu.Unlock(); wg.Done() }); ahead != 0 {
+		t.Errorf("expected no job ahead, got %d", ahead)
+	}
+	for i := 2; i <= 3; i++ {
+		i := i
+		if ahead := enqueueZone("queue-test", func() { mu.Lock(); order = append(order, i); mu.Unlock(); wg.Done() }); ahead != i-1 {
+			t.Errorf("expected %d jobs ahead, got %d", i-1, ahead)
+		}
+	}
+
+	// 其他 zone 的任务不需要等待。
+	if err := runInZone("queue-other", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	wg.Wait()
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Errorf("unexpected order %v", order)
+	}
+}
+
+func TestZoneQueueSurvivesPanics(t *testing.T) {
+	if err := runInZone("queue-panic", func() error { panic("boom") }); err == nil {
+		t.Error("expected an error from a panicking job")
+	}
+	// 队列没有因为 panic 退出，后面的任务照常执行。
+	done := make(chan struct{})
+	enqueueZone("queue-panic", func() { panic("boom") })
+	enqueueZone("queue-panic", func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("zone queue stopped after a panic")
+	}
+}
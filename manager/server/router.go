@@ -1,19 +1,61 @@
 package server
 
 import (
+	"common/logging"
+	"common/openapi"
+	_ "embed"
 	"manager/server/apis"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 var (
-	healthzPath    = "/healthz"
-	instanceManage = "/instance/manage"
+	healthzPath     = "/healthz"
+	instanceManage  = "/instance/manage"
+	reconcileReport = "/reconcile/report"
+	operationPath   = "/operations/{id}"
+	webhooks        = "/webhooks"
+	webhook         = "/webhooks/{id}"
+	deadLetters     = "/webhooks/dead-letters"
+	clusterList     = "/clusters"
+	costReport      = "/cost"
+	decisions       = "/decisions"
+	decisionExplain = "/decisions/{id}/explain"
+	metricsPath     = "/metrics"
+	openapiPath     = "/openapi.json"
+
+	dashboardZones         = "/dashboard/zones"
+	dashboardInstances     = "/dashboard/zones/{zone}/instances"
+	dashboardDecisions     = "/dashboard/zones/{zone}/decisions"
+	dashboardForecasts     = "/dashboard/zones/{zone}/forecasts"
+	dashboardLoginFailures = "/dashboard/zones/{zone}/login-failures"
+	dashboardStream        = "/dashboard/zones/{zone}/stream"
+
+	adminSites             = "/admin/zones/{zone}/sites"
+	adminSite              = "/admin/zones/{zone}/sites/{site}"
+	adminSiteCordon        = "/admin/zones/{zone}/sites/{site}/cordon"
+	adminSiteUncordon      = "/admin/zones/{zone}/sites/{site}/uncordon"
+	adminSiteInstances     = "/admin/zones/{zone}/sites/{site}/instances"
+	adminInstance          = "/admin/zones/{zone}/instances/{id}"
+	adminInstanceCordon    = "/admin/zones/{zone}/instances/{id}/cordon"
+	adminInstanceUncordon  = "/admin/zones/{zone}/instances/{id}/uncordon"
+	adminInstanceHistory   = "/admin/zones/{zone}/instances/{id}/history"
+	adminMaintenance       = "/admin/zones/{zone}/maintenance"
+	adminMaintenanceWindow = "/admin/zones/{zone}/maintenance/{id}"
 )
 
+//go:embed openapi.yaml
+var openapiDocument []byte
+
+// spec 是 manager 接口的 OpenAPI 文档，请求先按文档校验再交给各个接口处理。
+var spec = openapi.MustLoad(openapiDocument)
+
 func NewRouter() *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
+	router.Use(otelmux.Middleware("manager"), logging.Middleware, spec.Middleware)
 	router.
 		Methods(http.MethodGet).
 		Path(healthzPath).
@@ -29,5 +71,175 @@ func NewRouter() *mux.Router {
 		Path("/bounce/rate").
 		Name("bounceRate").
 		HandlerFunc(apis.BounceRate)
+	router.
+		Methods(http.MethodGet).
+		Path(reconcileReport).
+		Name("reconcileReport").
+		HandlerFunc(apis.ReconcileReportHandler)
+	router.
+		Methods(http.MethodGet).
+		Path(operationPath).
+		Name("operation").
+		HandlerFunc(apis.GetOperation)
+	router.
+		Methods(http.MethodPost).
+		Path(webhooks).
+		Name("createWebhook").
+		HandlerFunc(apis.CreateWebhookSubscription)
+	router.
+		Methods(http.MethodGet).
+		Path(webhooks).
+		Name("listWebhooks").
+		HandlerFunc(apis.ListWebhookSubscriptions)
+	router.
+		Methods(http.MethodGet).
+		Path(deadLetters).
+		Name("webhookDeadLetters").
+		HandlerFunc(apis.ListWebhookDeadLetters)
+	router.
+		Methods(http.MethodDelete).
+		Path(webhook).
+		Name("deleteWebhook").
+		HandlerFunc(apis.DeleteWebhookSubscription)
+	router.
+		Methods(http.MethodGet).
+		Path(clusterList).
+		Name("clusters").
+		HandlerFunc(apis.ListClusters)
+	router.
+		Methods(http.MethodGet).
+		Path(costReport).
+		Name("cost").
+		HandlerFunc(apis.GetCostReport)
+	router.
+		Methods(http.MethodGet).
+		Path(decisions).
+		Name("decisions").
+		HandlerFunc(apis.ListDecisions)
+	router.
+		Methods(http.MethodGet).
+		Path(decisionExplain).
+		Name("decisionExplain").
+		HandlerFunc(apis.ExplainDecision)
+	router.
+		Methods(http.MethodGet).
+		Path(dashboardZones).
+		Name("dashboardZones").
+		HandlerFunc(apis.DashboardZones)
+	router.
+		Methods(http.MethodGet).
+		Path(dashboardInstances).
+		Name("dashboardInstances").
+		HandlerFunc(apis.DashboardInstances)
+	router.
+		Methods(http.MethodGet).
+		Path(dashboardDecisions).
+		Name("dashboardDecisions").
+		HandlerFunc(apis.DashboardDecisions)
+	router.
+		Methods(http.MethodGet).
+		Path(dashboardForecasts).
+		Name("dashboardForecasts").
+		HandlerFunc(apis.DashboardForecasts)
+	router.
+		Methods(http.MethodGet).
+		Path(dashboardLoginFailures).
+		Name("dashboardLoginFailures").
+		HandlerFunc(apis.DashboardLoginFailures)
+	router.
+		Methods(http.MethodGet).
+		Path(dashboardStream).
+		Name("dashboardStream").
+		HandlerFunc(apis.DashboardStream)
+	router.
+		Methods(http.MethodPost).
+		Path(adminSites).
+		Name("createSite").
+		HandlerFunc(apis.CreateSite)
+	router.
+		Methods(http.MethodGet).
+		Path(adminSites).
+		Name("listSites").
+		HandlerFunc(apis.ListSites)
+	router.
+		Methods(http.MethodPatch).
+		Path(adminSite).
+		Name("updateSite").
+		HandlerFunc(apis.UpdateSite)
+	router.
+		Methods(http.MethodDelete).
+		Path(adminSite).
+		Name("decommissionSite").
+		HandlerFunc(apis.DecommissionSite)
+	router.
+		Methods(http.MethodPost).
+		Path(adminSiteCordon).
+		Name("cordonSite").
+		HandlerFunc(apis.CordonSite)
+	router.
+		Methods(http.MethodPost).
+		Path(adminSiteUncordon).
+		Name("uncordonSite").
+		HandlerFunc(apis.UncordonSite)
+	router.
+		Methods(http.MethodPost).
+		Path(adminSiteInstances).
+		Name("createEdgeInstance").
+		HandlerFunc(apis.CreateEdgeInstance)
+	router.
+		Methods(http.MethodGet).
+		Path(adminSiteInstances).
+		Name("listEdgeInstances").
+		HandlerFunc(apis.ListEdgeInstances)
+	router.
+		Methods(http.MethodPatch).
+		Path(adminInstance).
+		Name("updateEdgeInstance").
+		HandlerFunc(apis.UpdateEdgeInstance)
+	router.
+		Methods(http.MethodDelete).
+		Path(adminInstance).
+		Name("decommissionEdgeInstance").
+		HandlerFunc(apis.DecommissionEdgeInstance)
+	router.
+		Methods(http.MethodPost).
+		Path(adminInstanceCordon).
+		Name("cordonEdgeInstance").
+		HandlerFunc(apis.CordonEdgeInstance)
+	router.
+		Methods(http.MethodPost).
+		Path(adminInstanceUncordon).
+		Name("uncordonEdgeInstance").
+		HandlerFunc(apis.UncordonEdgeInstance)
+	router.
+		Methods(http.MethodGet).
+		Path(adminInstanceHistory).
+		Name("instanceHistory").
+		HandlerFunc(apis.GetInstanceHistory)
+	router.
+		Methods(http.MethodPost).
+		Path(adminMaintenance).
+		Name("createMaintenance").
+		HandlerFunc(apis.CreateMaintenanceWindow)
+	router.
+		Methods(http.MethodGet).
+		Path(adminMaintenance).
+		Name("listMaintenance").
+		HandlerFunc(apis.ListMaintenanceWindows)
+	router.
+		Methods(http.MethodDelete).
+		Path(adminMaintenanceWindow).
+		Name("cancelMaintenance").
+		HandlerFunc(apis.CancelMaintenanceWindow)
+	router.
+		Methods(http.MethodGet).
+		Path(metricsPath).
+		Name("metrics").
+		Handler(promhttp.Handler())
+	router.
+		Methods(http.MethodGet).
+		Path(openapiPath).
+		Name("openapi").
+		Handler(spec)
 	return router
 }
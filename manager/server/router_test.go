@@ -0,0 +1,33 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// undocumented 是不在 OpenAPI 文档中描述的路由。
+var undocumented = map[string]bool{metricsPath: true, openapiPath: true}
+
+func TestRoutesAreDocumented(t *testing.T) {
+	err := NewRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || undocumented[path] {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("route %s has no methods", path)
+			return nil
+		}
+		for _, method := range methods {
+			if !spec.HasOperation(method, path) {
+				t.Errorf("%s %s is not documented in openapi.yaml", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
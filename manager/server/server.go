@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 )
 
@@ -14,7 +15,7 @@ func Serve(ctx context.Context, host string, port string) error {
 	}
 	err := httpServer.ListenAndServe()
 	if err != nil {
-		fmt.Printf("Failed to start server: %v\n", err)
+		slog.Error("Failed to start server", "error", err)
 		return err
 	}
 
@@ -22,7 +23,7 @@ func Serve(ctx context.Context, host string, port string) error {
 		select {
 		case <-ctx.Done():
 			err := httpServer.Shutdown(context.Background())
-			fmt.Printf("Shutting down server failed: %v", err)
+			slog.Error("Shutting down server failed", "error", err)
 		}
 	}()
 
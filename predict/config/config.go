@@ -1,9 +1,12 @@
 package config
 
 import (
+	"common/flavor"
+	"common/logging"
 	"log"
 	"os"
 	"strconv"
+	"time"
 )
 
 var (
@@ -11,21 +14,48 @@ var (
 	TIMESNETPROTOCOL = "http" // 算法服务协议
 	MANAGERPROTOCOL  = "http" // 资源管理模块服务协议
 
-	K8SNAMSPACE       string // K8S命名空间
-	MYSQLHOST         string // MYSQL服务地址
-	MYSQLPORT         string // MYSQL服务端口
-	MYSQLUSER         string // MYSQL服务用户
-	MYSQLPASSWORD     string // MYSQL服务密码
-	MYSQLDATABASE     string // MYSQL服务数据库
-	MANAGERHOST       string // 资源管理模块服务地址
-	MANAGERPORT       string // 资源管理模块服务端口
-	TIMESNETHOST      string // 算法服务地址
-	TIMESNETPORT      string // 算法服务端口
-	ACCELERATIONRATIO int    // 加速比例
-	SCALERATIO        int    // 缩放比例
+	MANAGEPOLLINTERVAL = 5 * time.Second // 轮询扩缩容操作状态的间隔
+	MANAGETIMEOUT      time.Duration     // 等待扩缩容操作完成的超时时间，默认为一轮预测间隔的一半，必须小于预测间隔
+
+	CALLBACKURL   string // manager 回调预测服务的地址，例如 http://predict-service:7777/callback，为空时只轮询操作状态
+	WEBHOOKSECRET string // 校验 manager 回调签名的密钥
+
+	LOGLEVEL  string // 日志级别：debug、info、warn、error，默认为 info
+	LOGFORMAT string // 日志格式：json 或 text，默认为 json
+
+	TRACEEXPORTER string // 链路追踪导出方式：none、otlp、stdout 或 file，默认为 none
+	TRACEFILE     string // TRACEEXPORTER 为 file 时的输出文件
+
+	K8SNAMSPACE       string        // K8S命名空间
+	MYSQLHOST         string        // MYSQL服务地址
+	MYSQLPORT         string        // MYSQL服务端口
+	MYSQLUSER         string        // MYSQL服务用户
+	MYSQLPASSWORD     string        // MYSQL服务密码
+	MYSQLDATABASE     string        // MYSQL服务数据库
+	MANAGERHOST       string        // 资源管理模块服务地址
+	MANAGERPORT       string        // 资源管理模块服务端口
+	TIMESNETHOST      string        // 算法服务地址
+	TIMESNETPORT      string        // 算法服务端口
+	ACCELERATIONRATIO int           // 加速比例
+	CYCLEINTERVAL     time.Duration // 每轮预测的间隔，为 15 分钟除以加速比例
+	SCALERATIO        int           // 缩放比例
+
+	MAINTENANCELOOKAHEAD time.Duration // 维护窗口在该时间内开始时就将站点容量视为 0，默认为一轮预测的间隔
+
+	FLAVORCONFIGPATH string                     // 实例规格配置文件路径，与 manager 使用同一个文件
+	FLAVORS          = []string{flavor.Default} // 需要预测的规格，来自实例规格配置
 )
 
 func init() {
+	LOGLEVEL = os.Getenv("LOG_LEVEL")
+	LOGFORMAT = os.Getenv("LOG_FORMAT")
+	if err := logging.Setup("predict", LOGLEVEL, LOGFORMAT); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+
+	TRACEEXPORTER = os.Getenv("TRACE_EXPORTER")
+	TRACEFILE = os.Getenv("TRACE_FILE")
+
 	K8SNAMSPACE = os.Getenv("NAMESPACE")
 	if K8SNAMSPACE == "" {
 		log.Fatalf("Failed to get namespace from env")
@@ -76,6 +106,12 @@ func init() {
 		log.Fatalf("Failed to get timesnet port from env")
 	}
 
+	CALLBACKURL = os.Getenv("PREDICT_CALLBACK_URL")
+	WEBHOOKSECRET = os.Getenv("WEBHOOK_SECRET")
+	if CALLBACKURL != "" && WEBHOOKSECRET == "" {
+		log.Fatalf("Failed to get webhook secret from env")
+	}
+
 	var err error
 	ACCELERATIONRATIO, err = strconv.Atoi(os.Getenv("ACCELERATION_RATIO"))
 	if err != nil {
@@ -90,4 +126,29 @@ func init() {
 	} else if SCALERATIO == 0 {
 		log.Fatal("Instance scale ratio cannot be zero")
 	}
+
+	CYCLEINTERVAL = time.Duration(15*60*1000/ACCELERATIONRATIO) * time.Millisecond
+
+	// 一次扩缩容卡住时不能拖到下一轮预测。
+	MANAGETIMEOUT = CYCLEINTERVAL / 2
+	if v := os.Getenv("MANAGE_TIMEOUT"); v != "" {
+		MANAGETIMEOUT, err = time.ParseDuration(v)
+		if err != nil || MANAGETIMEOUT <= 0 || MANAGETIMEOUT >= CYCLEINTERVAL {
+			log.Fatalf("Manage timeout must be a positive duration shorter than the cycle interval %v", CYCLEINTERVAL)
+		}
+	}
+
+	MAINTENANCELOOKAHEAD = CYCLEINTERVAL
+	if v := os.Getenv("MAINTENANCE_LOOKAHEAD"); v != "" {
+		MAINTENANCELOOKAHEAD, err = time.ParseDuration(v)
+		if err != nil || MAINTENANCELOOKAHEAD < 0 {
+			log.Fatal("Maintenance lookahead must be a non-negative duration")
+		}
+	}
+
+	FLAVORCONFIGPATH = os.Getenv("FLAVOR_CONFIG_PATH")
+	FLAVORS, err = flavor.LoadNames(FLAVORCONFIGPATH)
+	if err != nil {
+		log.Fatalf("Failed to load flavor config: %v", err)
+	}
 }
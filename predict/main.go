@@ -1,18 +1,27 @@
 package main
 
 import (
+	"common/logging"
+	"common/tracing"
 	"context"
+	_ "embed"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os/signal"
 	"predict/config"
+	"predict/manager"
+	"predict/metrics"
 	"predict/process"
 	"syscall"
 	"time"
 
 	mysql_service "predict/mysql/service"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -22,8 +31,26 @@ import (
 	"k8s.io/klog/v2"
 )
 
+var tracer = tracing.Tracer("predict")
+
+// openapiDocument 是 predict 接口的 OpenAPI 文档。
+//
+//go:embed openapi.json
+var openapiDocument []byte
+
 func main() {
 	ctx, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	klog.SetSlogLogger(slog.Default())
+
+	shutdownTracing, err := tracing.Setup(ctx, "predict", config.TRACEEXPORTER, config.TRACEFILE)
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("Failed to shut down tracing", "error", err)
+		}
+	}()
 
 	// 从业务集群中获取 config，并创建客户端。
 	conf, err := rest.InClusterConfig()
@@ -46,26 +73,56 @@ func main() {
 			http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 				_, err := fmt.Fprintf(w, "Alive")
 				if err != nil {
-					log.Fatalf("error writing response: %v", err)
+					slog.Error("Failed to write response", "error", err)
+				}
+			})
+			http.Handle("/metrics", promhttp.Handler())
+			// 接收 manager 的扩缩容完成回调。
+			http.HandleFunc("/callback", manager.CallbackHandler)
+			http.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+				if _, err := w.Write(openapiDocument); err != nil {
+					slog.Error("Failed to write response", "error", err)
 				}
 			})
 			if err := http.ListenAndServe(fmt.Sprintf("0.0.0.0:%s", config.PREDICTPORT), nil); err != nil {
-				fmt.Println("server serve failed:", err)
+				slog.Error("Server serve failed", "error", err)
 			}
 		}()
 
+		if err := manager.Subscribe(); err != nil {
+			slog.Warn("Failed to subscribe manager callback, fall back to polling", "error", err)
+		}
+
 		// 创建一个定时任务，每隔 15 分钟执行一次。
 		wait.Until(func() {
 			for zoneId, siteList := range zoneList {
 				go func(zoneId string, siteList []string) {
-					err := process.Process(zoneId, siteList)
+					// 每轮预测使用新的关联 ID，经过 manager 一直传递到创建的 Pod。
+					correlationId := logging.NewCorrelationID()
+					ctx := logging.WithCorrelationID(ctx, correlationId)
+					ctx = logging.With(ctx, "zone_id", zoneId)
+					ctx, span := tracer.Start(ctx, "predict.cycle", trace.WithNewRoot(), trace.WithAttributes(
+						attribute.String("zone_id", zoneId),
+						attribute.String("correlation_id", correlationId),
+					))
+					start := time.Now()
+					err := process.Process(ctx, zoneId, siteList)
+					tracing.End(span, err)
+					result := "success"
+					if err != nil {
+						result = "failure"
+					}
+					metrics.CycleDuration.WithLabelValues(zoneId, result).Observe(time.Since(start).Seconds())
 					if err != nil {
-						fmt.Printf("%s process failed, err:%v\n", zoneId, err)
+						logging.FromContext(ctx).Error("Process failed", "error", err, "duration", time.Since(start))
 						return
 					}
+					logging.FromContext(ctx).Info("Process finished", "duration", time.Since(start))
 				}(zoneId, siteList)
 			}
-		}, time.Duration(15*60*1000/config.ACCELERATIONRATIO)*time.Millisecond, ctx.Done())
+		}, config.CYCLEINTERVAL, ctx.Done())
 	}
 
 	// 创建分布式锁。
@@ -0,0 +1,137 @@
+package manager
+
+import (
+	managerclient "common/client/manager"
+	"common/webhook"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"predict/config"
+	"sync"
+	"time"
+)
+
+// 超过该时间的回调视为重放，直接拒绝。
+const callbackTolerance = 5 * time.Minute
+
+type callbackEvent struct {
+	Id   string          `json:"id"`
+	Type string          `json:"type"`
+	Time string          `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+type operationCompleted struct {
+	OperationId string `json:"operation_id"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+}
+
+var (
+	callbackMu sync.Mutex
+	// waiters 是正在等待完成回调的操作。
+	waiters = make(map[string]chan *operation)
+	// arrived 保存在 Manage 开始等待之前就已经到达的回调。
+	arrived = make(map[string]arrivedOperation)
+)
+
+type arrivedOperation struct {
+	op *operation
+	at time.Time
+}
+
+// Subscribe 向 manager 注册 operation.completed 回调，已经注册过同一地址时跳过。
+func Subscribe() error {
+	if config.CALLBACKURL == "" {
+		return nil
+	}
+	ctx := context.Background()
+	subscriptions, err := api.ListWebhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	for _, subscription := range subscriptions {
+		if subscription.Url == config.CALLBACKURL {
+			return nil
+		}
+	}
+
+	_, err = api.CreateWebhook(ctx, &managerclient.WebhookSubscribeRequest{
+		Url:    config.CALLBACKURL,
+		Secret: config.WEBHOOKSECRET,
+		Events: []string{"operation.completed"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe webhook: %w", err)
+	}
+	slog.Info("Subscribed to operation.completed", "url", config.CALLBACKURL)
+	return nil
+}
+
+// CallbackHandler 接收 manager 的 webhook 回调，校验签名后唤醒等待中的 Manage。
+func CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := webhook.Verify(config.WEBHOOKSECRET, r.Header.Get(webhook.TimestampHeader), r.Header.Get(webhook.SignatureHeader), body, callbackTolerance); err != nil {
+		slog.Warn("Rejected callback", "error", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var event callbackEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if event.Type != "operation.completed" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var data operationCompleted
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	notify(&operation{Id: data.OperationId, Status: data.Status, Message: data.Message})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func notify(op *operation) {
+	callbackMu.Lock()
+	defer callbackMu.Unlock()
+	if ch, ok := waiters[op.Id]; ok {
+		ch <- op
+		delete(waiters, op.Id)
+		return
+	}
+	for id, a := range arrived {
+		if time.Since(a.at) > config.MANAGETIMEOUT {
+			delete(arrived, id)
+		}
+	}
+	arrived[op.Id] = arrivedOperation{op: op, at: time.Now()}
+}
+
+// watchOperation 返回操作完成时会收到回调的 channel，回调已经到达时立即可读。
+func watchOperation(id string) (<-chan *operation, func()) {
+	ch := make(chan *operation, 1)
+	callbackMu.Lock()
+	defer callbackMu.Unlock()
+	if a, ok := arrived[id]; ok {
+		ch <- a.op
+		delete(arrived, id)
+	} else {
+		waiters[id] = ch
+	}
+	return ch, func() {
+		callbackMu.Lock()
+		delete(waiters, id)
+		callbackMu.Unlock()
+	}
+}
@@ -1,13 +1,20 @@
 package manager
 
 import (
-	"bytes"
-	"encoding/json"
+	managerclient "common/client/manager"
+	"common/decision"
+	"common/logging"
+	"common/tracing"
+	"context"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
 	"predict/config"
 	mysql_service "predict/mysql/service"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func AbsInt(n int32) int32 {
@@ -17,75 +24,132 @@ func AbsInt(n int32) int32 {
 	return n
 }
 
-func CalculateMissingInstancesForSite(maxPred float64, zoneId string, siteId string) (int32, error) {
-	// 1. 查询当前边缘站点的容量。
-	siteCapacity, err := mysql_service.QuerySiteCapacity(zoneId, siteId)
+// CalculateMissingInstancesForSite 查询站点的容量和正在使用的实例，计算该规格缺少的实例数。
+func CalculateMissingInstancesForSite(maxPred float64, zoneId string, siteId string, flavor string) (*decision.Calculation, error) {
+	var (
+		c   = &decision.Calculation{Forecast: maxPred}
+		err error
+	)
+	// 1. 查询当前边缘站点该规格的容量，封锁和被隔离的实例不计入。
+	//    站点在下一轮预测之前进入维护窗口时容量视为 0，正在使用的实例也需要迁移到中心，以便提前申请弹性实例。
+	now := time.Now()
+	maintenance, inMaintenance, err := mysql_service.QueryMaintenance(zoneId, siteId, now, now.Add(config.MAINTENANCELOOKAHEAD))
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
-	// 2. 查询目前有多少实例跑在边缘站点上。
-	siteUsingInstances, err := mysql_service.QueryUsingInstances(zoneId, siteId, "site")
-	if err != nil {
-		return -1, err
+	if inMaintenance {
+		c.Maintenance = maintenance
+	} else if c.SiteCapacity, err = mysql_service.QuerySiteCapacity(zoneId, siteId, flavor); err != nil {
+		return nil, err
 	}
-	// 3. 查询目前有多少实例跑在中心站点上。
-	centerUsingInstances, err := mysql_service.QueryUsingInstances(zoneId, siteId, "center")
-	if err != nil {
-		return -1, err
+	// 2. 查询目前有多少该规格的实例跑在边缘站点上。
+	if c.SiteUsingInstances, err = mysql_service.QueryUsingInstances(zoneId, siteId, flavor, "site"); err != nil {
+		return nil, err
 	}
-	// 4. 计算预计还缺少的资源的实例有多少。
-	unAllocateInstances := int32(maxPred - float64(siteUsingInstances+centerUsingInstances))
-	// 5. 计算边缘站点还有多少容量可以利用。
-	siteAvailableInstances := siteCapacity - siteUsingInstances
-	// 6. 只有当预测到实例增加，且边缘站点空闲实例数不足以支撑时，才需要额外的弹性实例。
-	if unAllocateInstances >= 0 && siteAvailableInstances < unAllocateInstances {
-		return int32(unAllocateInstances - siteAvailableInstances), nil
+	// 封锁的实例不计入容量，仍在使用的也不占用容量。
+	if !inMaintenance {
+		if c.SiteCordonedUsing, err = mysql_service.QueryCordonedUsingInstances(zoneId, siteId, flavor); err != nil {
+			return nil, err
+		}
 	}
-
-	return 0, nil
+	// 3. 查询目前有多少该规格的实例跑在中心站点上。
+	if c.CenterUsingInstances, err = mysql_service.QueryUsingInstances(zoneId, siteId, flavor, "center"); err != nil {
+		return nil, err
+	}
+	// 4. 计算缺少的实例数。
+	c.Compute()
+	return c, nil
 }
 
-// zoneId: 区域id
-// missing: 该zone各个边缘缺少的实例总量
-func Manage(zoneId string, missing int32) error {
-	var path = "/instance/manage"
-
-	url := fmt.Sprintf("%s://%s:%s%s", config.MANAGERPROTOCOL, config.MANAGERHOST, config.MANAGERPORT, path)
+var (
+	api    = newClient()
+	tracer = tracing.Tracer("predict/manager")
+)
 
-	requestBodyData := map[string]interface{}{
-		"zone_id": zoneId,
-		"missing": missing,
+func newClient() *managerclient.Client {
+	c := managerclient.New(fmt.Sprintf("%s://%s:%s", config.MANAGERPROTOCOL, config.MANAGERHOST, config.MANAGERPORT))
+	c.HTTPClient = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
 	}
+	return c
+}
+
+type operation = managerclient.Operation
+
+// zoneId: 区域id
+// idempotencyKey: 幂等键，相同的键只会扩缩容一次，为空时不做去重
+// missing: 该zone各个边缘缺少的实例总量，key 为规格名称
+// manager 受理请求后立即返回操作 ID，之后通过 Wait 等待操作完成。
+// 请求头中携带 ctx 的关联 ID，manager 创建的 Pod 会记录该 ID。
+func Manage(ctx context.Context, zoneId string, idempotencyKey string, missing map[string]int32) (operationId string, err error) {
+	ctx, span := tracer.Start(ctx, "manager.Manage")
+	defer func() { tracing.End(span, err) }()
+	logger := logging.FromContext(ctx)
 
-	jsonData, err := json.Marshal(requestBodyData)
+	accepted, err := api.Manage(ctx, &managerclient.ManageRequest{ZoneId: zoneId, Flavors: missing, IdempotencyKey: idempotencyKey})
 	if err != nil {
-		fmt.Printf("Failed to marshal request body data: %v\n", err)
-		return err
+		logger.Error("Failed to apply or release instances", "error", err)
+		return "", err
+	}
+	if accepted.Replayed {
+		logger.Info("Request has been accepted before", "idempotency_key", idempotencyKey, "operation_id", accepted.OperationId)
 	}
+	span.SetAttributes(attribute.String("operation_id", accepted.OperationId), attribute.Bool("replayed", accepted.Replayed))
+	return accepted.OperationId, nil
+}
 
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+// Wait 等待 manager 受理的操作完成或超时，操作没有成功时返回错误。
+func Wait(ctx context.Context, operationId string) error {
+	logger := logging.FromContext(ctx).With("operation_id", operationId)
+	op, err := waitOperation(ctx, logger, operationId)
 	if err != nil {
-		fmt.Printf("Failed to create request: %v\n", err)
+		logger.Error("Failed to wait operation", "error", err)
 		return err
 	}
+	if op.Status != managerclient.OperationSucceeded {
+		return fmt.Errorf("operation %s %s: %s", op.Id, op.Status, op.Message)
+	}
+	logger.Info("Operation succeeded", "instances", op.Summary)
+	return nil
+}
 
-	request.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		fmt.Printf("Error occurred while sending request. Error: %v\n", err)
-		return err
+// waitOperation 等待操作结束或超过 MANAGETIMEOUT。
+// 配置了回调地址时优先等待 manager 的 operation.completed 回调，轮询只作为回调丢失时的兜底。
+func waitOperation(ctx context.Context, logger *slog.Logger, id string) (op *operation, err error) {
+	ctx, span := tracer.Start(ctx, "manager.waitOperation")
+	defer func() { tracing.End(span, err) }()
+
+	interval := config.MANAGEPOLLINTERVAL
+	var callback <-chan *operation
+	if config.CALLBACKURL != "" {
+		ch, stop := watchOperation(id)
+		defer stop()
+		callback = ch
+		interval *= 6
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
+
+	deadline := time.NewTimer(config.MANAGETIMEOUT)
+	defer deadline.Stop()
+	for {
+		op, err := api.GetOperation(ctx, id)
 		if err != nil {
-			fmt.Printf("Failed to close response body: %v\n", err)
+			// 查询失败时继续等待，直到超时。
+			logger.Warn("Failed to query operation", "error", err)
+		} else if op.Finished() {
+			return op, nil
 		}
-	}(response.Body)
 
-	if response.StatusCode != http.StatusOK {
-		fmt.Printf("Failed to apply or release instances: %v\n", response.Status)
-		return fmt.Errorf("failed to apply or release instances: %v", response.Status)
+		select {
+		case op := <-callback:
+			// 回调中没有实例明细，再查询一次完整的操作状态。
+			if full, err := api.GetOperation(ctx, id); err == nil && full.Status == op.Status {
+				return full, nil
+			}
+			return op, nil
+		case <-deadline.C:
+			return nil, fmt.Errorf("operation %s not finished within %v", id, config.MANAGETIMEOUT)
+		case <-time.After(interval):
+		}
 	}
-	return nil
 }
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "dispatcher_predict"
+
+var (
+	// CycleDuration 是一个 zone 一轮预测和扩缩容的耗时。
+	CycleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cycle_duration_seconds",
+		Help:      "Duration of one prediction and scaling cycle of a zone.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 900},
+	}, []string{"zone", "result"})
+
+	// Forecast 是最近一轮预测中站点未来的最大实例需求。
+	Forecast = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "forecast_instances",
+		Help:      "Maximum predicted instances needed by a site in the latest cycle.",
+	}, []string{"zone", "site", "flavor"})
+
+	// Missing 是最近一轮预测中 zone 还需要的弹性实例数量，为负数时表示需要回收。
+	Missing = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "missing_instances",
+		Help:      "Elastic instances still needed by a zone in the latest cycle, negative when instances should be released.",
+	}, []string{"zone", "flavor"})
+
+	// TimesNetDuration 是调用 TimesNet 预测服务的耗时。
+	TimesNetDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "timesnet_request_duration_seconds",
+		Help:      "Latency of requests to the TimesNet prediction service.",
+		Buckets:   []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"zone"})
+
+	// TimesNetErrors 是调用 TimesNet 预测服务失败的次数。
+	TimesNetErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "timesnet_errors_total",
+		Help:      "Number of failed requests to the TimesNet prediction service.",
+	}, []string{"zone"})
+)
@@ -3,6 +3,7 @@ package mysql
 import (
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"predict/config"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -20,8 +21,8 @@ func init() {
 	DB.SetMaxOpenConns(2000)
 	//验证连接
 	if err := DB.Ping(); err != nil {
-		fmt.Println("open database fail")
+		slog.Error("Failed to open database", "error", err)
 		return
 	}
-	fmt.Println("connect success")
+	slog.Info("Database connected")
 }
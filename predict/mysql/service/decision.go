@@ -0,0 +1,37 @@
+package service
+
+import (
+	"predict/mysql"
+	"time"
+)
+
+const (
+	DecisionKindSite = "site" // 某个站点某个规格的缺口计算
+	DecisionKindZone = "zone" // 整个 zone 汇总后发给 manager 的扩缩容请求
+)
+
+// Decision 是一轮预测中的一条扩缩容决策记录，同一轮预测的记录共用一个关联 ID。
+// Detail 为 JSON 格式的输入和计算步骤，Forecast 为 nil 时表示没有预测值。
+type Decision struct {
+	Id            string
+	ZoneId        string
+	SiteId        string
+	Flavor        string
+	Kind          string
+	CorrelationId string
+	Forecast      *float64
+	Missing       int32
+	Detail        string
+}
+
+func InsertDecision(d *Decision) error {
+	_, err := mysql.DB.Exec("INSERT INTO decisions (id, zone_id, site_id, flavor, kind, correlation_id, forecast, missing, detail, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		d.Id, d.ZoneId, d.SiteId, d.Flavor, d.Kind, d.CorrelationId, d.Forecast, d.Missing, d.Detail, time.Now().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// SetDecisionOperation 将一轮预测的所有决策记录关联到 manager 受理的扩缩容操作。
+func SetDecisionOperation(zoneId string, correlationId string, operationId string) error {
+	_, err := mysql.DB.Exec("UPDATE decisions SET operation_id = ? WHERE zone_id = ? AND correlation_id = ?", operationId, zoneId, correlationId)
+	return err
+}
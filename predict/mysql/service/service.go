@@ -1,11 +1,12 @@
 package service
 
 import (
+	"common/instance"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"predict/mysql"
-	"strings"
+	"time"
 )
 
 func GetZoneListInDB() (map[string][]string, error) {
@@ -21,17 +22,18 @@ func GetZoneListInDB() (map[string][]string, error) {
 		if err := rows.Scan(&tableName); err != nil {
 			return nil, err
 		}
-		ZoneID := strings.TrimPrefix(tableName, "instance_")
+		ZoneID, ok := instance.ZoneFromTable(tableName)
+		if !ok {
+			continue
+		}
 
 		sites, err := GetSiteListInZone(ZoneID)
 		if err != nil {
-			log.Printf("Error getting unique site IDs for %s: %v", tableName, err)
+			slog.Error("Error getting unique site IDs", "zone_id", ZoneID, "error", err)
 			continue
 		}
 		zoneList[ZoneID] = sites
 	}
-
-	fmt.Println(zoneList)
 	return zoneList, nil
 }
 
@@ -57,16 +59,24 @@ func GetSiteListInZone(ZoneID string) ([]string, error) {
 	return siteList, nil
 }
 
-func QuerySiteCapacity(zoneId string, siteId string) (int32, error) {
-	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT DISTINCT count(*) AS COUNT FROM instance_%s WHERE is_elastic = 0 AND site_id = '%s'", zoneId, siteId))
+// notCordoned 筛选没有被封锁、所在站点也没有被封锁的固定实例，参数为 zoneId 和 siteId。
+const notCordoned = "cordoned = 0 AND NOT EXISTS (SELECT 1 FROM sites WHERE zone_id = ? AND site_id = ? AND cordoned = 1)"
+
+// inSession 筛选接入了终端的实例，迁移中的实例在终端登出之前仍然接入着终端。
+const inSession = "status IN ('using', 'draining') AND device_id != 'null'"
+
+// QuerySiteCapacity 查询站点的容量，封锁和被隔离的实例不计入容量。
+func QuerySiteCapacity(zoneId string, siteId string, flavor string) (int32, error) {
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT DISTINCT count(*) AS COUNT FROM instance_%s WHERE is_elastic = 0 AND site_id = ? AND flavor = ? AND status != 'quarantined' AND %s", zoneId, notCordoned),
+		siteId, flavor, zoneId, siteId)
 	if err != nil {
-		fmt.Printf("%s-%s: query max site instances failed, err:%v\n", zoneId, siteId, err)
+		slog.Error("query max site instances failed", "zone_id", zoneId, "site_id", siteId, "error", err)
 		return 0, err
 	}
 	defer func(query *sql.Rows) {
 		err := query.Close()
 		if err != nil {
-			fmt.Printf("%s-%s: close query max site instances failed, err:%v\n", zoneId, siteId, err)
+			slog.Error("close query max site instances failed", "zone_id", zoneId, "site_id", siteId, "error", err)
 		}
 	}(rows)
 	var (
@@ -74,7 +84,7 @@ func QuerySiteCapacity(zoneId string, siteId string) (int32, error) {
 	)
 	if rows.Next() {
 		if err := rows.Scan(&count); err != nil {
-			fmt.Printf("%s-%s: scan max site instances failed: %v\n", zoneId, siteId, err)
+			slog.Error("scan max site instances failed", "zone_id", zoneId, "site_id", siteId, "error", err)
 			return 0, err
 		}
 	}
@@ -82,22 +92,23 @@ func QuerySiteCapacity(zoneId string, siteId string) (int32, error) {
 }
 
 // position 表示是获取边缘还是中心正在使用的实例数量
-func QueryUsingInstances(zoneId string, siteId string, position string) (int32, error) {
+func QueryUsingInstances(zoneId string, siteId string, flavor string, position string) (int32, error) {
 	var isElasticInt int32
 	if position == "center" {
 		isElasticInt = 1
 	} else if position == "site" {
 		isElasticInt = 0
 	}
-	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT DISTINCT count(*) AS COUNT FROM instance_%s WHERE is_elastic = %d AND site_id = '%s' AND status = 'using'", zoneId, isElasticInt, siteId))
+	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT DISTINCT count(*) AS COUNT FROM instance_%s WHERE is_elastic = ? AND site_id = ? AND flavor = ? AND %s", zoneId, inSession),
+		isElasticInt, siteId, flavor)
 	if err != nil {
-		fmt.Printf("%s-%s: query current %s instances failed, err:%v\n", zoneId, siteId, position, err)
+		slog.Error("query current instances failed", "zone_id", zoneId, "site_id", siteId, "position", position, "error", err)
 		return 0, err
 	}
 	defer func(query *sql.Rows) {
 		err := query.Close()
 		if err != nil {
-			fmt.Printf("%s-%s: close current %s instances failed, err:%v\n", zoneId, siteId, position, err)
+			slog.Error("close current instances failed", "zone_id", zoneId, "site_id", siteId, "position", position, "error", err)
 		}
 	}(rows)
 	var (
@@ -105,13 +116,39 @@ func QueryUsingInstances(zoneId string, siteId string, position string) (int32,
 	)
 	if rows.Next() {
 		if err := rows.Scan(&count); err != nil {
-			fmt.Printf("%s-%s: scan current %s instances failed, err:%v\n", zoneId, siteId, position, err)
+			slog.Error("scan current instances failed", "zone_id", zoneId, "site_id", siteId, "position", position, "error", err)
 			return 0, err
 		}
 	}
 	return count, nil
 }
 
+// QueryCordonedUsingInstances 查询站点上被封锁但仍有终端在使用的固定实例数量，这些实例不占用站点容量。
+func QueryCordonedUsingInstances(zoneId string, siteId string, flavor string) (int32, error) {
+	var count int32
+	err := mysql.DB.QueryRow(fmt.Sprintf("SELECT count(*) FROM instance_%s WHERE is_elastic = 0 AND site_id = ? AND flavor = ? AND %s AND NOT (%s)", zoneId, inSession, notCordoned),
+		siteId, flavor, zoneId, siteId).Scan(&count)
+	if err != nil {
+		slog.Error("query cordoned using instances failed", "zone_id", zoneId, "site_id", siteId, "error", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// QueryMaintenance 返回与 [from, to) 有重叠的站点或整个 zone 的维护窗口的原因，没有维护窗口时 found 为 false。
+func QueryMaintenance(zoneId string, siteId string, from time.Time, to time.Time) (reason string, found bool, err error) {
+	err = mysql.DB.QueryRow("SELECT reason FROM maintenance_windows WHERE zone_id = ? AND (site_id = '' OR site_id = ?) AND starts_at < ? AND ends_at > ? ORDER BY starts_at LIMIT 1",
+		zoneId, siteId, to.Format("2006-01-02 15:04:05"), from.Format("2006-01-02 15:04:05")).Scan(&reason)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		slog.Error("query maintenance failed", "zone_id", zoneId, "site_id", siteId, "error", err)
+		return "", false, err
+	}
+	return reason, true, nil
+}
+
 func InsertBounceRecord(zoneId string, date string, trueIns int32) error {
 	query := fmt.Sprintf("INSERT INTO bounce_%s (date, true_instances) VALUES (?, ?)", zoneId)
 	stmt, err := mysql.DB.Prepare(query)
@@ -143,13 +180,13 @@ func UpdateBounceRecord(zoneId string, date string, predIns int32) error {
 func QueryBounceRecordExist(zoneId string, date string) (bool, error) {
 	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT * from bounce_%s WHERE date = '%s'", zoneId, date))
 	if err != nil {
-		fmt.Printf("%s: query bounce record exist failed, err:%v\n", zoneId, err)
+		slog.Error("query bounce record exist failed", "zone_id", zoneId, "error", err)
 		return false, err
 	}
 	defer func(query *sql.Rows) {
 		err := query.Close()
 		if err != nil {
-			fmt.Printf("%s: close query bounce record exist failed, err:%v\n", zoneId, err)
+			slog.Error("close query bounce record exist failed", "zone_id", zoneId, "error", err)
 		}
 	}(rows)
 	if rows.Next() {
@@ -161,13 +198,13 @@ func QueryBounceRecordExist(zoneId string, date string) (bool, error) {
 func QueryCenterInstances(zoneId string) (int32, error) {
 	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT DISTINCT count(*) AS COUNT FROM instance_%s WHERE is_elastic = 1", zoneId))
 	if err != nil {
-		fmt.Printf("%s: query center instances failed, err:%v\n", zoneId, err)
+		slog.Error("query center instances failed", "zone_id", zoneId, "error", err)
 		return 0, err
 	}
 	defer func(query *sql.Rows) {
 		err := query.Close()
 		if err != nil {
-			fmt.Printf("%s: close center instances failed, err:%v\n", zoneId, err)
+			slog.Error("close center instances failed", "zone_id", zoneId, "error", err)
 		}
 	}(rows)
 	var (
@@ -175,7 +212,7 @@ func QueryCenterInstances(zoneId string) (int32, error) {
 	)
 	if rows.Next() {
 		if err := rows.Scan(&count); err != nil {
-			fmt.Printf("%s: scan center instances failed, err:%v\n", zoneId, err)
+			slog.Error("scan center instances failed", "zone_id", zoneId, "error", err)
 			return 0, err
 		}
 	}
@@ -185,19 +222,19 @@ func QueryCenterInstances(zoneId string) (int32, error) {
 func QueryAvailableInstanceInCenter(zoneId string) (int32, error) {
 	rows, err := mysql.DB.Query(fmt.Sprintf("SELECT DISTINCT count(*) AS COUNT FROM instance_%s WHERE is_elastic = 1 AND status = 'available'", zoneId))
 	if err != nil {
-		fmt.Printf("%s: query current available instance failed, err: %v\n", zoneId, err)
+		slog.Error("query current available instance failed", "zone_id", zoneId, "error", err)
 		return 0, err
 	}
 	defer func(query *sql.Rows) {
 		if err := query.Close(); err != nil {
-			fmt.Printf("%s: close current available instance failed, err: %v\n", zoneId, err)
+			slog.Error("close current available instance failed", "zone_id", zoneId, "error", err)
 		}
 	}(rows)
 
 	var count int32
 	if rows.Next() {
 		if err := rows.Scan(&count); err != nil {
-			fmt.Printf("%s: scan current available instance failed, err: %v\n", zoneId, err)
+			slog.Error("scan current available instance failed", "zone_id", zoneId, "error", err)
 			return 0, err
 		}
 	}
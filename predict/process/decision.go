@@ -0,0 +1,55 @@
+package process
+
+import (
+	"common/decision"
+	"common/logging"
+	"context"
+	"encoding/json"
+	"fmt"
+	mysqlservice "predict/mysql/service"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// recordDecision 保存一条决策记录，失败时只记录日志，不影响本轮预测。
+func recordDecision(ctx context.Context, d *mysqlservice.Decision, detail *decision.Detail) {
+	logger := logging.FromContext(ctx)
+	d.Id = string(uuid.NewUUID())
+	d.CorrelationId = logging.CorrelationID(ctx)
+	data, err := json.Marshal(detail)
+	if err != nil {
+		logger.Warn("Failed to marshal decision detail", "error", err)
+		return
+	}
+	d.Detail = string(data)
+	if err := mysqlservice.InsertDecision(d); err != nil {
+		logger.Warn("Failed to record decision", "kind", d.Kind, "error", err)
+	}
+}
+
+// recordZoneDecision 保存 zone 汇总后发给 manager 的各规格缺少的实例数，
+// manager 按规格减去中心可用的弹性实例后决定申请或回收的数量。
+func recordZoneDecision(ctx context.Context, zoneId string, sites int, idempotencyKey string, centerAvailable int32, missing map[string]int32) {
+	flavors := make([]string, 0, len(missing))
+	for flavor := range missing {
+		flavors = append(flavors, flavor)
+	}
+	sort.Strings(flavors)
+
+	total := int32(0)
+	steps := make([]decision.Step, 0, len(flavors))
+	for _, flavor := range flavors {
+		total += missing[flavor]
+		steps = append(steps, decision.Step{Description: fmt.Sprintf("missing[%s] = sum of site missing", flavor), Value: float64(missing[flavor])})
+	}
+	recordDecision(ctx, &mysqlservice.Decision{ZoneId: zoneId, Kind: mysqlservice.DecisionKindZone, Missing: total}, &decision.Detail{
+		Inputs: map[string]interface{}{
+			"sites":                      sites,
+			"missing":                    missing,
+			"center_available_instances": centerAvailable,
+			"idempotency_key":            idempotencyKey,
+		},
+		Steps: steps,
+	})
+}
@@ -1,18 +1,28 @@
 package process
 
 import (
+	"common/decision"
+	"common/logging"
+	"common/tracing"
+	"context"
 	"fmt"
-	"log"
 	"math"
+	"predict/config"
 	"predict/manager"
+	"predict/metrics"
 	"predict/mysql"
 	mysqlservice "predict/mysql/service"
 	"predict/timesnet"
 	"sort"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = tracing.Tracer("predict/process")
+
 var (
 	TEnd              *time.Time = nil
 	TStart            *time.Time = nil
@@ -20,94 +30,132 @@ var (
 	layout                       = "2006-01-02 15:04:05"
 )
 
-func Process(zoneId string, siteList []string) error {
-	zoneFixed := int32(0)   // 片区固定资源，即所有边缘站点固定资源总和
-	zoneMissing := int32(0) // 片区还需要的资源实例数，后续需要减掉可用弹性实例
+// Process 对 zone 进行一轮预测并扩缩容，ctx 中携带本轮的关联 ID 和 zone 字段。
+func Process(ctx context.Context, zoneId string, siteList []string) error {
+	logger := logging.FromContext(ctx)
+	// 规格集合以配置为准，某个规格还没有实例时也需要预测，才能为它申请弹性实例。
+	flavorList := config.FLAVORS
+
+	zoneFixed := int32(0)                 // 片区固定资源，即所有边缘站点固定资源总和
+	zoneMissing := make(map[string]int32) // 片区各规格还需要的资源实例数，后续需要减掉可用弹性实例
+	for _, flavor := range flavorList {
+		zoneMissing[flavor] = 0
+	}
 
 	latestTime := time.Date(2001, 1, 1, 0, 0, 0, 0, time.Local)
 	siteDateTrueInstanceMap := make(map[string]map[string]int32)
-	fmt.Printf("the address of siteDateTrueInstanceMap is %v", &siteDateTrueInstanceMap)
 
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	for _, siteId := range siteList {
-		wg.Add(1)
-		go func(zoneId string, siteId string) {
-			defer wg.Done()
-			queryDateInstanceSQL := fmt.Sprintf("SELECT site_id, date, instances, login_failures FROM record_%s WHERE site_id = '%s' ORDER BY date DESC LIMIT 180", zoneId, siteId)
-			DateInstanceRows, err := mysql.DB.Query(queryDateInstanceSQL)
-			if err != nil {
-				fmt.Printf("%s-%s, query date instance failed, err:%v\n", zoneId, siteId, err)
-				panic(fmt.Sprintf("%s-%s, query date instance failed, err:%v\n", zoneId, siteId, err))
-			}
-			predMap := make(timesnet.PredDataSource)
-			fmt.Printf("the address of predMap is %v", &predMap)
-			for DateInstanceRows.Next() {
-				var (
-					siteId         string
-					date           string
-					instances      int32
-					login_failures int32
-				)
-				if err := DateInstanceRows.Scan(&siteId, &date, &instances, &login_failures); err != nil {
-					fmt.Printf("%s-%s: scan date instance failed: %v\n", zoneId, siteId, err)
-					panic(fmt.Sprintf("%s-%s: scan date instance failed: %v\n", zoneId, siteId, err))
+		for _, flavor := range flavorList {
+			wg.Add(1)
+			go func(zoneId string, siteId string, flavor string) {
+				defer wg.Done()
+				siteCtx, span := tracer.Start(logging.With(ctx, "site_id", siteId, "flavor", flavor), "predict.site", trace.WithAttributes(
+					attribute.String("site_id", siteId),
+					attribute.String("flavor", flavor),
+				))
+				defer span.End()
+				logger := logging.FromContext(siteCtx)
+				queryDateInstanceSQL := fmt.Sprintf("SELECT site_id, date, instances, login_failures FROM record_%s WHERE site_id = ? AND flavor = ? ORDER BY date DESC LIMIT 180", zoneId)
+				queryCtx, querySpan := tracer.Start(siteCtx, "record.query")
+				DateInstanceRows, err := mysql.DB.QueryContext(queryCtx, queryDateInstanceSQL, siteId, flavor)
+				if err != nil {
+					tracing.End(querySpan, err)
+					logger.Error("query date instance failed", "error", err)
+					panic(fmt.Sprintf("%s-%s, query date instance failed, err:%v\n", zoneId, siteId, err))
+				}
+				predMap := make(timesnet.PredDataSource)
+				for DateInstanceRows.Next() {
+					var (
+						siteId         string
+						date           string
+						instances      int32
+						login_failures int32
+					)
+					if err := DateInstanceRows.Scan(&siteId, &date, &instances, &login_failures); err != nil {
+						logger.Error("scan date instance failed", "error", err)
+						panic(fmt.Sprintf("%s-%s: scan date instance failed: %v\n", zoneId, siteId, err))
+					}
+					dateTime, err := time.ParseInLocation(layout, date, time.Local)
+					if err != nil {
+						logger.Error("parse date failed", "error", err)
+						panic(fmt.Sprintf("%s-%s: parse date failed: %v\n", zoneId, siteId, err))
+					}
+					// fmt.Printf("latestTime: %v, dateTime: %v\n", latestTime, dateTime)
+					if latestTime.Before(dateTime) {
+						latestTime = dateTime
+					}
+					predMap[date] = instances + login_failures
+				}
+				if err := DateInstanceRows.Err(); err != nil {
+					logger.Error("error during date instance iteration", "error", err)
+					panic(fmt.Sprintf("%s-%s: error during date instance iteration: %v\n", zoneId, siteId, err))
 				}
-				dateTime, err := time.ParseInLocation(layout, date, time.Local)
+				err = DateInstanceRows.Close()
+				querySpan.SetAttributes(attribute.Int("records", len(predMap)))
+				tracing.End(querySpan, err)
 				if err != nil {
-					fmt.Printf("%s-%s: parse date failed: %v\n", zoneId, siteId, err)
-					panic(fmt.Sprintf("%s-%s: parse date failed: %v\n", zoneId, siteId, err))
+					logger.Error("close query date instance failed", "error", err)
+					panic(fmt.Sprintf("%s-%s: close query date instance failed, err:%v\n", zoneId, siteId, err))
 				}
-				// fmt.Printf("latestTime: %v, dateTime: %v\n", latestTime, dateTime)
-				if latestTime.Before(dateTime) {
-					latestTime = dateTime
+				if len(predMap) != 180 {
+					logger.Warn("Not enough history to predict", "records", len(predMap))
+					recordDecision(siteCtx, &mysqlservice.Decision{ZoneId: zoneId, SiteId: siteId, Flavor: flavor, Kind: mysqlservice.DecisionKindSite}, &decision.Detail{
+						Inputs: map[string]interface{}{"history_records": len(predMap)},
+						Steps:  []decision.Step{{Description: fmt.Sprintf("skipped: %d of 180 history records", len(predMap)), Value: 0}},
+					})
+					return
 				}
-				predMap[date] = instances + login_failures
-			}
-			if err := DateInstanceRows.Err(); err != nil {
-				fmt.Printf("%s-%s: error during date instance iteration: %v\n", zoneId, siteId, err)
-				panic(fmt.Sprintf("%s-%s: error during date instance iteration: %v\n", zoneId, siteId, err))
-			}
-			err = DateInstanceRows.Close()
-			if err != nil {
-				fmt.Printf("%s-%s: close query date instance failed, err:%v\n", zoneId, siteId, err)
-				panic(fmt.Sprintf("%s-%s: close query date instance failed, err:%v\n", zoneId, siteId, err))
-			}
-			if len(predMap) != 180 {
-				fmt.Printf("%s-%s: date instance length is not 180\n", zoneId, siteId)
-				return
-			}
-
-			predResponse, err := timesnet.Predict(predMap, zoneId, siteId)
-			if err != nil {
-				fmt.Printf("%s-%s: predict failed, err:%v\n", zoneId, siteId, err)
-				panic(fmt.Sprintf("%s-%s: predict failed, err:%v\n", zoneId, siteId, err))
-			}
-
-			maxPred := math.SmallestNonzeroFloat64
-			for _, pred := range predResponse.Pred {
-				maxPred = math.Max(maxPred, pred)
-			}
-			siteMissing, err := manager.CalculateMissingInstancesForSite(maxPred, zoneId, siteId)
-			if err != nil {
-				fmt.Printf("%s-%s: calc failed, err:%v\n", zoneId, siteId, err)
-				panic(fmt.Sprintf("%s-%s: calc failed, err:%v\n", zoneId, siteId, err))
-			}
 
-			siteCapacity, err := mysqlservice.QuerySiteCapacity(zoneId, siteId)
-			if err != nil {
-				fmt.Printf("%s-%s: query site capacity failed, err:%v\n", zoneId, siteId, err)
-				panic(fmt.Sprintf("%s-%s: query site capacity failed, err:%v\n", zoneId, siteId, err))
-			}
+				predResponse, err := timesnet.Predict(siteCtx, predMap, zoneId, siteId, flavor)
+				if err != nil {
+					logger.Error("predict failed", "error", err)
+					panic(fmt.Sprintf("%s-%s: predict failed, err:%v\n", zoneId, siteId, err))
+				}
 
-			mu.Lock()
-			siteDateTrueInstanceMap[siteId] = predMap
-			fmt.Printf("%s-%s: siteDateTrueInstanceMap value is %v \n", zoneId, siteId, predMap)
-			zoneFixed += siteCapacity
-			zoneMissing += siteMissing
-			mu.Unlock()
-			log.Printf("%s: %d pods needed totally", siteId, int32(maxPred))
-		}(zoneId, siteId)
+				maxPred := math.SmallestNonzeroFloat64
+				for _, pred := range predResponse.Pred {
+					maxPred = math.Max(maxPred, pred)
+				}
+				span.SetAttributes(attribute.Float64("forecast", maxPred))
+				calc, err := manager.CalculateMissingInstancesForSite(maxPred, zoneId, siteId, flavor)
+				if err != nil {
+					logger.Error("calc failed", "error", err)
+					panic(fmt.Sprintf("%s-%s: calc failed, err:%v\n", zoneId, siteId, err))
+				}
+				siteMissing := calc.Missing
+				recordDecision(siteCtx, &mysqlservice.Decision{
+					ZoneId:   zoneId,
+					SiteId:   siteId,
+					Flavor:   flavor,
+					Kind:     mysqlservice.DecisionKindSite,
+					Forecast: &maxPred,
+					Missing:  siteMissing,
+				}, &decision.Detail{
+					Inputs: map[string]interface{}{
+						"history_records":        len(predMap),
+						"predictions":            predResponse.Pred,
+						"site_capacity":          calc.SiteCapacity,
+						"site_using_instances":   calc.SiteUsingInstances,
+						"site_cordoned_using":    calc.SiteCordonedUsing,
+						"maintenance":            calc.Maintenance,
+						"center_using_instances": calc.CenterUsingInstances,
+					},
+					Steps: append([]decision.Step{{Description: "forecast = max(predictions)", Value: maxPred}}, calc.Steps()...),
+				})
+
+				metrics.Forecast.WithLabelValues(zoneId, siteId, flavor).Set(maxPred)
+				mu.Lock()
+				siteDateTrueInstanceMap[fmt.Sprintf("%s-%s", siteId, flavor)] = predMap
+				logger.Debug("History collected", "records", len(predMap))
+				zoneFixed += calc.SiteCapacity
+				zoneMissing[flavor] += siteMissing
+				mu.Unlock()
+				logger.Info("Site forecast", "pods_needed", int32(maxPred), "missing", siteMissing)
+			}(zoneId, siteId, flavor)
+		}
 	}
 	wg.Wait()
 
@@ -127,11 +175,13 @@ func Process(zoneId string, siteList []string) error {
 	}
 	sort.Strings(sourceKeys)
 
+	_, bounceSpan := tracer.Start(ctx, "bounce.record", trace.WithAttributes(attribute.Int("records", len(sourceKeys))))
+	defer bounceSpan.End()
 	for _, date := range sourceKeys {
 		// 插入之前需要检查一下是否已经插入过了。
 		isExist, err := mysqlservice.QueryBounceRecordExist(zoneId, date)
 		if err != nil {
-			fmt.Printf("%s: query bounce record exist failed, err: %v\n", zoneId, err)
+			logger.Error("query bounce record exist failed", "error", err)
 			return err
 		}
 		if isExist {
@@ -139,7 +189,7 @@ func Process(zoneId string, siteList []string) error {
 		}
 		err = mysqlservice.InsertBounceRecord(zoneId, date, dateInstanceMap[date])
 		if err != nil {
-			fmt.Printf("%s: insert true instances into bounce record failed, err: %v\n", zoneId, err)
+			logger.Error("insert true instances into bounce record failed", "error", err)
 			return err
 		}
 	}
@@ -156,7 +206,7 @@ func Process(zoneId string, siteList []string) error {
 		for _, timeString := range timeStrings {
 			err := mysqlservice.UpdateBounceRecord(zoneId, timeString, deployedInstances)
 			if err != nil {
-				fmt.Printf("%s: update pred instance into bounce record failed, err: %v\n", zoneId, err)
+				logger.Error("update pred instance into bounce record failed", "error", err)
 			}
 		}
 	} else {
@@ -168,13 +218,35 @@ func Process(zoneId string, siteList []string) error {
 
 	centerAvailableInstances, err := mysqlservice.QueryAvailableInstanceInCenter(zoneId)
 	if err != nil {
-		fmt.Printf("Failed to get available instances in %s center: %v\n", zoneId, err)
+		logger.Error("Failed to get available instances in center", "error", err)
 		return err
 	}
-	deployedInstances += zoneMissing - centerAvailableInstances
+	for _, missing := range zoneMissing {
+		deployedInstances += missing
+	}
+	deployedInstances -= centerAvailableInstances
+	for flavor, missing := range zoneMissing {
+		metrics.Missing.WithLabelValues(zoneId, flavor).Set(float64(missing))
+	}
 
-	if err := manager.Manage(zoneId, zoneMissing); err != nil {
-		fmt.Printf("Failed to apply or release instances in %s center: %v\n", zoneId, err)
+	// 以 zone 和本轮预测使用的最新记录时间作为幂等键，重试或主备切换时重叠的两轮预测不会重复扩缩容。
+	idempotencyKey := ""
+	if !latestTime.Equal(time.Date(2001, 1, 1, 0, 0, 0, 0, time.Local)) {
+		idempotencyKey = fmt.Sprintf("%s-%d", zoneId, latestTime.Unix())
+	}
+	logger.Info("Zone forecast", "missing", zoneMissing, "center_available", centerAvailableInstances)
+	recordZoneDecision(ctx, zoneId, len(siteList), idempotencyKey, centerAvailableInstances, zoneMissing)
+	operationId, err := manager.Manage(ctx, zoneId, idempotencyKey, zoneMissing)
+	if err != nil {
+		logger.Error("Failed to apply or release instances in center", "error", err)
+		return err
+	}
+	// 受理后立即关联操作，等待期间也可以从决策记录查到正在执行的操作。
+	if err := mysqlservice.SetDecisionOperation(zoneId, logging.CorrelationID(ctx), operationId); err != nil {
+		logger.Warn("Failed to link decisions to operation", "operation_id", operationId, "error", err)
+	}
+	if err := manager.Wait(ctx, operationId); err != nil {
+		logger.Error("Failed to apply or release instances in center", "operation_id", operationId, "error", err)
 		return err
 	}
 	return nil
@@ -1,6 +1,7 @@
 package process
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
@@ -13,6 +14,6 @@ func Test_Process(t *testing.T) {
 	}
 
 	for i := 0; i < 10; i++ {
-		go Process("zoneId", strs)
+		go Process(context.Background(), "zoneId", strs)
 	}
 }
@@ -2,6 +2,9 @@ package timesnet
 
 import (
 	"bytes"
+	"common/logging"
+	"common/tracing"
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -11,17 +14,24 @@ import (
 	"os"
 	"path/filepath"
 	"predict/config"
+	"predict/metrics"
 	"runtime"
 	"sort"
 	"strconv"
 	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	path   = "/predict"
 	client = &http.Client{
-		Timeout: 600 * time.Second,
+		Timeout:   600 * time.Second,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
 	}
+	tracer = tracing.Tracer("predict/timesnet")
 )
 
 type PredDataSource map[string]int32
@@ -33,7 +43,17 @@ type PredDataResponse struct {
 	Pred   []float64
 }
 
-func Predict(source PredDataSource, zoneId string, siteId string) (*PredDataResponse, error) {
+func Predict(ctx context.Context, source PredDataSource, zoneId string, siteId string, flavor string) (response *PredDataResponse, err error) {
+	ctx, span := tracer.Start(ctx, "timesnet.Predict", trace.WithAttributes(attribute.Int("points", len(source))))
+	defer func() { tracing.End(span, err) }()
+	logger := logging.FromContext(ctx)
+	start := time.Now()
+	defer func() {
+		metrics.TimesNetDuration.WithLabelValues(zoneId).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.TimesNetErrors.WithLabelValues(zoneId).Inc()
+		}
+	}()
 
 	// 数据扩大n倍，用于预测
 	var scaledPredDataSource = make(PredDataSource)
@@ -41,9 +61,9 @@ func Predict(source PredDataSource, zoneId string, siteId string) (*PredDataResp
 		scaledPredDataSource[date] = value * int32(config.SCALERATIO)
 	}
 
-	csvPath, err := source2csv(scaledPredDataSource, zoneId, siteId)
+	csvPath, err := source2csv(ctx, scaledPredDataSource, zoneId, siteId, flavor)
 	if err != nil {
-		fmt.Println("Error converting source to CSV:", err)
+		logger.Error("Error converting source to CSV", "error", err)
 		return nil, err
 	}
 
@@ -52,56 +72,57 @@ func Predict(source PredDataSource, zoneId string, siteId string) (*PredDataResp
 
 	file, err := os.Open(csvPath)
 	if err != nil {
-		fmt.Println("Error opening file:", err)
+		logger.Error("Error opening file", "error", err)
 		return nil, err
 	}
 	defer func(file *os.File) {
 		err := file.Close()
 		if err != nil {
-			fmt.Println("Error closing file:", err)
+			logger.Error("Error closing file", "error", err)
 		}
 	}(file)
 
 	fileWriter, err := writer.CreateFormFile("source", csvPath)
 	if err != nil {
-		fmt.Println("Error creating form file:", err)
+		logger.Error("Error creating form file", "error", err)
 		return nil, err
 	}
 	_, err = io.Copy(fileWriter, file)
 	if err != nil {
-		fmt.Println("Error copying file to form:", err)
+		logger.Error("Error copying file to form", "error", err)
 		return nil, err
 	}
 	err = writer.Close()
 	if err != nil {
-		fmt.Println("Error closing writer:", err)
+		logger.Error("Error closing writer", "error", err)
 		return nil, err
 	}
 
-	url := fmt.Sprintf("%s://%s:%s%s/%s/%s", config.TIMESNETPROTOCOL, config.TIMESNETHOST, config.TIMESNETPORT, path, zoneId, siteId)
-	// 对于每个边缘站点的预测，都会有一个对应的请求路径，siteId 用作区分。
-	req, err := http.NewRequest("POST", url, &reqBody)
+	url := fmt.Sprintf("%s://%s:%s%s/%s/%s?flavor=%s", config.TIMESNETPROTOCOL, config.TIMESNETHOST, config.TIMESNETPORT, path, zoneId, siteId, flavor)
+	// 对于每个边缘站点的预测，都会有一个对应的请求路径，siteId 用作区分，不同规格通过 flavor 参数区分。
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &reqBody)
 	if err != nil {
-		fmt.Println("Error creating request:", err)
+		logger.Error("Error creating request", "error", err)
 		return nil, err
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set(logging.CorrelationHeader, logging.CorrelationID(ctx))
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Println("Error sending request:", err)
+		logger.Error("Error sending request", "error", err)
 		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			fmt.Println("Error closing response body:", err)
+			logger.Error("Error closing response body", "error", err)
 		}
 	}(resp.Body)
 
 	var responseData PredDataResponse
 	decoder := json.NewDecoder(resp.Body)
 	if err := decoder.Decode(&responseData); err != nil {
-		fmt.Println("Error decoding JSON:", err)
+		logger.Error("Error decoding JSON", "error", err)
 		return nil, err
 	}
 
@@ -112,34 +133,35 @@ func Predict(source PredDataSource, zoneId string, siteId string) (*PredDataResp
 	return &responseData, nil
 }
 
-func source2csv(source PredDataSource, zoneId, siteId string) (string, error) {
+func source2csv(ctx context.Context, source PredDataSource, zoneId, siteId, flavor string) (string, error) {
+	logger := logging.FromContext(ctx)
 	_, filename, _, _ := runtime.Caller(0)
 	curDir := filepath.Dir(filename)
-	csvPath := filepath.Join(curDir, fmt.Sprintf("%s-%s-source.csv", zoneId, siteId))
+	csvPath := filepath.Join(curDir, fmt.Sprintf("%s-%s-%s-source.csv", zoneId, siteId, flavor))
 
 	// 确保包含文件的目录存在
 	dir := filepath.Dir(csvPath)
 	err := os.MkdirAll(dir, 0755) // 创建所有必需的父目录，并设置权限
 	if err != nil {
-		fmt.Println("Error creating directory:", err)
+		logger.Error("Error creating directory", "error", err)
 		return "", err
 	}
 	file, err := os.OpenFile(csvPath, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		fmt.Println("Error opening file:", err)
+		logger.Error("Error opening file", "error", err)
 		return "", err
 	}
 	defer func(file *os.File) {
 		err := file.Close()
 		if err != nil {
-			fmt.Println("Error closing file:", err)
+			logger.Error("Error closing file", "error", err)
 		}
 	}(file)
 
 	writer := csv.NewWriter(file)
 	err = writer.Write([]string{"date", "value"})
 	if err != nil {
-		fmt.Println("Error writing CSV:", err)
+		logger.Error("Error writing CSV", "error", err)
 		return "", err
 	}
 
@@ -153,14 +175,14 @@ func source2csv(source PredDataSource, zoneId, siteId string) (string, error) {
 		valueStr := strconv.Itoa(int(source[date]))
 		err := writer.Write([]string{date, valueStr})
 		if err != nil {
-			fmt.Println("Error writing CSV:", err)
+			logger.Error("Error writing CSV", "error", err)
 			return "", err
 		}
 	}
 
 	writer.Flush()
 	if err := writer.Error(); err != nil {
-		fmt.Println("Error writing CSV:", err)
+		logger.Error("Error writing CSV", "error", err)
 		return "", err
 	}
 	return csvPath, nil
@@ -34,8 +34,16 @@ kubectl exec -it mysql -- mysql -uroot -p'cloudgame' -e "use cloudgame; delete f
 cd ~/cloudgame/dispatcher/test/
 go run main.go
 
-# 4. call manager api to release elastic instances
-curl -X POST http://localhost:31365/instance/manage -d '{"zone_id":"huadong","missing":0}'
+# 4. call manager api to release elastic instances, and wait for the operation to finish
+operation_id=$(curl -s -X POST http://localhost:31365/instance/manage -d '{"zone_id":"huadong","missing":0}' | sed -n 's/.*"operation_id":"\([^"]*\)".*/\1/p')
+for i in $(seq 1 60); do
+    status=$(curl -s http://localhost:31365/operations/${operation_id} | sed -n 's/.*"zone_id":"[^"]*","status":"\([a-z]*\)".*/\1/p')
+    echo "operation ${operation_id}: ${status}"
+    if [ "${status}" == "succeeded" ] || [ "${status}" == "failed" ]; then
+        break
+    fi
+    sleep 5
+done
 
 # 5. stop manager
 cd ~/cloudgame/deploys/deployments/
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"common/flavor"
+	"common/logging"
 	"log"
 	"os"
 	"strconv"
@@ -11,16 +13,34 @@ var (
 	RECORDENABLED  = false  // 是否开启定时记录任务，默认关闭（需要记录真实时间，模拟时不可以开启，模拟时由fakeuser实现记录）
 	USERCENTERPORT = "8888" // 用户交互模块服务端口
 
+	LOGLEVEL  string // 日志级别：debug、info、warn、error，默认为 info
+	LOGFORMAT string // 日志格式：json 或 text，默认为 json
+
+	TRACEEXPORTER string // 链路追踪导出方式：none、otlp、stdout 或 file，默认为 none
+	TRACEFILE     string // TRACEEXPORTER 为 file 时的输出文件
+
 	K8SNAMSPACE       string // K8S命名空间
 	MYSQLHOST         string // MYSQL服务地址
 	MYSQLPORT         string // MYSQL服务端口
 	MYSQLUSER         string // MYSQL服务用户
 	MYSQLPASSWORD     string // MYSQL服务密码
 	MYSQLDATABASE     string // MYSQL服务数据库
-	ACCELERATIONRATIO int    // 测试时间加速比例
+	ACCELERATIONRATIO = 1    // 测试时间加速比例
+
+	FLAVORCONFIGPATH string                     // 实例规格配置文件路径，与 manager 使用同一个文件
+	FLAVORS          = []string{flavor.Default} // 可以登录的规格，来自实例规格配置
 )
 
-func init() {
+// Load 从环境变量读取配置，配置不合法时退出。未调用时各项为默认值，单元测试直接设置需要的配置。
+func Load() {
+	LOGLEVEL = os.Getenv("LOG_LEVEL")
+	LOGFORMAT = os.Getenv("LOG_FORMAT")
+	if err := logging.Setup("usercenter", LOGLEVEL, LOGFORMAT); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	TRACEEXPORTER = os.Getenv("TRACE_EXPORTER")
+	TRACEFILE = os.Getenv("TRACE_FILE")
+
 	K8SNAMSPACE = os.Getenv("NAMESPACE")
 	if K8SNAMSPACE == "" {
 		log.Fatalf("Failed to get namespace from env")
@@ -65,4 +85,15 @@ func init() {
 	} else if ACCELERATIONRATIO > 1 {
 		RECORDENABLED = false // 加速的情况下，禁止启用定时记录任务
 	}
+
+	FLAVORCONFIGPATH = os.Getenv("FLAVOR_CONFIG_PATH")
+	FLAVORS, err = flavor.LoadNames(FLAVORCONFIGPATH)
+	if err != nil {
+		log.Fatalf("Failed to load flavor config: %v", err)
+	}
+}
+
+// HasFlavor 判断规格是否在实例规格配置中。
+func HasFlavor(name string) bool {
+	return flavor.Contains(FLAVORS, name)
 }
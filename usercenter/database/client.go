@@ -3,7 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"usercenter/config"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -13,11 +13,8 @@ var (
 	DB *sql.DB
 )
 
-func init() {
-	initMySQL()
-}
-
-func initMySQL() {
+// Connect 按配置连接数据库，单元测试直接替换 DB。
+func Connect() {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8", config.MYSQLUSER, config.MYSQLPASSWORD, config.MYSQLHOST, config.MYSQLPORT, config.MYSQLDATABASE)
 	DB, _ = sql.Open("mysql", dsn)
 	DB.SetConnMaxLifetime(100)
@@ -25,8 +22,8 @@ func initMySQL() {
 	DB.SetMaxOpenConns(2000)
 	//验证连接
 	if err := DB.Ping(); err != nil {
-		log.Println("Failed to connect to MySQL:", err)
+		slog.Error("Failed to connect to MySQL", "error", err)
 		return
 	}
-	fmt.Println("MySQL connect success")
+	slog.Info("MySQL connected")
 }
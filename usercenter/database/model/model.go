@@ -10,6 +10,7 @@ type Instance struct {
 	IsElastic  int    `json:"is_elastic"`
 	Status     string `json:"status"`
 	DeviceId   string `json:"device_id"`
+	Flavor     string `json:"flavor"`
 }
 
 type Record struct {
@@ -17,4 +18,5 @@ type Record struct {
 	SiteID    string `json:"site_id"`
 	Date      string `json:"date"`
 	Instances int    `json:"instance_id"`
+	Flavor    string `json:"flavor"`
 }
@@ -1,40 +1,87 @@
 package service
 
 import (
+	"common/flavor"
+	instancestate "common/instance"
+	"common/tracing"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
 	"sync"
+	"time"
 	"usercenter/database"
 	"usercenter/database/model"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	loginMutex sync.Mutex
+	tracer     = tracing.Tracer("usercenter/database")
 )
 
-var loginMutex sync.Mutex
+// serviceName 写入实例状态历史时记录的服务名
+const serviceName = "usercenter"
+
+// loginMaxAttempts 实例被其他副本抢先接入时最多尝试的次数
+const loginMaxAttempts = 3
+
+// DefaultFlavor 默认规格，未指定规格的登录请求都使用该规格
+const DefaultFlavor = flavor.Default
+
+// inSession 筛选接入了终端的实例，迁移中的实例在终端登出之前仍然接入着终端。
+const inSession = "status IN ('using', 'draining') AND device_id != 'null'"
+
+// instanceColumns 实例表中需要读取的列，顺序与 scanInstance 保持一致
+const instanceColumns = "site_id, server_ip, instance_id, pod_name, port, is_elastic, status, device_id, flavor"
 
 // 获取可用实例并接入终端
-func GetInstanceAndLogin(zoneID string, siteID string, deviceID string) (*model.Instance, error) {
+func GetInstanceAndLogin(ctx context.Context, zoneID string, siteID string, deviceID string, flavor string) (_ *model.Instance, err error) {
+	ctx, span := tracer.Start(ctx, "service.GetInstanceAndLogin", trace.WithAttributes(
+		attribute.String("zone_id", zoneID),
+		attribute.String("site_id", siteID),
+		attribute.String("flavor", flavor),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	loginMutex.Lock()
 	defer loginMutex.Unlock()
+	span.AddEvent("login lock acquired")
+
+	// loginMutex 只在副本内生效，查询到的实例可能已经被其他副本接入，此时重新选择实例
+	for attempt := 1; ; attempt++ {
+		instance, err := loginAvailableInstance(ctx, zoneID, siteID, deviceID, flavor)
+		if !errors.Is(err, instancestate.ErrConflict) || attempt == loginMaxAttempts {
+			return instance, err
+		}
+		span.AddEvent("instance taken by another replica", trace.WithAttributes(attribute.Int("attempt", attempt)))
+	}
+}
 
+// loginAvailableInstance 优先接入边缘站点的可用实例，边缘没有可用实例时接入中心的弹性实例
+func loginAvailableInstance(ctx context.Context, zoneID string, siteID string, deviceID string, flavor string) (*model.Instance, error) {
 	// 获取边缘可用的实例
-	instance, err := getAvailableInstanceFromSite(zoneID, siteID)
+	instance, err := getAvailableInstanceFromSite(ctx, zoneID, siteID, flavor)
 	if err == nil {
 		// 边缘有可用实例
-		instance, err := loginDevice(instance, deviceID, "site")
+		instance, err := loginDevice(ctx, instance, deviceID, "site")
 		if err != nil {
-			return nil, fmt.Errorf("failed to update instance information in %s: %v", siteID, err)
+			return nil, fmt.Errorf("failed to update instance information in %s: %w", siteID, err)
 		}
 		return instance, nil
 	}
 
 	// 获取中心可用实例
-	instance, err = getAvailableInstanceFromCenter(zoneID)
+	instance, err = getAvailableInstanceFromCenter(ctx, zoneID, flavor)
 	if err == nil {
 		// 中心有可用实例
 		instance.SiteID = siteID // 弹性实例需要额外给site_id赋值
-		instance, err := loginDevice(instance, deviceID, "center")
+		instance, err := loginDevice(ctx, instance, deviceID, "center")
 		if err != nil {
-			return nil, fmt.Errorf("failed to update instance information in %s: %v", zoneID, err)
+			return nil, fmt.Errorf("failed to update instance information in %s: %w", zoneID, err)
 		}
 		return instance, nil
 	}
@@ -43,23 +90,38 @@ func GetInstanceAndLogin(zoneID string, siteID string, deviceID string) (*model.
 }
 
 // 根据终端id更新实例信息，登出设备
-func LogoutDevice(zoneID string, siteID string, deviceID string) error {
+func LogoutDevice(ctx context.Context, zoneID string, siteID string, deviceID string) (err error) {
+	ctx, span := tracer.Start(ctx, "service.LogoutDevice", trace.WithAttributes(
+		attribute.String("zone_id", zoneID),
+		attribute.String("site_id", siteID),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	isElastic := -1 // 初始值，避免未使用的错误
 	instanceID := ""
+	status := ""
 
-	err := database.DB.QueryRow(fmt.Sprintf(`SELECT instance_id, is_elastic FROM instance_%s WHERE site_id = ? AND device_id = ? LIMIT 1`, zoneID), siteID, deviceID).Scan(&instanceID, &isElastic)
+	err = database.DB.QueryRowContext(ctx, fmt.Sprintf(`SELECT instance_id, is_elastic, status FROM instance_%s WHERE site_id = ? AND device_id = ? LIMIT 1`, zoneID), siteID, deviceID).Scan(&instanceID, &isElastic, &status)
 	if err != nil {
 		return fmt.Errorf("%s cannot be found in %s table: %v", deviceID, zoneID, err)
 	}
 
-	var updateStmt string
+	from, err := instancestate.Parse(status)
+	if err != nil {
+		return fmt.Errorf("instance %s used by %s has %v", instanceID, deviceID, err)
+	}
+	columns := []instancestate.Column{{Name: "device_id", Value: "null"}}
 	if isElastic == 1 { // 如果是弹性实例就需要修改site_id为null
-		updateStmt = fmt.Sprintf(`UPDATE instance_%s SET site_id = 'null', status = 'available', device_id = 'null' WHERE instance_id = ?`, zoneID)
-	} else { // 否则就不需要
-		updateStmt = fmt.Sprintf(`UPDATE instance_%s SET status = 'available', device_id = 'null' WHERE instance_id = ?`, zoneID)
+		columns = append(columns, instancestate.Column{Name: "site_id", Value: "null"})
 	}
-
-	_, err = database.DB.Exec(updateStmt, instanceID)
+	err = instancestate.Apply(ctx, database.DB, serviceName, instancestate.Change{
+		ZoneId:     zoneID,
+		InstanceId: instanceID,
+		From:       from,
+		To:         instancestate.Available,
+		Reason:     "device " + deviceID + " logged out",
+		Columns:    columns,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to update instance information when %s logged out from %s: %v", deviceID, zoneID, err)
 	}
@@ -79,17 +141,18 @@ func GetZoneListInDB() (map[string][]string, error) {
 		if err := rows.Scan(&tableName); err != nil {
 			return nil, err
 		}
-		zoneID := strings.TrimPrefix(tableName, "instance_")
+		zoneID, ok := instancestate.ZoneFromTable(tableName)
+		if !ok {
+			continue
+		}
 
 		sites, err := GetSiteListInZone(zoneID)
 		if err != nil {
-			log.Printf("Error getting unique site IDs for %s: %v", tableName, err)
+			slog.Error("Error getting unique site IDs", "zone_id", zoneID, "error", err)
 			continue
 		}
 		zoneList[zoneID] = sites
 	}
-
-	fmt.Println(zoneList)
 	return zoneList, nil
 }
 
@@ -115,55 +178,103 @@ func GetSiteListInZone(zoneID string) ([]string, error) {
 	return siteList, nil
 }
 
-func getAvailableInstanceFromSite(zoneID string, siteID string) (*model.Instance, error) {
+func getAvailableInstanceFromSite(ctx context.Context, zoneID string, siteID string, flavor string) (_ *model.Instance, err error) {
+	ctx, span := tracer.Start(ctx, "instance.querySite")
+	defer func() { tracing.End(span, err) }()
+
 	instance := &model.Instance{ZoneID: zoneID}
 
-	query := `SELECT * FROM instance_%s WHERE site_id = ? AND is_elastic = 0 AND status = 'available' LIMIT 1`
-	stmt, err := database.DB.Prepare(fmt.Sprintf(query, zoneID))
+	// 封锁的实例、封锁的站点和处于维护窗口的站点上的实例不再分配给终端
+	query := `SELECT %s FROM instance_%s WHERE site_id = ? AND is_elastic = 0 AND status = 'available' AND flavor = ? AND cordoned = 0
+		AND NOT EXISTS (SELECT 1 FROM sites WHERE zone_id = ? AND site_id = ? AND cordoned = 1)
+		AND NOT EXISTS (SELECT 1 FROM maintenance_windows WHERE zone_id = ? AND (site_id = '' OR site_id = ?) AND starts_at <= ? AND ends_at > ?) LIMIT 1`
+	stmt, err := database.DB.PrepareContext(ctx, fmt.Sprintf(query, instanceColumns, zoneID))
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
-	err = stmt.QueryRow(siteID).Scan(&instance.SiteID, &instance.ServerIP, &instance.InstanceID, &instance.PodName, &instance.Port, &instance.IsElastic, &instance.Status, &instance.DeviceId)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	err = scanInstance(stmt.QueryRowContext(ctx, siteID, flavor, zoneID, siteID, zoneID, siteID, now, now), instance)
 	if err != nil {
 		return nil, err
 	}
 	return instance, nil
 }
 
-func getAvailableInstanceFromCenter(zoneID string) (*model.Instance, error) {
+func getAvailableInstanceFromCenter(ctx context.Context, zoneID string, flavor string) (_ *model.Instance, err error) {
+	ctx, span := tracer.Start(ctx, "instance.queryCenter")
+	defer func() { tracing.End(span, err) }()
+
 	instance := &model.Instance{ZoneID: zoneID}
 
-	query := `SELECT * FROM instance_%s WHERE is_elastic = 1 AND status = 'available' LIMIT 1`
-	stmt, err := database.DB.Prepare(fmt.Sprintf(query, zoneID))
+	query := `SELECT %s FROM instance_%s WHERE is_elastic = 1 AND status = 'available' AND flavor = ? LIMIT 1`
+	stmt, err := database.DB.PrepareContext(ctx, fmt.Sprintf(query, instanceColumns, zoneID))
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow().Scan(&instance.SiteID, &instance.ServerIP, &instance.InstanceID, &instance.PodName, &instance.Port, &instance.IsElastic, &instance.Status, &instance.DeviceId)
+	err = scanInstance(stmt.QueryRowContext(ctx, flavor), instance)
 	if err != nil {
 		return nil, err
 	}
 	return instance, nil
 }
 
-// loginDevice 登出时更新实例的状态和设备ID
-func loginDevice(instance *model.Instance, deviceID string, position string) (*model.Instance, error) {
-	var err error
+func scanInstance(row *sql.Row, instance *model.Instance) error {
+	return row.Scan(&instance.SiteID, &instance.ServerIP, &instance.InstanceID, &instance.PodName, &instance.Port, &instance.IsElastic, &instance.Status, &instance.DeviceId, &instance.Flavor)
+}
+
+// loginDevice 接入时更新实例的状态和设备ID
+func loginDevice(ctx context.Context, instance *model.Instance, deviceID string, position string) (_ *model.Instance, err error) {
+	ctx, span := tracer.Start(ctx, "instance.login", trace.WithAttributes(attribute.String("position", position)))
+	defer func() { tracing.End(span, err) }()
+
+	columns := []instancestate.Column{{Name: "device_id", Value: deviceID}}
 	if position == "center" {
-		updateStmt := fmt.Sprintf(`UPDATE instance_%s SET site_id = ?, status = "using", device_id = ? WHERE instance_id = ?`, instance.ZoneID)
-		_, err = database.DB.Exec(updateStmt, instance.SiteID, deviceID, instance.InstanceID)
-	} else if position == "site" {
-		updateStmt := fmt.Sprintf(`UPDATE instance_%s SET status = "using", device_id = ? WHERE instance_id = ?`, instance.ZoneID)
-		_, err = database.DB.Exec(updateStmt, deviceID, instance.InstanceID)
+		columns = append(columns, instancestate.Column{Name: "site_id", Value: instance.SiteID})
 	}
+	// 只在实例仍然可用时接入，避免多个副本把同一个实例分配给不同的终端
+	err = instancestate.Apply(ctx, database.DB, serviceName, instancestate.Change{
+		ZoneId:     instance.ZoneID,
+		InstanceId: instance.InstanceID,
+		From:       instancestate.Available,
+		To:         instancestate.Using,
+		Reason:     "device " + deviceID + " logged in at " + position,
+		Columns:    columns,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	instance.Status = "using"
+	instance.Status = string(instancestate.Using)
 	instance.DeviceId = deviceID
 
 	return instance, nil
 }
+
+// CountActiveSessions 统计 zone 中各站点正在使用的实例数量，返回 站点 -> 是否弹性实例 -> 数量。
+func CountActiveSessions(zoneID string) (map[string]map[int]int, error) {
+	rows, err := database.DB.Query(fmt.Sprintf("SELECT site_id, is_elastic, COUNT(*) FROM instance_%s WHERE %s GROUP BY site_id, is_elastic", zoneID, inSession))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make(map[string]map[int]int)
+	for rows.Next() {
+		var (
+			siteID    string
+			isElastic int
+			count     int
+		)
+		if err := rows.Scan(&siteID, &isElastic, &count); err != nil {
+			return nil, err
+		}
+		if sessions[siteID] == nil {
+			sessions[siteID] = make(map[int]int)
+		}
+		sessions[siteID][isElastic] = count
+	}
+	return sessions, rows.Err()
+}
@@ -6,12 +6,12 @@ import (
 	"usercenter/database"
 )
 
-// RecordCountForSite 查询站点下 status 为 'using' 的实例个数
-func RecordCountForSite(zoneID string, siteID string) (int, error) {
+// RecordCountForSite 查询站点下某个规格接入了终端的实例个数
+func RecordCountForSite(zoneID string, siteID string, flavor string) (int, error) {
 
-	query := fmt.Sprintf("SELECT COUNT(*) FROM instance_%s WHERE site_id = ? AND status = 'using'", zoneID)
+	query := fmt.Sprintf("SELECT COUNT(*) FROM instance_%s WHERE site_id = ? AND %s AND flavor = ?", zoneID, inSession)
 	var count int
-	err := database.DB.QueryRow(query, siteID).Scan(&count)
+	err := database.DB.QueryRow(query, siteID, flavor).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
@@ -19,21 +19,21 @@ func RecordCountForSite(zoneID string, siteID string) (int, error) {
 }
 
 // InsertRecord 插入记录到 records 表
-func InsertRecord(zoneID string, siteID string, date string, instances int, loginFailures int) error {
-	insertQuery := fmt.Sprintf("INSERT INTO record_%s (site_id, date, instances, login_failures) VALUES (?, ?, ?, ?)", zoneID)
-	if _, err := database.DB.Exec(insertQuery, siteID, date, instances, loginFailures); err != nil {
+func InsertRecord(zoneID string, siteID string, date string, instances int, loginFailures int, flavor string) error {
+	insertQuery := fmt.Sprintf("INSERT INTO record_%s (site_id, date, instances, login_failures, flavor) VALUES (?, ?, ?, ?, ?)", zoneID)
+	if _, err := database.DB.Exec(insertQuery, siteID, date, instances, loginFailures, flavor); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// QueryLoginFailures 查询某个 Site 过去一段时间内登陆失败的次数
-func QueryLoginFailures(zoneID string, siteID string, endTime time.Time, duration time.Duration) (int, error) {
+// QueryLoginFailures 查询某个 Site 某个规格过去一段时间内登陆失败的次数
+func QueryLoginFailures(zoneID string, siteID string, flavor string, endTime time.Time, duration time.Duration) (int, error) {
 	var count int
 	startTime := endTime.Add(-duration)
-	query := "SELECT COUNT(*) FROM login_failures WHERE zone_id = ? AND site_id = ? AND date BETWEEN ? AND ?"
-	err := database.DB.QueryRow(query, zoneID, siteID, startTime, endTime).Scan(&count)
+	query := "SELECT COUNT(*) FROM login_failures WHERE zone_id = ? AND site_id = ? AND flavor = ? AND date BETWEEN ? AND ?"
+	err := database.DB.QueryRow(query, zoneID, siteID, flavor, startTime, endTime).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
@@ -42,9 +42,9 @@ func QueryLoginFailures(zoneID string, siteID string, endTime time.Time, duratio
 }
 
 // InsertLoginFailure 插入登陆失败的记录
-func InsertLoginFailure(zoneID string, siteID string, date time.Time, deviceID string) error {
-	insertQuery := "INSERT INTO login_failures (zone_id, site_id, date, device_id) VALUES (?, ?, ?, ?)"
-	if _, err := database.DB.Exec(insertQuery, zoneID, siteID, date, deviceID); err != nil {
+func InsertLoginFailure(zoneID string, siteID string, date time.Time, deviceID string, flavor string) error {
+	insertQuery := "INSERT INTO login_failures (zone_id, site_id, date, device_id, flavor) VALUES (?, ?, ?, ?, ?)"
+	if _, err := database.DB.Exec(insertQuery, zoneID, siteID, date, deviceID, flavor); err != nil {
 		return err
 	}
 	return nil
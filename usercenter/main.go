@@ -1,15 +1,17 @@
 package main
 
 import (
+	"common/tracing"
 	"context"
 	"errors"
-	"fmt"
 	"log"
+	"log/slog"
 	"os/signal"
 	"sync"
 	"syscall"
 	"time"
 	"usercenter/config"
+	"usercenter/database"
 	"usercenter/database/service"
 	"usercenter/server"
 
@@ -28,7 +30,7 @@ func startRecord() {
 
 	zones, err := service.GetZoneListInDB()
 	if err != nil {
-		log.Printf("Failed to get zone list in database: %s", err.Error())
+		slog.Error("Failed to get zone list in database", "error", err)
 		return
 	}
 
@@ -42,28 +44,31 @@ func startRecord() {
 		curTime := preTime.Add(time.Minute)
 		for zoneID, sites := range zones {
 			for _, siteID := range sites {
-				wg.Add(1)
-				go func(zoneID string, siteID string, curTime time.Time) {
-					defer wg.Done()
-					// 1. 查询site正在使用中的实例数
-					instances, err := service.RecordCountForSite(zoneID, siteID)
-					if err != nil {
-						log.Printf("Failed to get instance count for site %s: %v", siteID, err)
-						return
-					}
-					// 2. 查询site过去一分钟登录失败的次数
-					loginFailures, err := service.QueryLoginFailures(zoneID, siteID, curTime, time.Minute)
-					if err != nil {
-						log.Printf("Failed to get login failures for site %s: %v", siteID, err)
-						return
-					}
-					fmt.Printf("%s: Site %s has %d instances now, and %d devices failed to log in last one minute\n", curTime.Format("2006-01-02 15:04:00"), siteID, instances, loginFailures)
-					// 3. 插入最新数据
-					err = service.InsertRecord(zoneID, siteID, curTime.Format("2006-01-02 15:04:00"), instances, loginFailures)
-					if err != nil {
-						log.Printf("Failed to insert record for site %s: %v", siteID, err)
-					}
-				}(zoneID, siteID, curTime)
+				for _, flavor := range config.FLAVORS {
+					wg.Add(1)
+					go func(zoneID string, siteID string, flavor string, curTime time.Time) {
+						defer wg.Done()
+						logger := slog.With("zone_id", zoneID, "site_id", siteID, "flavor", flavor)
+						// 1. 查询site正在使用中的实例数
+						instances, err := service.RecordCountForSite(zoneID, siteID, flavor)
+						if err != nil {
+							logger.Error("Failed to get instance count", "error", err)
+							return
+						}
+						// 2. 查询site过去一分钟登录失败的次数
+						loginFailures, err := service.QueryLoginFailures(zoneID, siteID, flavor, curTime, time.Minute)
+						if err != nil {
+							logger.Error("Failed to get login failures", "error", err)
+							return
+						}
+						logger.Debug("Site record", "date", curTime.Format("2006-01-02 15:04:00"), "instances", instances, "login_failures", loginFailures)
+						// 3. 插入最新数据
+						err = service.InsertRecord(zoneID, siteID, curTime.Format("2006-01-02 15:04:00"), instances, loginFailures, flavor)
+						if err != nil {
+							logger.Error("Failed to insert record", "error", err)
+						}
+					}(zoneID, siteID, flavor, curTime)
+				}
 			}
 		}
 		wg.Wait()
@@ -72,7 +77,21 @@ func startRecord() {
 }
 
 func main() {
+	config.Load()
+	database.Connect()
+
 	ctx, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	klog.SetSlogLogger(slog.Default())
+
+	shutdownTracing, err := tracing.Setup(ctx, "usercenter", config.TRACEEXPORTER, config.TRACEFILE)
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("Failed to shut down tracing", "error", err)
+		}
+	}()
 
 	// 从业务集群中获取 config，并创建客户端。
 	conf, err := rest.InClusterConfig()
@@ -89,7 +108,7 @@ func main() {
 		for err != nil {
 			err = server.Serve(ctx, "0.0.0.0", config.USERCENTERPORT)
 		}
-		fmt.Printf("server started\n")
+		slog.Info("Server stopped")
 	}()
 
 	// 创建分布式锁。
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"log/slog"
+	"usercenter/database/service"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "dispatcher_usercenter"
+
+// Source 返回实例的来源，边缘站点的固定实例为 edge，中心的弹性实例为 center。
+func Source(isElastic int) string {
+	if isElastic == 1 {
+		return "center"
+	}
+	return "edge"
+}
+
+var (
+	// Logins 是终端登录的次数，登录失败时 source 为 none。
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Number of device logins by zone, site, instance source and result.",
+	}, []string{"zone", "site", "source", "result"})
+
+	// LoginDuration 是处理一次终端登录的耗时。
+	LoginDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "login_duration_seconds",
+		Help:      "Latency of device login requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+)
+
+var activeSessionsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "active_sessions"),
+	"Number of instances in use by zone, site and instance source.",
+	[]string{"zone", "site", "source"}, nil,
+)
+
+// sessionCollector 在抓取时从数据库统计正在使用的实例，多个副本的结果保持一致。
+type sessionCollector struct{}
+
+func (sessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+}
+
+func (sessionCollector) Collect(ch chan<- prometheus.Metric) {
+	zones, err := service.GetZoneListInDB()
+	if err != nil {
+		slog.Error("Failed to get zone list when collecting metrics", "error", err)
+		return
+	}
+	for zoneID := range zones {
+		sessions, err := service.CountActiveSessions(zoneID)
+		if err != nil {
+			slog.Error("Failed to count active sessions when collecting metrics", "zone_id", zoneID, "error", err)
+			continue
+		}
+		for siteID, counts := range sessions {
+			for isElastic, count := range counts {
+				ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(count), zoneID, siteID, Source(isElastic))
+			}
+		}
+	}
+}
+
+func init() {
+	prometheus.MustRegister(sessionCollector{})
+}
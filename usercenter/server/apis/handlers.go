@@ -1,39 +1,65 @@
 package apis
 
 import (
-	"log"
+	"common/logging"
 	"net/http"
 	"time"
 	"usercenter/config"
 	"usercenter/database/model"
 	"usercenter/database/service"
+	"usercenter/metrics"
 )
 
 type DeviceLoginResponse struct {
 	Instance *model.Instance `json:"instance"`
 }
 
-// 根据表单数据将终端接入可用实例
+// requireDevice 检查表单或 query 中是否提供了 zone_id、site_id 和 device_id，缺少时返回 400。
+// 两者都是可选的，OpenAPI 文档无法校验字段必须至少出现在其中一处。
+func requireDevice(w http.ResponseWriter, zoneID string, siteID string, deviceID string) bool {
+	if zoneID == "" || siteID == "" || deviceID == "" {
+		SendErrorResponse(w, &ErrorCodeWithMessage{
+			HttpStatus: http.StatusBadRequest,
+			ErrorCode:  400,
+			Message:    "Bad request",
+		}, "zone_id, site_id and device_id are required")
+		return false
+	}
+	return true
+}
+
+// 根据表单数据将终端接入可用实例，flavor 为空时使用默认规格，规格配置中没有的规格返回 400。
+// 表单字段已经由路由中间件按 OpenAPI 文档校验。
 func DeviceLogin(w http.ResponseWriter, r *http.Request) {
 	zoneID := r.PostFormValue("zone_id")
 	siteID := r.PostFormValue("site_id")
 	deviceID := r.PostFormValue("device_id")
-
-	if zoneID == "" || siteID == "" || deviceID == "" {
+	if !requireDevice(w, zoneID, siteID, deviceID) {
+		return
+	}
+	flavor := r.PostFormValue("flavor")
+	if flavor == "" {
+		flavor = service.DefaultFlavor
+	}
+	if !config.HasFlavor(flavor) {
 		SendErrorResponse(w, &ErrorCodeWithMessage{
 			HttpStatus: http.StatusBadRequest,
 			ErrorCode:  400,
 			Message:    "Bad request",
-		}, "Zone_id, site_id or device_id not specified")
+		}, "unknown flavor "+flavor)
 		return
 	}
+	logger := logging.FromContext(r.Context()).With("zone_id", zoneID, "site_id", siteID, "device_id", deviceID, "flavor", flavor)
 
-	instance, err := service.GetInstanceAndLogin(zoneID, siteID, deviceID)
+	start := time.Now()
+	instance, err := service.GetInstanceAndLogin(r.Context(), zoneID, siteID, deviceID, flavor)
 	if err != nil {
+		metrics.Logins.WithLabelValues(zoneID, siteID, "none", "failure").Inc()
+		metrics.LoginDuration.WithLabelValues("failure").Observe(time.Since(start).Seconds())
 		if config.RECORDENABLED {
-			service.InsertLoginFailure(zoneID, siteID, time.Now(), deviceID)
+			service.InsertLoginFailure(zoneID, siteID, time.Now(), deviceID, flavor)
 		}
-		log.Printf("Failed to login: %v", err)
+		logger.Warn("Failed to login", "error", err)
 		SendErrorResponse(w, &ErrorCodeWithMessage{
 			HttpStatus: http.StatusBadRequest,
 			ErrorCode:  500,
@@ -42,6 +68,10 @@ func DeviceLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metrics.Logins.WithLabelValues(zoneID, siteID, metrics.Source(instance.IsElastic), "success").Inc()
+	logger.Info("Device logged in", "instance_id", instance.InstanceID, "source", metrics.Source(instance.IsElastic))
+	metrics.LoginDuration.WithLabelValues("success").Observe(time.Since(start).Seconds())
+
 	SendHttpResponse(w, &Response{
 		StatusCode: 200,
 		Message:    "Succeeded to get available instance and login",
@@ -56,19 +86,14 @@ func DeviceLogout(w http.ResponseWriter, r *http.Request) {
 	zoneID := r.PostFormValue("zone_id")
 	siteID := r.PostFormValue("site_id")
 	deviceID := r.PostFormValue("device_id")
-
-	if zoneID == "" || siteID == "" || deviceID == "" {
-		SendErrorResponse(w, &ErrorCodeWithMessage{
-			HttpStatus: http.StatusBadRequest,
-			ErrorCode:  400,
-			Message:    "Bad request",
-		}, "Zone_id, site_id or device_id not specified")
+	if !requireDevice(w, zoneID, siteID, deviceID) {
 		return
 	}
 
-	err := service.LogoutDevice(zoneID, siteID, deviceID)
+	logger := logging.FromContext(r.Context()).With("zone_id", zoneID, "site_id", siteID, "device_id", deviceID)
+	err := service.LogoutDevice(r.Context(), zoneID, siteID, deviceID)
 	if err != nil {
-		log.Printf("Failed to logout: %v", err)
+		logger.Warn("Failed to logout", "error", err)
 		SendErrorResponse(w, &ErrorCodeWithMessage{
 			HttpStatus: http.StatusBadRequest,
 			ErrorCode:  500,
@@ -77,6 +102,7 @@ func DeviceLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	logger.Info("Device logged out")
 	SendHttpResponse(w, &Response{
 		StatusCode: 200,
 		Message:    "Device logout successfully",
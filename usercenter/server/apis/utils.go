@@ -2,7 +2,7 @@ package apis
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
@@ -27,7 +27,7 @@ func SendHttpResponse(w http.ResponseWriter, m *Response, httpCode int) {
 	if m != nil {
 		err := json.NewEncoder(w).Encode(m)
 		if err != nil {
-			log.Printf("Failed to encode response: %v\n", err)
+			slog.Error("Failed to encode response", "error", err)
 			return
 		}
 	}
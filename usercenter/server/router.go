@@ -1,20 +1,34 @@
 package server
 
 import (
+	"common/logging"
+	"common/openapi"
+	_ "embed"
 	"net/http"
 	"usercenter/server/apis"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 var (
 	healthzPath  = "/healthz"
 	deviceLogin  = "/device/login"
 	deviceLogout = "/device/logout"
+	metricsPath  = "/metrics"
+	openapiPath  = "/openapi.json"
 )
 
+//go:embed openapi.yaml
+var openapiDocument []byte
+
+// spec 是 usercenter 接口的 OpenAPI 文档，请求先按文档校验再交给各个接口处理。
+var spec = openapi.MustLoad(openapiDocument)
+
 func NewRouter() *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
+	router.Use(otelmux.Middleware("usercenter"), logging.Middleware, spec.Middleware)
 	router.
 		Methods(http.MethodGet).
 		Path(healthzPath).
@@ -33,5 +47,17 @@ func NewRouter() *mux.Router {
 		Name("deviceLogout").
 		HandlerFunc(apis.DeviceLogout)
 
+	router.
+		Methods(http.MethodGet).
+		Path(metricsPath).
+		Name("metrics").
+		Handler(promhttp.Handler())
+
+	router.
+		Methods(http.MethodGet).
+		Path(openapiPath).
+		Name("openapi").
+		Handler(spec)
+
 	return router
 }
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// undocumented 是不在 OpenAPI 文档中描述的路由。
+var undocumented = map[string]bool{metricsPath: true, openapiPath: true}
+
+func TestRoutesAreDocumented(t *testing.T) {
+	err := NewRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || undocumented[path] {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("route %s has no methods", path)
+			return nil
+		}
+		for _, method := range methods {
+			if !spec.HasOperation(method, path) {
+				t.Errorf("%s %s is not documented in openapi.yaml", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeviceFieldsAreRequired(t *testing.T) {
+	// 字段可以放在表单或 query 中，都缺少时由接口返回 400。
+	for _, target := range []string{deviceLogin, deviceLogout, deviceLogout + "?zone_id=huadong&site_id=site-1"} {
+		r := httptest.NewRequest(http.MethodPost, target, nil)
+		w := httptest.NewRecorder()
+		NewRouter().ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "device_id") {
+			t.Errorf("unexpected response for %s: %d %s", target, w.Code, w.Body)
+		}
+	}
+}
+
+func TestUnknownFlavorIsRejected(t *testing.T) {
+	// 默认配置只有 default 规格，其他规格在查询数据库之前返回 400。
+	r := httptest.NewRequest(http.MethodPost, deviceLogin, strings.NewReader("zone_id=huadong&site_id=site-1&device_id=device-1&flavor=gpu-4k"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown flavor gpu-4k") {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body)
+	}
+}
@@ -3,7 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
@@ -15,7 +15,7 @@ func Serve(ctx context.Context, host string, port string) error {
 	}
 	err := httpServer.ListenAndServe()
 	if err != nil {
-		log.Printf("Failed to start server: %v\n", err)
+		slog.Error("Failed to start server", "error", err)
 		return err
 	}
 
@@ -23,7 +23,7 @@ func Serve(ctx context.Context, host string, port string) error {
 		<-ctx.Done()
 		err := httpServer.Shutdown(context.Background())
 		if err != nil {
-			log.Printf("Shutting down server failed: %v", err)
+			slog.Error("Shutting down server failed", "error", err)
 		}
 	}()
 
@@ -1,14 +1,97 @@
 package main
 
 import (
-	"fmt"
-	"github.com/gorilla/mux"
+	"bytes"
+	"embed"
+	"io/fs"
+	"log"
+	"log/slog"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// assets 是预先构建的前端页面。
+//
+//go:embed index.html asset-manifest.json favicon.ico logo192.png logo512.png manifest.json robots.txt static
+var assets embed.FS
+
+// bundleManagerURL 是构建前端页面时写死在代码中的 manager 地址。
+const bundleManagerURL = "http://10.10.103.51:31365"
+
+// managerPaths 是转发给 manager 的接口路径前缀。
+var managerPaths = []string{"/bounce/", "/dashboard/", "/decisions"}
+
+var (
+	WEBADDR    = "0.0.0.0:8080" // 页面服务监听地址
+	MANAGERURL string           // manager 的地址，例如 http://manager:6666，设置后页面通过本服务访问 manager 的接口
 )
 
+func init() {
+	if addr := os.Getenv("WEB_ADDR"); addr != "" {
+		WEBADDR = addr
+	}
+	MANAGERURL = os.Getenv("MANAGER_URL")
+}
+
+// rewriteBundle 将前端代码中写死的 manager 地址替换为同源地址，使请求经过本服务转发。
+func rewriteBundle(static fs.FS) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := fs.WalkDir(static, "static/js", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".js" {
+			return err
+		}
+		data, err := fs.ReadFile(static, p)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, []byte(bundleManagerURL)) {
+			files["/"+p] = bytes.ReplaceAll(data, []byte(bundleManagerURL), nil)
+		}
+		return nil
+	})
+	return files, err
+}
+
 func main() {
 	r := mux.NewRouter()
-	r.PathPrefix("/").Handler(http.StripPrefix("/", http.FileServer(http.Dir("./"))))
-	fmt.Printf("Starting server at http://10.10.103.51:8080\n")
-	http.ListenAndServe("10.10.103.51:8080", r)
+	static := http.FileServer(http.FS(assets))
+	var fileServer http.Handler = static
+
+	if MANAGERURL != "" {
+		target, err := url.Parse(MANAGERURL)
+		if err != nil {
+			log.Fatalf("Invalid MANAGER_URL %q: %v", MANAGERURL, err)
+		}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		// 仪表盘的事件流需要立即转发。
+		proxy.FlushInterval = -1
+		for _, prefix := range managerPaths {
+			r.PathPrefix(prefix).Handler(proxy)
+		}
+
+		rewritten, err := rewriteBundle(assets)
+		if err != nil {
+			log.Fatalf("Failed to rewrite bundle: %v", err)
+		}
+		startedAt := time.Now()
+		fileServer = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if data, ok := rewritten[req.URL.Path]; ok {
+				http.ServeContent(w, req, path.Base(req.URL.Path), startedAt, bytes.NewReader(data))
+				return
+			}
+			static.ServeHTTP(w, req)
+		})
+	}
+	r.PathPrefix("/").Handler(fileServer)
+
+	slog.Info("Starting server", "addr", WEBADDR, "manager", MANAGERURL)
+	if err := http.ListenAndServe(WEBADDR, r); err != nil {
+		log.Fatalf("Server stopped: %v", err)
+	}
 }